@@ -0,0 +1,13 @@
+(() => {
+    const sourceType = document.getElementById("source_type");
+
+    const toggle = () => {
+        document.querySelectorAll('[data-source]').forEach(el => {
+            el.classList.toggle('d-none', el.getAttribute('data-source') != sourceType.value);
+        });
+    };
+
+    sourceType.addEventListener('change', toggle);
+    toggle();
+
+})();
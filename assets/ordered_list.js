@@ -0,0 +1,15 @@
+(() => {
+
+    $(() => {
+        $('.ordered-list').on('click', '.ordered-list-up', (event) => {
+            const $item = $(event.currentTarget).closest('.ordered-list-item');
+            $item.insertBefore($item.prev('.ordered-list-item'));
+        });
+
+        $('.ordered-list').on('click', '.ordered-list-down', (event) => {
+            const $item = $(event.currentTarget).closest('.ordered-list-item');
+            $item.insertAfter($item.next('.ordered-list-item'));
+        });
+    });
+
+})();
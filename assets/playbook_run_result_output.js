@@ -1,23 +1,55 @@
 (() => {
 
     ///////////////////////////////////////////////////////////////////////////
-    //collapse empty output blocks
 
     $(() => {
-        $('.card .card-body').each((idx, el) => {
+        render($(document));
+        $('.task-result-details').on('toggle', loadDetails);
+    });
+
+    function render($root) {
+        //collapse empty output blocks
+        $root.find('.card .card-body').each((idx, el) => {
             const $el = $(el);
             if ($el.text().trim().length === 0) {
                 $el.addClass('card-body-collapse');
             }
         });
-    });
+
+        $root.find('.diff').each(makeDiff);
+
+        const ansi = new AnsiUp();
+        $root.find('.ansi-output').each((idx, el) => {
+            const $el = $(el);
+            $el.html(ansi.ansi_to_html($el.text()));
+        });
+    }
 
     ///////////////////////////////////////////////////////////////////////////
-    //diff
+    //task output, differences and facts are loaded from run output on demand
 
-    $(() => {
-        $('.diff').each(makeDiff);
-    });
+    function loadDetails(event) {
+        const $el = $(event.currentTarget);
+        if (!event.currentTarget.open || $el.data('loaded')) {
+            return;
+        }
+        $el.data('loaded', true);
+
+        const $content = $el.find('.task-result-details-content');
+        $content.text('Loading...');
+        $.get($el.data('url'))
+            .done((html) => {
+                $content.html(html);
+                render($content);
+            })
+            .fail(() => {
+                $el.data('loaded', false);
+                $content.html('<span class="text-danger">Unable to load task output</span>');
+            });
+    }
+
+    ///////////////////////////////////////////////////////////////////////////
+    //diff
 
     function makeDiff(idx, el) {
         const $el = $(el);
@@ -40,17 +72,4 @@
         new Diff2HtmlUI(el, diff, configuration).draw();
     }
 
-    ///////////////////////////////////////////////////////////////////////////
-
-    $(() => {
-        const ansi = new AnsiUp();
-
-        $('.ansi-output').each((idx, el) => {
-            const $el = $(el);
-            $el.html(ansi.ansi_to_html($el.text()));
-        })
-    });
-
 })();
-
-
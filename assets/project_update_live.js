@@ -0,0 +1,23 @@
+(() => {
+    const updateLive = document.getElementById("update-live");
+    const log = document.getElementById("update-live-log");
+    const url = updateLive.getAttribute('data-status-url');
+    const updatesUrl = updateLive.getAttribute('data-updates-url');
+
+    if (updateLive.getAttribute('data-running') != 1) {
+        return;
+    }
+
+    setInterval(() => {
+        fetch(url).then(data => {
+            return data.json();
+        }).then(data => {
+            if (!data.running) {
+                location.href = updatesUrl;
+                return;
+            }
+            log.textContent = data.log;
+        })
+    }, 1500);
+
+})();
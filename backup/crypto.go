@@ -0,0 +1,126 @@
+package backup
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"io"
+)
+
+const (
+	KdfArgon2id = "argon2id"
+
+	kdfTime       = 3
+	kdfMemory     = 64 * 1024
+	kdfThreads    = 4
+	kdfTimeMax    = 16
+	kdfMemoryMax  = 1024 * 1024
+	kdfSaltLength = 16
+	kdfKeyLength  = 32
+)
+
+// Kdf Key derivation parameters, bundle key is derived from passphrase with random salt and work factor,
+// so stolen bundle can not be brute-forced cheaply. Memory is in KiB
+type Kdf struct {
+	Name    string `json:"name"`
+	Salt    string `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// bundleCipher Encrypts bundle secrets with key derived from passphrase
+type bundleCipher struct {
+	aead cipher.AEAD
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// newKdf Default derivation parameters with new random salt
+func newKdf() (*Kdf, error) {
+	salt := make([]byte, kdfSaltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	return &Kdf{
+		Name:    KdfArgon2id,
+		Salt:    hex.EncodeToString(salt),
+		Time:    kdfTime,
+		Memory:  kdfMemory,
+		Threads: kdfThreads,
+	}, nil
+}
+
+// validate Checks parameters read from bundle, limits keep crafted bundle from exhausting memory
+func (k *Kdf) validate() error {
+	if k == nil {
+		return errors.New("bundle key derivation parameters missing")
+	}
+	if k.Name != KdfArgon2id {
+		return fmt.Errorf("unsupported bundle key derivation %q", k.Name)
+	}
+	salt, err := hex.DecodeString(k.Salt)
+	if err != nil || len(salt) < kdfSaltLength {
+		return errors.New("bundle key derivation salt is invalid")
+	}
+	if k.Time == 0 || k.Time > kdfTimeMax || k.Memory == 0 || k.Memory > kdfMemoryMax || k.Threads == 0 {
+		return errors.New("bundle key derivation parameters are out of range")
+	}
+	return nil
+}
+
+func newBundleCipher(passphrase string, kdf *Kdf) (*bundleCipher, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("bundle passphrase required")
+	}
+	if err := kdf.validate(); err != nil {
+		return nil, err
+	}
+	salt, _ := hex.DecodeString(kdf.Salt)
+	key := argon2.IDKey([]byte(passphrase), salt, kdf.Time, kdf.Memory, kdf.Threads, kdfKeyLength)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &bundleCipher{aead: aead}, nil
+}
+
+// encrypt Hex of nonce and ciphertext, empty text is kept empty
+func (c *bundleCipher) encrypt(text string) (string, error) {
+	if len(text) == 0 {
+		return text, nil
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(c.aead.Seal(nonce, nonce, []byte(text), nil)), nil
+}
+
+func (c *bundleCipher) decrypt(text string) (string, error) {
+	if len(text) == 0 {
+		return text, nil
+	}
+	encrypted, err := hex.DecodeString(text)
+	if err != nil {
+		return "", fmt.Errorf("encrypted text is not hex: %w", err)
+	}
+	if len(encrypted) < c.aead.NonceSize() {
+		return "", errors.New("encrypted text too short")
+	}
+	nonce, ciphertext := encrypted[:c.aead.NonceSize()], encrypted[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
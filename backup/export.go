@@ -0,0 +1,213 @@
+package backup
+
+import (
+	"ensemble/privatekeys"
+	"ensemble/storage"
+	"ensemble/storage/structures"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type ExportOptions struct {
+	Passphrase string
+	History    bool
+}
+
+// Export Collects users, keys, projects with access grants and optionally run history into bundle.
+// Project content is not included, uploaded archives of archive projects are left out as well
+func Export(store storage.Store, keys *privatekeys.KeyManager, options ExportOptions) (*Bundle, error) {
+	if len(options.Passphrase) == 0 {
+		return nil, errors.New("bundle passphrase required")
+	}
+
+	kdf, err := newKdf()
+	if err != nil {
+		return nil, err
+	}
+	bundleCipher, err := newBundleCipher(options.Passphrase, kdf)
+	if err != nil {
+		return nil, err
+	}
+	check, err := bundleCipher.encrypt(BundleFormat)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &Bundle{
+		Format:  BundleFormat,
+		Version: BundleVersion,
+		Created: time.Now().UTC(),
+		Kdf:     kdf,
+		Check:   check,
+	}
+	e := &exporter{
+		store:      store,
+		cipher:     bundleCipher,
+		userLogins: map[string]string{},
+		keyNames:   map[string]string{},
+	}
+
+	users, err := store.UserGetAll()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read users: %w", err)
+	}
+	e.users = users
+	for _, user := range users {
+		e.userLogins[user.Id] = user.Login
+		bundle.Users = append(bundle.Users, &User{
+			Login:        user.Login,
+			PasswordHash: user.Password,
+			Role:         user.Role,
+		})
+	}
+
+	storedKeys, err := store.KeyGetAll()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read keys: %w", err)
+	}
+	for _, key := range storedKeys {
+		e.keyNames[key.Id] = key.Name
+		content, err := keys.ReadKeyFile(key.Name)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read key %s file: %w", key.Name, err)
+		}
+		exportKey := &Key{Name: key.Name}
+		if exportKey.Password, err = e.encrypt(key.Password); err != nil {
+			return nil, err
+		}
+		if exportKey.Content, err = e.encrypt(content); err != nil {
+			return nil, err
+		}
+		bundle.Keys = append(bundle.Keys, exportKey)
+	}
+
+	projects, err := store.ProjectGetAll()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read projects: %w", err)
+	}
+	for _, project := range projects {
+		exportProject, err := e.project(project)
+		if err != nil {
+			return nil, fmt.Errorf("unable to export project %s: %w", project.Name, err)
+		}
+		if options.History {
+			if exportProject.Playbooks, err = e.playbooks(project.Id); err != nil {
+				return nil, fmt.Errorf("unable to export project %s history: %w", project.Name, err)
+			}
+		}
+		bundle.Projects = append(bundle.Projects, exportProject)
+	}
+
+	return bundle, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+type exporter struct {
+	store      storage.Store
+	cipher     *bundleCipher
+	users      []*structures.User
+	userLogins map[string]string
+	keyNames   map[string]string
+}
+
+func (e *exporter) encrypt(text string) (string, error) {
+	return e.cipher.encrypt(text)
+}
+
+func (e *exporter) project(project *structures.Project) (*Project, error) {
+	p := &Project{
+		Name:                 project.Name,
+		Description:          project.Description,
+		SourceType:           project.SourceType,
+		SourcePath:           project.SourcePath,
+		RepositoryUrl:        project.RepositoryUrl,
+		RepositoryLogin:      project.RepositoryLogin,
+		RepositoryBranch:     project.RepositoryBranch,
+		RevisionType:         project.RevisionType,
+		Revision:             project.Revision,
+		RepositoryKey:        e.keyNames[project.RepositoryKeyId],
+		RepositoryHostKeys:   project.RepositoryHostKeys,
+		RepositorySubmodules: project.RepositorySubmodules,
+		RepositoryLfs:        project.RepositoryLfs,
+		Inventory:            project.Inventory,
+		Inventories:          project.Inventories,
+		InventoryDefault:     project.InventoryDefault,
+		InventoryScripts:     project.InventoryScripts,
+		InventoryPlugins:     project.InventoryPlugins,
+		InventoryProtected:   project.InventoryProtected,
+		Collections:          project.Collections,
+		Variables:            project.Variables,
+		VariablesAvailable:   project.VariablesAvailable,
+		VariablesMain:        project.VariablesMain,
+		VariablesVault:       project.VariablesVault,
+		VariablesMainFile:    project.VariablesMainFile,
+		VariablesVaultFile:   project.VariablesVaultFile,
+		UpdateSchedule:       project.UpdateSchedule,
+		UpdatePolicy:         project.UpdatePolicy,
+	}
+
+	var err error
+	if p.RepositoryPassword, err = e.encrypt(project.RepositoryPassword); err != nil {
+		return nil, err
+	}
+	if p.InventoryEnv, err = e.encrypt(project.InventoryEnv); err != nil {
+		return nil, err
+	}
+	if p.VaultPassword, err = e.encrypt(project.VaultPassword); err != nil {
+		return nil, err
+	}
+
+	for _, user := range e.users {
+		if e.store.ProjectUserAccessExists(project.Id, user.Id) {
+			p.Access = append(p.Access, user.Login)
+		}
+	}
+	return p, nil
+}
+
+func (e *exporter) playbooks(projectId string) ([]*Playbook, error) {
+	playbooks, err := e.store.PlaybookGetByProject(projectId)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Playbook
+	for _, playbook := range playbooks {
+		p := &Playbook{
+			Filename:    playbook.Filename,
+			Name:        playbook.Name,
+			Description: playbook.Description,
+			Category:    playbook.Category,
+			Tags:        playbook.Tags,
+			Dangerous:   playbook.Dangerous,
+			Survey:      playbook.Survey,
+		}
+
+		runs, err := e.store.PlaybookRunGetByPlaybook(playbook.Id)
+		if err != nil {
+			return nil, err
+		}
+		for _, run := range runs {
+			r := &Run{
+				User:          e.userLogins[run.UserId],
+				Mode:          run.Mode,
+				StartTime:     run.StartTime,
+				FinishTime:    run.FinishTime,
+				Result:        run.Result,
+				InventoryFile: run.InventoryFile,
+				VariablesFile: run.VariablesFile,
+				ExtraVars:     run.ExtraVars,
+				Hosts:         run.Hosts,
+			}
+			runResult, err := e.store.RunResultGet(run.Id)
+			if err == nil && runResult != nil {
+				r.Output = runResult.Output
+				r.Error = runResult.Error
+			}
+			p.Runs = append(p.Runs, r)
+		}
+		result = append(result, p)
+	}
+	return result, nil
+}
@@ -0,0 +1,421 @@
+package backup
+
+import (
+	"ensemble/privatekeys"
+	"ensemble/storage"
+	"ensemble/storage/structures"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type ImportOptions struct {
+	Passphrase string
+	Conflict   string
+}
+
+// ImportReport Imported entities, names are prefixed with entity type
+type ImportReport struct {
+	Created []string
+	Updated []string
+	Skipped []string
+}
+
+// Import Creates bundle entities in storage, existing users, keys and projects with the same name are
+// kept, replaced or imported under a new name according to conflict option. Run history is imported only
+// into projects created by import. Entities are imported in one transaction, key files are written to
+// temporary files before it is committed and moved in place after, so failed import does not leave
+// partial changes. Keys which files could not be moved are listed in returned error
+func Import(store storage.Store, keys *privatekeys.KeyManager, bundle *Bundle, options ImportOptions) (*ImportReport, error) {
+	if err := validConflict(options.Conflict); err != nil {
+		return nil, err
+	}
+	bundleCipher, err := newBundleCipher(options.Passphrase, bundle.Kdf)
+	if err != nil {
+		return nil, err
+	}
+	check, err := bundleCipher.decrypt(bundle.Check)
+	if err != nil || check != BundleFormat {
+		return nil, errors.New("wrong bundle passphrase")
+	}
+
+	i := &importer{
+		cipher:   bundleCipher,
+		conflict: options.Conflict,
+		keyFiles: map[string]string{},
+	}
+
+	//secrets are decrypted before anything is written, so wrong bundle does not leave partial import
+	if err := i.decrypt(bundle); err != nil {
+		return nil, err
+	}
+
+	//staged key files left after failure are removed
+	staged := map[string]string{}
+	defer func() {
+		for name, path := range staged {
+			if err := os.Remove(path); err != nil {
+				log.Warnf("staged key %s file remove error: %s", name, err)
+			}
+		}
+	}()
+
+	err = store.Transaction(func(tx storage.Store) error {
+		i.store = tx
+		i.report = &ImportReport{}
+		i.userIds = map[string]string{}
+		i.keyIds = map[string]string{}
+
+		for _, user := range bundle.Users {
+			if err := i.user(user); err != nil {
+				return fmt.Errorf("unable to import user %s: %w", user.Login, err)
+			}
+		}
+		for _, key := range bundle.Keys {
+			if err := i.key(key); err != nil {
+				return fmt.Errorf("unable to import key %s: %w", key.Name, err)
+			}
+		}
+		for _, project := range bundle.Projects {
+			if err := i.project(project); err != nil {
+				return fmt.Errorf("unable to import project %s: %w", project.Name, err)
+			}
+		}
+		for name, content := range i.keyFiles {
+			path, err := keys.StageKeyFile(content)
+			if err != nil {
+				return fmt.Errorf("unable to write key %s file: %w", name, err)
+			}
+			staged[name] = path
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var failed []string
+	for name, path := range staged {
+		if err := keys.CommitKeyFile(path, name); err != nil {
+			log.Errorf("unable to move key %s file in place: %s", name, err)
+			failed = append(failed, name)
+			continue
+		}
+		delete(staged, name)
+	}
+	if len(failed) != 0 {
+		sort.Strings(failed)
+		return i.report, fmt.Errorf("bundle imported, files of keys %s were not written, upload them again", strings.Join(failed, ", "))
+	}
+	return i.report, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+type importer struct {
+	store    storage.Store
+	cipher   *bundleCipher
+	conflict string
+	report   *ImportReport
+	userIds  map[string]string
+	keyIds   map[string]string
+	keyFiles map[string]string
+}
+
+func (i *importer) decrypt(bundle *Bundle) error {
+	var err error
+	for _, key := range bundle.Keys {
+		if filepath.Base(key.Name) != key.Name || !filepath.IsLocal(key.Name) {
+			return fmt.Errorf("key name %q is not a file name", key.Name)
+		}
+		if key.Password, err = i.cipher.decrypt(key.Password); err != nil {
+			return fmt.Errorf("unable to decrypt key %s password: %w", key.Name, err)
+		}
+		if key.Content, err = i.cipher.decrypt(key.Content); err != nil {
+			return fmt.Errorf("unable to decrypt key %s: %w", key.Name, err)
+		}
+	}
+	for _, project := range bundle.Projects {
+		if project.RepositoryPassword, err = i.cipher.decrypt(project.RepositoryPassword); err != nil {
+			return fmt.Errorf("unable to decrypt project %s repository password: %w", project.Name, err)
+		}
+		if project.InventoryEnv, err = i.cipher.decrypt(project.InventoryEnv); err != nil {
+			return fmt.Errorf("unable to decrypt project %s inventory environment: %w", project.Name, err)
+		}
+		if project.VaultPassword, err = i.cipher.decrypt(project.VaultPassword); err != nil {
+			return fmt.Errorf("unable to decrypt project %s vault password: %w", project.Name, err)
+		}
+	}
+	return nil
+}
+
+func (i *importer) user(u *User) error {
+	existing, _ := i.store.UserGetByLogin(u.Login)
+	if existing == nil || i.conflict == ConflictRename {
+		user := &structures.User{
+			Login:    u.Login,
+			Password: u.PasswordHash,
+			Role:     u.Role,
+		}
+		if existing != nil {
+			user.Login = freeName(u.Login, i.store.UserExistsByLogin)
+		}
+		if err := i.store.UserInsert(user); err != nil {
+			return err
+		}
+		i.userIds[u.Login] = user.Id
+		i.created("user", user.Login)
+		return nil
+	}
+
+	i.userIds[u.Login] = existing.Id
+	if i.conflict == ConflictSkip {
+		i.skipped("user", u.Login)
+		return nil
+	}
+	existing.Password = u.PasswordHash
+	existing.Role = u.Role
+	if err := i.store.UserUpdate(existing); err != nil {
+		return err
+	}
+	i.updated("user", u.Login)
+	return nil
+}
+
+func (i *importer) key(k *Key) error {
+	existing, err := i.keyByName(k.Name)
+	if err != nil {
+		return err
+	}
+	if existing == nil || i.conflict == ConflictRename {
+		key := &structures.Key{
+			Name:     k.Name,
+			Password: k.Password,
+		}
+		if existing != nil {
+			key.Name = freeName(k.Name, i.keyExists)
+		}
+		if err := i.store.KeyInsert(key); err != nil {
+			return err
+		}
+		i.keyFiles[key.Name] = k.Content
+		i.keyIds[k.Name] = key.Id
+		i.created("key", key.Name)
+		return nil
+	}
+
+	i.keyIds[k.Name] = existing.Id
+	if i.conflict == ConflictSkip {
+		i.skipped("key", k.Name)
+		return nil
+	}
+	existing.Password = k.Password
+	if err := i.store.KeyUpdate(existing); err != nil {
+		return err
+	}
+	i.keyFiles[existing.Name] = k.Content
+	i.updated("key", k.Name)
+	return nil
+}
+
+func (i *importer) project(p *Project) error {
+	project := &structures.Project{
+		Name:                 p.Name,
+		Description:          p.Description,
+		SourceType:           p.SourceType,
+		SourcePath:           p.SourcePath,
+		RepositoryUrl:        p.RepositoryUrl,
+		RepositoryLogin:      p.RepositoryLogin,
+		RepositoryPassword:   p.RepositoryPassword,
+		RepositoryBranch:     p.RepositoryBranch,
+		RevisionType:         p.RevisionType,
+		Revision:             p.Revision,
+		RepositoryHostKeys:   p.RepositoryHostKeys,
+		RepositorySubmodules: p.RepositorySubmodules,
+		RepositoryLfs:        p.RepositoryLfs,
+		Inventory:            p.Inventory,
+		Inventories:          p.Inventories,
+		InventoryDefault:     p.InventoryDefault,
+		InventoryScripts:     p.InventoryScripts,
+		InventoryPlugins:     p.InventoryPlugins,
+		InventoryEnv:         p.InventoryEnv,
+		InventoryProtected:   p.InventoryProtected,
+		Collections:          p.Collections,
+		Variables:            p.Variables,
+		VariablesAvailable:   p.VariablesAvailable,
+		VariablesMain:        p.VariablesMain,
+		VariablesVault:       p.VariablesVault,
+		VariablesMainFile:    p.VariablesMainFile,
+		VariablesVaultFile:   p.VariablesVaultFile,
+		VaultPassword:        p.VaultPassword,
+		UpdateSchedule:       p.UpdateSchedule,
+		UpdatePolicy:         p.UpdatePolicy,
+	}
+	if len(p.RepositoryKey) != 0 {
+		keyId, ok := i.keyIds[p.RepositoryKey]
+		if !ok {
+			return fmt.Errorf("key %s not found in bundle", p.RepositoryKey)
+		}
+		project.RepositoryKeyId = keyId
+	}
+
+	existing, err := i.projectByName(p.Name)
+	if err != nil {
+		return err
+	}
+	if existing == nil || i.conflict == ConflictRename {
+		if existing != nil {
+			project.Name = freeName(p.Name, i.store.ProjectExistsByName)
+		}
+		if err := i.store.ProjectInsert(project); err != nil {
+			return err
+		}
+		i.created("project", project.Name)
+		if project.SourceType == structures.ProjectSourceArchive {
+			i.skipped("archives", project.Name+": uploaded archives are not included in bundle, upload archive again")
+		}
+		if err := i.access(project.Id, p.Access); err != nil {
+			return err
+		}
+		return i.history(project, p.Playbooks)
+	}
+
+	if i.conflict == ConflictSkip {
+		i.skipped("project", p.Name)
+		return nil
+	}
+	project.Id = existing.Id
+	if err := i.store.ProjectUpdate(project); err != nil {
+		return err
+	}
+	i.updated("project", p.Name)
+	return i.access(project.Id, p.Access)
+}
+
+// access Grants project access to bundle users, existing grants are kept
+func (i *importer) access(projectId string, logins []string) error {
+	for _, login := range logins {
+		userId, ok := i.userIds[login]
+		if !ok || i.store.ProjectUserAccessExists(projectId, userId) {
+			continue
+		}
+		if err := i.store.ProjectUserAccessCreate(projectId, userId); err != nil {
+			return fmt.Errorf("unable to grant access to %s: %w", login, err)
+		}
+	}
+	return nil
+}
+
+// history Creates playbooks with runs, playbooks are matched by file name on the next project update
+func (i *importer) history(project *structures.Project, playbooks []*Playbook) error {
+	for _, p := range playbooks {
+		playbook := &structures.Playbook{
+			ProjectId:   project.Id,
+			Filename:    p.Filename,
+			Name:        p.Name,
+			Description: p.Description,
+			Category:    p.Category,
+			Tags:        p.Tags,
+			Dangerous:   p.Dangerous,
+			Survey:      p.Survey,
+		}
+		if err := i.store.PlaybookInsert(playbook); err != nil {
+			return fmt.Errorf("unable to import playbook %s: %w", p.Filename, err)
+		}
+
+		skipped := 0
+		for _, r := range p.Runs {
+			userId, ok := i.userIds[r.User]
+			if !ok {
+				skipped++
+				continue
+			}
+			run := &structures.PlaybookRun{
+				PlaybookId:    playbook.Id,
+				UserId:        userId,
+				Mode:          r.Mode,
+				StartTime:     r.StartTime,
+				FinishTime:    r.FinishTime,
+				Result:        r.Result,
+				InventoryFile: r.InventoryFile,
+				VariablesFile: r.VariablesFile,
+				ExtraVars:     r.ExtraVars,
+				Hosts:         r.Hosts,
+			}
+			if err := i.store.PlaybookRunInsert(run); err != nil {
+				return fmt.Errorf("unable to import playbook %s run: %w", p.Filename, err)
+			}
+			result := &structures.RunResult{
+				Id:     run.Id,
+				RunId:  run.Id,
+				Output: r.Output,
+				Error:  r.Error,
+			}
+			if err := i.store.RunResultInsert(result); err != nil {
+				return fmt.Errorf("unable to import playbook %s run result: %w", p.Filename, err)
+			}
+		}
+		if skipped != 0 {
+			i.skipped("runs", fmt.Sprintf("%s/%s: %d runs of unknown users", project.Name, p.Filename, skipped))
+		}
+	}
+	return nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func (i *importer) keyByName(name string) (*structures.Key, error) {
+	keys, err := i.store.KeyGetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.Name == name {
+			return key, nil
+		}
+	}
+	return nil, nil
+}
+
+func (i *importer) keyExists(name string) bool {
+	key, err := i.keyByName(name)
+	return err != nil || key != nil
+}
+
+func (i *importer) projectByName(name string) (*structures.Project, error) {
+	projects, err := i.store.ProjectGetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, project := range projects {
+		if project.Name == name {
+			return project, nil
+		}
+	}
+	return nil, nil
+}
+
+func (i *importer) created(entity, name string) {
+	i.report.Created = append(i.report.Created, entity+" "+name)
+}
+
+func (i *importer) updated(entity, name string) {
+	i.report.Updated = append(i.report.Updated, entity+" "+name)
+}
+
+func (i *importer) skipped(entity, name string) {
+	i.report.Skipped = append(i.report.Skipped, entity+" "+name)
+}
+
+// freeName Name with import suffix and number which is not used yet
+func freeName(name string, exists func(string) bool) string {
+	candidate := name + renameSuffix
+	for n := 2; exists(candidate); n++ {
+		candidate = fmt.Sprintf("%s%s-%d", name, renameSuffix, n)
+	}
+	return candidate
+}
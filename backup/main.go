@@ -0,0 +1,145 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	BundleFormat  = "ensemble-bundle"
+	BundleVersion = 2
+
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictRename    = "rename"
+
+	renameSuffix = "-imported"
+)
+
+// Bundle Portable export of instance configuration, secrets are encrypted with key derived from bundle passphrase
+// instead of database secret. Check is encrypted format name to tell wrong passphrase from damaged bundle
+type Bundle struct {
+	Format   string     `json:"format"`
+	Version  int        `json:"version"`
+	Created  time.Time  `json:"created"`
+	Kdf      *Kdf       `json:"kdf"`
+	Check    string     `json:"check"`
+	Users    []*User    `json:"users"`
+	Keys     []*Key     `json:"keys"`
+	Projects []*Project `json:"projects"`
+}
+
+// User Login with password hash, hash is portable between instances
+type User struct {
+	Login        string `json:"login"`
+	PasswordHash string `json:"password_hash"`
+	Role         int    `json:"role"`
+}
+
+// Key Private key with encrypted passphrase and file content
+type Key struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Content  string `json:"content"`
+}
+
+// Project Project settings with encrypted credentials, key and users are referenced by name
+type Project struct {
+	Name                 string      `json:"name"`
+	Description          string      `json:"description"`
+	SourceType           int         `json:"source_type"`
+	SourcePath           string      `json:"source_path"`
+	RepositoryUrl        string      `json:"repo_url"`
+	RepositoryLogin      string      `json:"repo_login"`
+	RepositoryPassword   string      `json:"repo_password"`
+	RepositoryBranch     string      `json:"repo_branch"`
+	RevisionType         int         `json:"repo_revision_type"`
+	Revision             string      `json:"repo_revision"`
+	RepositoryKey        string      `json:"repo_key"`
+	RepositoryHostKeys   string      `json:"repo_host_keys"`
+	RepositorySubmodules bool        `json:"repo_submodules"`
+	RepositoryLfs        bool        `json:"repo_lfs"`
+	Inventory            string      `json:"inventory"`
+	Inventories          string      `json:"inventory_list"`
+	InventoryDefault     string      `json:"inventory_default"`
+	InventoryScripts     string      `json:"inventory_script_list"`
+	InventoryPlugins     string      `json:"inventory_plugin_list"`
+	InventoryEnv         string      `json:"inventory_env"`
+	InventoryProtected   string      `json:"inventory_protected_list"`
+	Collections          string      `json:"collections_list"`
+	Variables            string      `json:"variables"`
+	VariablesAvailable   string      `json:"variables_list"`
+	VariablesMain        bool        `json:"variables_main"`
+	VariablesVault       bool        `json:"variables_vault"`
+	VariablesMainFile    string      `json:"variables_main_file"`
+	VariablesVaultFile   string      `json:"variables_vault_file"`
+	VaultPassword        string      `json:"vault_password"`
+	UpdateSchedule       string      `json:"update_schedule"`
+	UpdatePolicy         int         `json:"update_policy"`
+	Access               []string    `json:"access"`
+	Playbooks            []*Playbook `json:"playbooks,omitempty"`
+}
+
+// Playbook Playbook with run history, exported only when history is requested
+type Playbook struct {
+	Filename    string `json:"filename"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	Tags        string `json:"tags"`
+	Dangerous   bool   `json:"dangerous"`
+	Survey      string `json:"survey"`
+	Runs        []*Run `json:"runs"`
+}
+
+type Run struct {
+	User          string    `json:"user"`
+	Mode          int       `json:"mode"`
+	StartTime     time.Time `json:"start_time"`
+	FinishTime    time.Time `json:"finish_time"`
+	Result        int       `json:"result"`
+	InventoryFile string    `json:"inventory_file"`
+	VariablesFile string    `json:"variables_file"`
+	ExtraVars     string    `json:"extra_vars"`
+	Hosts         string    `json:"hosts"`
+	Output        string    `json:"output"`
+	Error         string    `json:"error"`
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func Write(w io.Writer, bundle *Bundle) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(bundle)
+}
+
+// Read Reads bundle and checks format and version
+func Read(r io.Reader) (*Bundle, error) {
+	var bundle Bundle
+	if err := json.NewDecoder(r).Decode(&bundle); err != nil {
+		return nil, fmt.Errorf("unable to decode bundle: %w", err)
+	}
+	if bundle.Format != BundleFormat {
+		return nil, fmt.Errorf("unknown bundle format %q", bundle.Format)
+	}
+	//version 1 bundles were encrypted without key derivation, they should be exported again
+	if bundle.Version != BundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", bundle.Version)
+	}
+	if err := bundle.Kdf.validate(); err != nil {
+		return nil, err
+	}
+	return &bundle, nil
+}
+
+func validConflict(conflict string) error {
+	switch conflict {
+	case ConflictSkip, ConflictOverwrite, ConflictRename:
+		return nil
+	}
+	return errors.New("conflict should be skip, overwrite or rename")
+}
@@ -0,0 +1,220 @@
+package backup
+
+import (
+	"bytes"
+	"ensemble/privatekeys"
+	"ensemble/secrets"
+	"ensemble/storage"
+	"ensemble/storage/structures"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newInstance(t *testing.T, secret string) (storage.Store, *privatekeys.KeyManager) {
+	directory := t.TempDir()
+	s, err := storage.New(storage.Configuration{
+		Url:    "sqlite://" + filepath.Join(directory, "ensemble.db"),
+		Secret: secret,
+	})
+	if err != nil {
+		t.Fatalf("unable to create storage: %s", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	km, err := privatekeys.NewKeyManager(privatekeys.Configuration{Path: filepath.Join(directory, "keys")}, secrets.NewResolver(secrets.Configuration{}))
+	if err != nil {
+		t.Fatalf("unable to create key manager: %s", err)
+	}
+	return s, km
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	source, sourceKeys := newInstance(t, "staging")
+
+	user := &structures.User{Login: "operator", Password: "hash", Role: structures.UserRoleOperator}
+	if err := source.UserInsert(user); err != nil {
+		t.Fatal(err)
+	}
+	key := &structures.Key{Name: "deploy", Password: "passphrase"}
+	if err := sourceKeys.SaveKeyFile(key.Name, "private key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.KeyInsert(key); err != nil {
+		t.Fatal(err)
+	}
+	project := &structures.Project{
+		Name:               "web",
+		RepositoryUrl:      "git@example.com:web.git",
+		RepositoryKeyId:    key.Id,
+		RepositoryPassword: "repository password",
+		VaultPassword:      "vault password",
+		UpdateSchedule:     "0 5 * * *",
+	}
+	if err := source.ProjectInsert(project); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.ProjectUserAccessCreate(project.Id, user.Id); err != nil {
+		t.Fatal(err)
+	}
+	playbook := &structures.Playbook{ProjectId: project.Id, Filename: "site.yml"}
+	if err := source.PlaybookInsert(playbook); err != nil {
+		t.Fatal(err)
+	}
+	run := &structures.PlaybookRun{PlaybookId: playbook.Id, UserId: user.Id, StartTime: time.Now(), Result: 1}
+	if err := source.PlaybookRunInsert(run); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.RunResultInsert(&structures.RunResult{Id: run.Id, RunId: run.Id, Output: "ok"}); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle, err := Export(source, sourceKeys, ExportOptions{Passphrase: "bundle", History: true})
+	if err != nil {
+		t.Fatalf("unable to export: %s", err)
+	}
+	var buffer bytes.Buffer
+	if err := Write(&buffer, bundle); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buffer.String(), "vault password") || strings.Contains(buffer.String(), "private key") {
+		t.Fatal("bundle contains plaintext secrets")
+	}
+
+	target, targetKeys := newInstance(t, "production")
+	if _, err := Import(target, targetKeys, mustRead(t, buffer.String()), ImportOptions{Passphrase: "wrong", Conflict: ConflictSkip}); err == nil {
+		t.Fatal("import with wrong passphrase succeeded")
+	}
+	report, err := Import(target, targetKeys, mustRead(t, buffer.String()), ImportOptions{Passphrase: "bundle", Conflict: ConflictSkip})
+	if err != nil {
+		t.Fatalf("unable to import: %s", err)
+	}
+	if len(report.Created) != 3 {
+		t.Fatalf("unexpected import report: %+v", report)
+	}
+
+	imported, err := target.UserGetByLogin("operator")
+	if err != nil || imported.Password != "hash" {
+		t.Fatalf("user not imported: %+v %v", imported, err)
+	}
+	projects, err := target.ProjectGetAll()
+	if err != nil || len(projects) != 1 {
+		t.Fatalf("project not imported: %v", err)
+	}
+	importedProject := projects[0]
+	if importedProject.VaultPassword != "vault password" || importedProject.UpdateSchedule != "0 5 * * *" {
+		t.Fatalf("project settings not imported: %+v", importedProject)
+	}
+	importedKey, err := target.KeyGet(importedProject.RepositoryKeyId)
+	if err != nil || importedKey.Password != "passphrase" {
+		t.Fatalf("project key not imported: %+v %v", importedKey, err)
+	}
+	if content, err := targetKeys.ReadKeyFile("deploy"); err != nil || content != "private key" {
+		t.Fatalf("key file not imported: %q %v", content, err)
+	}
+	if !target.ProjectUserAccessExists(importedProject.Id, imported.Id) {
+		t.Fatal("project access not imported")
+	}
+	playbooks, err := target.PlaybookGetByProject(importedProject.Id)
+	if err != nil || len(playbooks) != 1 {
+		t.Fatalf("playbooks not imported: %v", err)
+	}
+	runs, err := target.PlaybookRunGetByPlaybook(playbooks[0].Id)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("runs not imported: %v", err)
+	}
+
+	report, err = Import(target, targetKeys, mustRead(t, buffer.String()), ImportOptions{Passphrase: "bundle", Conflict: ConflictRename})
+	if err != nil {
+		t.Fatalf("unable to import renamed: %s", err)
+	}
+	if !target.UserExistsByLogin("operator-imported") || !target.ProjectExistsByName("web-imported") {
+		t.Fatalf("entities not renamed: %+v", report)
+	}
+}
+
+func mustRead(t *testing.T, text string) *Bundle {
+	bundle, err := Read(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("unable to read bundle: %s", err)
+	}
+	return bundle
+}
+
+func TestImportRollsBackOnFailure(t *testing.T) {
+	source, sourceKeys := newInstance(t, "")
+	if err := source.UserInsert(&structures.User{Login: "operator", Password: "hash", Role: structures.UserRoleOperator}); err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := Export(source, sourceKeys, ExportOptions{Passphrase: "bundle"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundle.Kdf == nil || bundle.Kdf.Name != KdfArgon2id || len(bundle.Kdf.Salt) == 0 {
+		t.Fatalf("bundle key derivation not recorded: %+v", bundle.Kdf)
+	}
+	bundle.Projects = append(bundle.Projects, &Project{Name: "broken", RepositoryKey: "missing"})
+
+	target, targetKeys := newInstance(t, "")
+	if _, err := Import(target, targetKeys, bundle, ImportOptions{Passphrase: "bundle", Conflict: ConflictSkip}); err == nil {
+		t.Fatal("import of project with missing key succeeded")
+	}
+	if target.UserExistsByLogin("operator") {
+		t.Fatal("user imported before failure was not rolled back")
+	}
+}
+
+func TestImportKeyFileFailureRollsBack(t *testing.T) {
+	source, sourceKeys := newInstance(t, "")
+	key := &structures.Key{Name: "deploy"}
+	if err := sourceKeys.SaveKeyFile(key.Name, "private key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.KeyInsert(key); err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := Export(source, sourceKeys, ExportOptions{Passphrase: "bundle"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//key files directory is gone, so key file can not be written
+	keysPath := filepath.Join(t.TempDir(), "keys")
+	target, _ := newInstance(t, "")
+	targetKeys, err := privatekeys.NewKeyManager(privatekeys.Configuration{Path: keysPath}, secrets.NewResolver(secrets.Configuration{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(keysPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Import(target, targetKeys, bundle, ImportOptions{Passphrase: "bundle", Conflict: ConflictSkip}); err == nil {
+		t.Fatal("import without key file succeeded")
+	}
+	if keys, err := target.KeyGetAll(); err != nil || len(keys) != 0 {
+		t.Fatalf("key imported without its file: %d %v", len(keys), err)
+	}
+
+	//staged files are moved in place only after commit, import decrypts bundle in place
+	if err := os.Mkdir(keysPath, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if bundle, err = Export(source, sourceKeys, ExportOptions{Passphrase: "bundle"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Import(target, targetKeys, bundle, ImportOptions{Passphrase: "bundle", Conflict: ConflictSkip}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(keysPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "deploy" {
+		t.Fatalf("unexpected key files: %v", entries)
+	}
+	if content, err := targetKeys.ReadKeyFile("deploy"); err != nil || content != "private key" {
+		t.Fatalf("unexpected key file %q: %v", content, err)
+	}
+}
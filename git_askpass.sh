@@ -0,0 +1,5 @@
+#!/bin/bash
+case "$1" in
+    Username*) echo "$ENSEMBLE_GIT_USERNAME" ;;
+    *) echo "$ENSEMBLE_GIT_PASSWORD" ;;
+esac
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"ensemble/backup"
 	"ensemble/privatekeys"
 	"ensemble/repository"
 	"ensemble/runner"
+	"ensemble/scheduler"
+	"ensemble/secrets"
 	"ensemble/storage"
 	"ensemble/web"
-	"github.com/go-co-op/gocron"
+	"flag"
+	"fmt"
 	_ "github.com/joho/godotenv/autoload"
 	log "github.com/sirupsen/logrus"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,7 +26,8 @@ var (
 	repositoryConfig repository.Configuration
 	runnerConfig     runner.Configuration
 	keyManagerConfig privatekeys.Configuration
-	cronUpdate       string
+	schedulerConfig  scheduler.Configuration
+	secretsConfig    secrets.Configuration
 )
 
 func init() {
@@ -29,9 +37,14 @@ func init() {
 	log.SetOutput(os.Stdout)
 	log.SetLevel(log.InfoLevel)
 
+	trustedProxies, err := parseTrustedProxies(getEnvOrDefault("ENSEMBLE_WEB_TRUSTED_PROXIES", ""))
+	if err != nil {
+		log.Fatalf("ENSEMBLE_WEB_TRUSTED_PROXIES should be a list of IP addresses or networks: %s", err)
+	}
 	webConfig = web.Configuration{
 		DebugTemplates: getEnvOrDefault("ENSEMBLE_WEB_DEBUG_TEMPLATES", "0") != "0",
 		Listen:         getEnvOrDefault("ENSEMBLE_WEB_LISTEN", ":3000"),
+		TrustedProxies: trustedProxies,
 	}
 
 	storageConfig = storage.Configuration{
@@ -42,6 +55,20 @@ func init() {
 		log.Fatalf("ENSEMBLE_DB_URL required")
 	}
 
+	vaultKvVersion, err := strconv.Atoi(getEnvOrDefault("ENSEMBLE_VAULT_KV_VERSION", "2"))
+	if err != nil || (vaultKvVersion != 1 && vaultKvVersion != 2) {
+		log.Fatalf("ENSEMBLE_VAULT_KV_VERSION should be 1 or 2")
+	}
+	secretsConfig = secrets.Configuration{
+		EnvPrefix:      getEnvOrDefault("ENSEMBLE_SECRETS_ENV_PREFIX", "ENSEMBLE_SECRET_"),
+		FilePath:       getEnvOrDefault("ENSEMBLE_SECRETS_PATH", ""),
+		VaultAddress:   getEnvOrDefault("ENSEMBLE_VAULT_ADDR", ""),
+		VaultToken:     getEnvOrDefault("ENSEMBLE_VAULT_TOKEN", ""),
+		VaultNamespace: getEnvOrDefault("ENSEMBLE_VAULT_NAMESPACE", ""),
+		VaultMount:     getEnvOrDefault("ENSEMBLE_VAULT_MOUNT", "secret"),
+		VaultKvVersion: vaultKvVersion,
+	}
+
 	keyManagerConfig = privatekeys.Configuration{
 		Path:         getEnvOrDefault("ENSEMBLE_KEYS_PATH", ""),
 		AddKeyScript: getEnvOrDefault("ENSEMBLE_KEYS_SCRIPT", "./ssh_add_key.sh"),
@@ -51,15 +78,40 @@ func init() {
 		log.Fatalf("ENSEMBLE_KEYS_PATH required")
 	}
 
-	cronUpdate = getEnvOrDefault("ENSEMBLE_CRON", "0 3 * * *")
+	cronSpread, err := time.ParseDuration(getEnvOrDefault("ENSEMBLE_CRON_SPREAD", "30m"))
+	if err != nil {
+		log.Fatalf("ENSEMBLE_CRON_SPREAD should be a duration: %s", err)
+	}
+	schedulerConfig = scheduler.Configuration{
+		DefaultSchedule: getEnvOrDefault("ENSEMBLE_CRON", "0 3 * * *"),
+		Spread:          cronSpread,
+		CleanupSchedule: getEnvOrDefault("ENSEMBLE_CLEANUP_CRON", "0 4 * * *"),
+	}
 
 	path := os.Getenv("ENSEMBLE_PATH")
 	if len(path) == 0 {
 		log.Fatalf("ENSEMBLE_PATH required")
 	}
 
+	gitTimeout, err := time.ParseDuration(getEnvOrDefault("ENSEMBLE_GIT_TIMEOUT", "10m"))
+	if err != nil {
+		log.Fatalf("ENSEMBLE_GIT_TIMEOUT should be a duration: %s", err)
+	}
+	cloneDepth, err := strconv.Atoi(getEnvOrDefault("ENSEMBLE_GIT_CLONE_DEPTH", "0"))
+	if err != nil || cloneDepth < 0 {
+		log.Fatalf("ENSEMBLE_GIT_CLONE_DEPTH should be a non-negative number")
+	}
+	lockedWait, err := time.ParseDuration(getEnvOrDefault("ENSEMBLE_UPDATE_WAIT_TIMEOUT", "1h"))
+	if err != nil || lockedWait <= 0 {
+		log.Fatalf("ENSEMBLE_UPDATE_WAIT_TIMEOUT should be a positive duration")
+	}
 	repositoryConfig = repository.Configuration{
-		Path: path,
+		Path:              path,
+		AskPassScript:     getEnvOrDefault("ENSEMBLE_GIT_ASKPASS_SCRIPT", "./git_askpass.sh"),
+		CommandTimeout:    gitTimeout,
+		CloneDepth:        cloneDepth,
+		LocalRoot:         getEnvOrDefault("ENSEMBLE_LOCAL_ROOT", ""),
+		LockedWaitTimeout: lockedWait,
 	}
 	runnerConfig = runner.Configuration{
 		Path:     path,
@@ -68,6 +120,20 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "rotate-secret":
+			rotateSecret()
+			return
+		case "export-bundle":
+			exportBundle(os.Args[2:])
+			return
+		case "import-bundle":
+			importBundle(os.Args[2:])
+			return
+		}
+	}
+
 	s, err := storage.New(storageConfig)
 	if err != nil {
 		log.Fatalf("unable to create storage: %s", err)
@@ -78,35 +144,35 @@ func main() {
 		log.Fatalf("unable to create admin: %s", err)
 	}
 
-	m := repository.New(repositoryConfig, s)
-	scheduleProjectsUpdate(m)
+	sr := secrets.NewResolver(secretsConfig)
 
-	r := runner.New(runnerConfig, s)
-
-	km, err := privatekeys.NewKeyManager(keyManagerConfig)
+	km, err := privatekeys.NewKeyManager(keyManagerConfig, sr)
 	if err != nil {
 		log.Fatalf("unable to create key manager: %s", err)
 	}
 	addPrivateKeys(s, km)
 
-	server := web.New(webConfig, s, m, r, km)
-	log.Fatal(server.Start(webConfig.Listen))
-}
+	r := runner.New(runnerConfig, s, sr)
+	go r.ParseStoredResults()
 
-///////////////////////////////////////////////////////////////////////////////
+	m := repository.New(repositoryConfig, s, km, r, sr)
+	m.RemoveStoredCredentials()
 
-func scheduleProjectsUpdate(m *repository.Manager) {
-	scheduler := gocron.NewScheduler(time.Now().Location())
-	_, err := scheduler.Cron(cronUpdate).Do(func() {
-		m.UpdateAll()
-	})
+	sch, err := scheduler.New(schedulerConfig, s, m)
 	if err != nil {
-		log.Fatalf("unable to start projecs update schedule: %s", err)
+		log.Fatalf("unable to create scheduler: %s", err)
+	}
+	if err := sch.Start(); err != nil {
+		log.Fatalf("unable to start projects update schedule: %s", err)
 	}
-	scheduler.StartAsync()
+
+	server := web.New(webConfig, s, m, r, km, sch, sr)
+	log.Fatal(server.Start(webConfig.Listen))
 }
 
-func addPrivateKeys(s *storage.Storage, km *privatekeys.KeyManager) {
+///////////////////////////////////////////////////////////////////////////////
+
+func addPrivateKeys(s storage.Store, km *privatekeys.KeyManager) {
 	log.Infof("add all private keys...")
 
 	keys, err := s.KeyGetAll()
@@ -121,6 +187,152 @@ func addPrivateKeys(s *storage.Storage, km *privatekeys.KeyManager) {
 	}
 }
 
+// rotateSecret Re-encrypts stored secrets from ENSEMBLE_DB_SECRET to ENSEMBLE_DB_SECRET_NEW
+func rotateSecret() {
+	newSecret := os.Getenv("ENSEMBLE_DB_SECRET_NEW")
+	if len(newSecret) == 0 {
+		log.Fatalf("ENSEMBLE_DB_SECRET_NEW required")
+	}
+
+	s, err := storage.New(storageConfig)
+	if err != nil {
+		log.Fatalf("unable to create storage: %s", err)
+	}
+	defer s.Close()
+
+	count, err := s.SecretRotate(newSecret)
+	if err != nil {
+		log.Fatalf("unable to rotate secret: %s", err)
+	}
+
+	log.Infof("secret rotated, %d values re-encrypted, set ENSEMBLE_DB_SECRET to the new secret", count)
+}
+
+// exportBundle Writes users, keys, projects and optionally run history to bundle encrypted with ENSEMBLE_BUNDLE_PASSPHRASE
+func exportBundle(args []string) {
+	flags := flag.NewFlagSet("export-bundle", flag.ExitOnError)
+	output := flags.String("output", "", "bundle file")
+	history := flags.Bool("history", false, "include playbook run history")
+	_ = flags.Parse(args)
+	if len(*output) == 0 {
+		log.Fatalf("bundle file required")
+	}
+
+	s, err := storage.New(storageConfig)
+	if err != nil {
+		log.Fatalf("unable to create storage: %s", err)
+	}
+	defer s.Close()
+
+	km, err := privatekeys.NewKeyManager(keyManagerConfig, secrets.NewResolver(secretsConfig))
+	if err != nil {
+		log.Fatalf("unable to create key manager: %s", err)
+	}
+
+	bundle, err := backup.Export(s, km, backup.ExportOptions{
+		Passphrase: os.Getenv("ENSEMBLE_BUNDLE_PASSPHRASE"),
+		History:    *history,
+	})
+	if err != nil {
+		log.Fatalf("unable to export bundle: %s", err)
+	}
+
+	file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		log.Fatalf("unable to create bundle file: %s", err)
+	}
+	defer file.Close()
+	if err := backup.Write(file, bundle); err != nil {
+		log.Fatalf("unable to write bundle: %s", err)
+	}
+
+	log.Infof("bundle exported, %d users, %d keys, %d projects", len(bundle.Users), len(bundle.Keys), len(bundle.Projects))
+}
+
+// importBundle Creates entities from bundle file, bundle is decrypted with ENSEMBLE_BUNDLE_PASSPHRASE
+func importBundle(args []string) {
+	flags := flag.NewFlagSet("import-bundle", flag.ExitOnError)
+	input := flags.String("input", "", "bundle file")
+	conflict := flags.String("conflict", backup.ConflictSkip, "existing names handling: skip, overwrite or rename")
+	_ = flags.Parse(args)
+	if len(*input) == 0 {
+		log.Fatalf("bundle file required")
+	}
+
+	file, err := os.Open(*input)
+	if err != nil {
+		log.Fatalf("unable to open bundle file: %s", err)
+	}
+	defer file.Close()
+
+	bundle, err := backup.Read(file)
+	if err != nil {
+		log.Fatalf("unable to read bundle: %s", err)
+	}
+
+	s, err := storage.New(storageConfig)
+	if err != nil {
+		log.Fatalf("unable to create storage: %s", err)
+	}
+	defer s.Close()
+
+	km, err := privatekeys.NewKeyManager(keyManagerConfig, secrets.NewResolver(secretsConfig))
+	if err != nil {
+		log.Fatalf("unable to create key manager: %s", err)
+	}
+
+	report, err := backup.Import(s, km, bundle, backup.ImportOptions{
+		Passphrase: os.Getenv("ENSEMBLE_BUNDLE_PASSPHRASE"),
+		Conflict:   *conflict,
+	})
+	if report != nil {
+		for _, name := range report.Created {
+			log.Infof("created %s", name)
+		}
+		for _, name := range report.Updated {
+			log.Infof("updated %s", name)
+		}
+		for _, name := range report.Skipped {
+			log.Infof("skipped %s", name)
+		}
+	}
+	if err != nil {
+		log.Fatalf("unable to import bundle: %s", err)
+	}
+
+	log.Infof("bundle imported, update projects to fetch their content")
+}
+
+// parseTrustedProxies Comma separated IP addresses and CIDR networks
+func parseTrustedProxies(value string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", item)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
 func getEnvOrDefault(key, def string) string {
 	value := os.Getenv(key)
 	if len(value) == 0 {
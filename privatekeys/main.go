@@ -1,6 +1,7 @@
 package privatekeys
 
 import (
+	"ensemble/secrets"
 	"ensemble/storage/structures"
 	"errors"
 	"fmt"
@@ -8,7 +9,9 @@ import (
 	log "github.com/sirupsen/logrus"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 type Configuration struct {
@@ -18,12 +21,20 @@ type Configuration struct {
 }
 
 type KeyManager struct {
-	config Configuration
+	config  Configuration
+	secrets *secrets.Resolver
+}
+
+// Agent Temporary ssh-agent holding a single key
+type Agent struct {
+	Sock      string
+	cmd       *exec.Cmd
+	directory string
 }
 
 ///////////////////////////////////////////////////////////////////////////////
 
-func NewKeyManager(config Configuration) (*KeyManager, error) {
+func NewKeyManager(config Configuration, secrets *secrets.Resolver) (*KeyManager, error) {
 	ok, err := directoryExists(config.Path)
 	if err != nil {
 		return nil, err
@@ -34,7 +45,8 @@ func NewKeyManager(config Configuration) (*KeyManager, error) {
 		}
 	}
 	return &KeyManager{
-		config: config,
+		config:  config,
+		secrets: secrets,
 	}, nil
 }
 
@@ -61,6 +73,40 @@ func (k *KeyManager) SaveKeyFile(name, content string) error {
 	return nil
 }
 
+// StageKeyFile Writes key file content to temporary file next to key files, returns its path for CommitKeyFile
+func (k *KeyManager) StageKeyFile(content string) (string, error) {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	file, err := os.CreateTemp(k.config.Path, ".staged-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = file.WriteString(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if err := os.Remove(file.Name()); err != nil {
+			log.Warnf("staged key file remove error: %s", err)
+		}
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// CommitKeyFile Moves staged file in place of key file, existing key file is replaced
+func (k *KeyManager) CommitKeyFile(staged, name string) error {
+	return os.Rename(staged, k.keyPath(name))
+}
+
+// ReadKeyFile Private key file content
+func (k *KeyManager) ReadKeyFile(name string) (string, error) {
+	content, err := os.ReadFile(k.keyPath(name))
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
 func (k *KeyManager) DeleteKeyFile(name string) error {
 	if err := os.Remove(k.keyPath(name)); err != nil {
 		return err
@@ -69,7 +115,64 @@ func (k *KeyManager) DeleteKeyFile(name string) error {
 }
 
 func (k *KeyManager) AddKey(key *structures.Key) error {
-	command := fmt.Sprintf("ssh-add %s <<< %s", shellescape.Quote(k.keyPath(key.Name)), shellescape.Quote(key.Password))
+	sock := k.config.AuthSock
+	if len(sock) == 0 {
+		sock = os.Getenv("SSH_AUTH_SOCK")
+	}
+	return k.addKey(key, sock)
+}
+
+// StartAgent Starts separate ssh-agent with a single key, agent should be stopped after use
+func (k *KeyManager) StartAgent(key *structures.Key) (*Agent, error) {
+	directory, err := os.MkdirTemp("", "ensemble-agent-")
+	if err != nil {
+		return nil, err
+	}
+
+	agent := &Agent{
+		Sock:      filepath.Join(directory, "agent.sock"),
+		directory: directory,
+	}
+	agent.cmd = exec.Command("ssh-agent", "-D", "-a", agent.Sock)
+	if err := agent.cmd.Start(); err != nil {
+		agent.Stop()
+		return nil, err
+	}
+
+	started := false
+	for i := 0; i < 50; i++ {
+		if _, err := os.Stat(agent.Sock); err == nil {
+			started = true
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !started {
+		agent.Stop()
+		return nil, errors.New("ssh-agent socket not found")
+	}
+
+	if err := k.addKey(key, agent.Sock); err != nil {
+		agent.Stop()
+		return nil, err
+	}
+
+	return agent, nil
+}
+
+// KeyPath Path to private key file
+func (k *KeyManager) KeyPath(key *structures.Key) string {
+	return k.keyPath(key.Name)
+}
+
+func (k *KeyManager) addKey(key *structures.Key, sock string) error {
+	//passphrase reference is resolved only when key is added to agent
+	password, err := k.secrets.ResolveBackground(key.Password)
+	if err != nil {
+		return fmt.Errorf("key %s passphrase: %w", key.Name, err)
+	}
+
+	command := fmt.Sprintf("ssh-add %s <<< %s", shellescape.Quote(k.keyPath(key.Name)), shellescape.Quote(password))
 	cmd := exec.Command("/bin/bash", "-c", command)
 
 	cmd.Env = append(cmd.Env, "DISPLAY=\":0\"")
@@ -78,11 +181,8 @@ func (k *KeyManager) AddKey(key *structures.Key) error {
 		sshAskPass := fmt.Sprintf("SSH_ASKPASS=%s", shellescape.Quote(k.config.AddKeyScript))
 		cmd.Env = append(cmd.Env, sshAskPass)
 	}
-	if len(k.config.AuthSock) != 0 {
-		authSock := fmt.Sprintf("SSH_AUTH_SOCK=%s", shellescape.Quote(k.config.AuthSock))
-		cmd.Env = append(cmd.Env, authSock)
-	} else if len(os.Getenv("SSH_AUTH_SOCK")) != 0 {
-		authSock := fmt.Sprintf("SSH_AUTH_SOCK=%s", shellescape.Quote(os.Getenv("SSH_AUTH_SOCK")))
+	if len(sock) != 0 {
+		authSock := fmt.Sprintf("SSH_AUTH_SOCK=%s", shellescape.Quote(sock))
 		cmd.Env = append(cmd.Env, authSock)
 	}
 
@@ -97,6 +197,21 @@ func (k *KeyManager) AddKey(key *structures.Key) error {
 
 ///////////////////////////////////////////////////////////////////////////////
 
+// Stop Terminates agent and removes its socket
+func (a *Agent) Stop() {
+	if a.cmd != nil && a.cmd.Process != nil {
+		if err := a.cmd.Process.Kill(); err != nil {
+			log.Warnf("ssh-agent kill error: %s", err)
+		}
+		_ = a.cmd.Wait()
+	}
+	if err := os.RemoveAll(a.directory); err != nil {
+		log.Warnf("ssh-agent directory remove error: %s", err)
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
 func (k *KeyManager) keyPath(name string) string {
 	return fmt.Sprintf("%s/%s", k.config.Path, name)
 }
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"ensemble/storage/structures"
+	"errors"
+	"fmt"
+	"github.com/alessio/shellescape"
+	"sort"
+	"strings"
+)
+
+const changesCommitsLimit = 500
+
+///////////////////////////////////////////////////////////////////////////////
+
+// head Current commit of project checkout, empty when repository does not exist
+func (m *Manager) head(p *structures.Project) (string, error) {
+	exists, err := m.projectRepositoryExists(p)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", nil
+	}
+	result, err := m.executeCommand("git rev-parse HEAD", m.projectDirectory(p))
+	if err != nil {
+		return "", err
+	}
+	if !result.success {
+		return "", nil
+	}
+	return strings.TrimSpace(result.output), nil
+}
+
+// revisionChanges Commits and files changed between two revisions
+func (m *Manager) revisionChanges(p *structures.Project, from, to string, changes *structures.ProjectUpdateChanges) error {
+	if len(from) == 0 || len(to) == 0 || from == to {
+		return nil
+	}
+
+	commits, err := m.commitsBetween(p, from, to)
+	if err != nil {
+		return err
+	}
+	changes.Commits = commits
+
+	commitsRemoved, err := m.commitsBetween(p, to, from)
+	if err != nil {
+		return err
+	}
+	changes.CommitsRemoved = commitsRemoved
+
+	command := fmt.Sprintf("git diff --name-status %s %s", shellescape.Quote(from), shellescape.Quote(to))
+	result, err := m.executeCommand(command, m.projectDirectory(p))
+	if err != nil {
+		return err
+	}
+	if !result.success {
+		return errors.New("unable to execute git diff")
+	}
+	for _, line := range outputLines(result.output) {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 {
+			continue
+		}
+		changes.Files = append(changes.Files, structures.ProjectUpdateFile{
+			Status: fields[0][:1],
+			Path:   strings.Join(fields[1:], " -> "),
+		})
+	}
+
+	return nil
+}
+
+func (m *Manager) commitsBetween(p *structures.Project, from, to string) ([]structures.ProjectUpdateCommit, error) {
+	revisionRange := shellescape.Quote(fmt.Sprintf("%s..%s", from, to))
+	format := shellescape.Quote("%H%x1f%an%x1f%s")
+	command := fmt.Sprintf("git log -n %d --format=%s %s", changesCommitsLimit, format, revisionRange)
+
+	result, err := m.executeCommand(command, m.projectDirectory(p))
+	if err != nil {
+		return nil, err
+	}
+	if !result.success {
+		return nil, errors.New("unable to execute git log")
+	}
+
+	var commits []structures.ProjectUpdateCommit
+	for _, line := range outputLines(result.output) {
+		fields := strings.SplitN(line, revisionsSep, 3)
+		if len(fields) != 3 {
+			continue
+		}
+		commits = append(commits, structures.ProjectUpdateCommit{
+			Hash:    fields[0],
+			Author:  fields[1],
+			Subject: fields[2],
+		})
+	}
+	return commits, nil
+}
+
+// variableFiles All variable files of project including main and vault
+func variableFiles(p *structures.Project) []string {
+	files := p.VariablesList()
+	if p.VariablesMain {
+		files = append(files, p.VariablesMainFile)
+	}
+	if p.VariablesVault {
+		files = append(files, p.VariablesVaultFile)
+	}
+	return files
+}
+
+// diffLists Elements added to and removed from list
+func diffLists(before, after []string) ([]string, []string) {
+	beforeSet := make(map[string]bool)
+	for _, s := range before {
+		beforeSet[s] = true
+	}
+	afterSet := make(map[string]bool)
+	for _, s := range after {
+		afterSet[s] = true
+	}
+
+	var added, removed []string
+	for _, s := range after {
+		if !beforeSet[s] {
+			added = append(added, s)
+		}
+	}
+	for _, s := range before {
+		if !afterSet[s] {
+			removed = append(removed, s)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+
+	return added, removed
+}
+
+func listContains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"ensemble/storage"
+	"ensemble/storage/structures"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	redactedValue = "*****"
+
+	// redactMinLength Shorter secrets are redacted only in URLs and askpass variables, replacing them
+	// everywhere would wipe matching parts of common words in update log
+	redactMinLength = 6
+)
+
+var (
+	urlCredentialsPattern     = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://[^/:@\s]+):[^/@\s]+@`)
+	askPassCredentialsPattern = regexp.MustCompile(`(ENSEMBLE_GIT_PASSWORD=)\S+`)
+)
+
+///////////////////////////////////////////////////////////////////////////////
+
+// RemoveStoredCredentials Removes credentials from remote URLs of existing checkouts and from saved update logs
+// of all projects including deleted ones. It runs once, setting marks that stored data is clean, failed
+// projects are processed again on the next start
+func (m *Manager) RemoveStoredCredentials() {
+	_, done, err := m.store.SettingGet(storage.SettingCredentialsRemoved)
+	if err != nil {
+		log.Warnf("unable to check stored credentials removal: %s", err)
+		return
+	}
+	if done {
+		return
+	}
+
+	projects, err := m.store.ProjectGetAll()
+	if err != nil {
+		log.Warnf("unable to get projects: %s", err)
+		return
+	}
+	deletedProjects, err := m.store.ProjectGetDeleted()
+	if err != nil {
+		log.Warnf("unable to get deleted projects: %s", err)
+		return
+	}
+
+	failed := 0
+	for _, project := range append(projects, deletedProjects...) {
+		if !m.removeProjectCredentials(project) {
+			failed++
+		}
+	}
+	if failed != 0 {
+		log.Warnf("credentials of %d projects were not removed, removal is repeated on the next start", failed)
+		return
+	}
+
+	if err := m.store.SettingSet(storage.SettingCredentialsRemoved, time.Now().Format(time.RFC3339)); err != nil {
+		log.Warnf("unable to save stored credentials removal: %s", err)
+	}
+}
+
+// removeProjectCredentials Resets origin of project checkout and redacts its update logs, returns false on failure
+func (m *Manager) removeProjectCredentials(project *structures.Project) bool {
+	removed := true
+
+	exists, err := m.projectRepositoryExists(project)
+	if err != nil {
+		log.Warnf("unable to check project %s repository: %s", project.Id, err)
+		removed = false
+	} else if exists {
+		originResult, err := m.origin(project)
+		if err != nil {
+			log.Warnf("unable to reset project %s origin: %s", project.Id, err)
+			removed = false
+		} else if !originResult.success {
+			log.Warnf("unable to reset project %s origin: %s", project.Id, redactCredentials(project, originResult.output))
+			removed = false
+		}
+	}
+
+	updates, err := m.store.ProjectUpdateGetByProject(project.Id)
+	if err != nil {
+		log.Warnf("unable to get project %s updates: %s", project.Id, err)
+		return false
+	}
+	for _, update := range updates {
+		updateLog := redactCredentials(project, update.Log)
+		revision := redactCredentials(project, update.Revision)
+		if updateLog == update.Log && revision == update.Revision {
+			continue
+		}
+		if err := m.store.ProjectUpdateSaveLog(update.Id, revision, updateLog); err != nil {
+			log.Warnf("unable to redact project update %s: %s", update.Id, err)
+			removed = false
+		}
+	}
+	return removed
+}
+
+// credentialsEnvironment Environment to pass repository credentials to git through GIT_ASKPASS,
+// password references are resolved here, right before git needs them. Resolved secrets are returned
+// to be redacted from output, stored password is only a reference then
+func (m *Manager) credentialsEnvironment(ctx context.Context, p *structures.Project) ([]string, []string, error) {
+	env := []string{"GIT_TERMINAL_PROMPT=0"}
+	if len(p.RepositoryLogin) == 0 {
+		return env, nil, nil
+	}
+	password, err := m.secrets.Resolve(ctx, p.RepositoryPassword)
+	if err != nil {
+		return nil, nil, fmt.Errorf("repository password: %w", err)
+	}
+	env = append(env,
+		fmt.Sprintf("GIT_ASKPASS=%s", m.config.AskPassScript),
+		fmt.Sprintf("ENSEMBLE_GIT_USERNAME=%s", p.RepositoryLogin),
+		fmt.Sprintf("ENSEMBLE_GIT_PASSWORD=%s", password),
+	)
+	return env, []string{password}, nil
+}
+
+// redactCredentials Removes project secrets, resolved secrets and any URL and askpass passwords from text,
+// secrets shorter than redactMinLength are removed only from URLs and askpass variables
+func redactCredentials(p *structures.Project, text string, resolved ...string) string {
+	for _, secret := range append([]string{p.RepositoryPassword, p.VaultPassword}, resolved...) {
+		if len(secret) < redactMinLength {
+			continue
+		}
+		text = strings.ReplaceAll(text, secret, redactedValue)
+		text = strings.ReplaceAll(text, url.QueryEscape(secret), redactedValue)
+		text = strings.ReplaceAll(text, url.PathEscape(secret), redactedValue)
+	}
+	text = askPassCredentialsPattern.ReplaceAllString(text, "${1}"+redactedValue)
+	return urlCredentialsPattern.ReplaceAllString(text, "${1}:"+redactedValue+"@")
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	inventoryStatic = iota
+	inventoryScript
+	inventoryPlugin
+)
+
+// inventoryKind Detects dynamic inventories: executable scripts and YAML inventory plugin configurations
+func inventoryKind(projectDirectory, inventory string) (int, error) {
+	if strings.HasSuffix(inventory, "/") {
+		return inventoryStatic, nil
+	}
+
+	inventoryPath := filepath.Join(projectDirectory, filepath.FromSlash(inventory))
+	stat, err := os.Stat(inventoryPath)
+	if err != nil {
+		return inventoryStatic, err
+	}
+	if stat.Mode()&0111 != 0 {
+		return inventoryScript, nil
+	}
+	if !isYamlFile(inventory) {
+		return inventoryStatic, nil
+	}
+
+	content, err := os.ReadFile(inventoryPath)
+	if err != nil {
+		return inventoryStatic, err
+	}
+	var config struct {
+		Plugin string `yaml:"plugin"`
+	}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		//static inventories may be in classic format or encrypted with ansible vault
+		return inventoryStatic, nil
+	}
+	if len(config.Plugin) != 0 {
+		return inventoryPlugin, nil
+	}
+
+	return inventoryStatic, nil
+}
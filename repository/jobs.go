@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"ensemble/storage/structures"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUpdateRunning = errors.New("project update is already running")
+
+type updateJob struct {
+	project *structures.Project
+	started time.Time
+	cancel  context.CancelFunc
+	mutex   sync.Mutex
+	output  strings.Builder
+	secrets []string
+}
+
+// UpdateStatus Progress of running project update
+type UpdateStatus struct {
+	Running bool   `json:"running"`
+	Started string `json:"started"`
+	Log     string `json:"log"`
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// UpdateAsync Starts project update in background, fails when update of the project is running already
+func (m *Manager) UpdateAsync(project *structures.Project) error {
+	lock := m.projectLock(project.Id)
+	if !lock.TryLock() {
+		return ErrUpdateRunning
+	}
+
+	go func() {
+		defer lock.Unlock()
+		if err := m.update(project); err != nil {
+			log.Warnf("unable to update project %s: %s", project.Name, err)
+		}
+	}()
+
+	return nil
+}
+
+// UpdateStatus Log of running project update
+func (m *Manager) UpdateStatus(projectId string) *UpdateStatus {
+	m.jobsMutex.Lock()
+	job, running := m.jobs[projectId]
+	m.jobsMutex.Unlock()
+
+	if !running {
+		return &UpdateStatus{}
+	}
+
+	return &UpdateStatus{
+		Running: true,
+		Started: job.started.Format(time.RFC3339),
+		Log:     redactCredentials(job.project, job.String(), job.Secrets()...),
+	}
+}
+
+// CancelUpdate Stops running project update, git commands are killed
+func (m *Manager) CancelUpdate(projectId string) error {
+	m.jobsMutex.Lock()
+	job, running := m.jobs[projectId]
+	m.jobsMutex.Unlock()
+
+	if !running {
+		return errors.New("project update is not running")
+	}
+
+	job.WriteString("> update cancelled\n")
+	job.cancel()
+
+	return nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func (m *Manager) projectLock(projectId string) *sync.Mutex {
+	m.jobsMutex.Lock()
+	defer m.jobsMutex.Unlock()
+
+	lock, ok := m.locks[projectId]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.locks[projectId] = lock
+	}
+	return lock
+}
+
+func (m *Manager) startJob(project *structures.Project) (context.Context, *updateJob) {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &updateJob{
+		project: project,
+		started: time.Now(),
+		cancel:  cancel,
+	}
+
+	m.jobsMutex.Lock()
+	m.jobs[project.Id] = job
+	m.jobsMutex.Unlock()
+
+	return ctx, job
+}
+
+func (m *Manager) finishJob(job *updateJob) {
+	job.cancel()
+
+	m.jobsMutex.Lock()
+	delete(m.jobs, job.project.Id)
+	m.jobsMutex.Unlock()
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func (j *updateJob) WriteString(s string) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.output.WriteString(s)
+}
+
+func (j *updateJob) String() string {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.output.String()
+}
+
+// AddSecrets Remembers resolved secrets to redact them from job output
+func (j *updateJob) AddSecrets(secrets ...string) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.secrets = append(j.secrets, secrets...)
+}
+
+func (j *updateJob) Secrets() []string {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return append([]string{}, j.secrets...)
+}
@@ -0,0 +1,323 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ManifestFileName Optional repository manifest describing repository layout
+const ManifestFileName = "ensemble.yml"
+
+type Layout struct {
+	Playbooks   LayoutPlaybooks   `yaml:"playbooks"`
+	Inventories LayoutInventories `yaml:"inventories"`
+	Variables   LayoutVariables   `yaml:"variables"`
+}
+
+type LayoutPlaybooks struct {
+	Directories []string `yaml:"directories"`
+	Patterns    []string `yaml:"patterns"`
+}
+
+type LayoutInventories struct {
+	Paths   []string `yaml:"paths"`
+	Default string   `yaml:"default"`
+}
+
+type LayoutVariables struct {
+	Directories []string `yaml:"directories"`
+	Main        string   `yaml:"main"`
+	Vault       string   `yaml:"vault"`
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// defaultLayout Layout of repositories without manifest
+func defaultLayout() *Layout {
+	return &Layout{
+		Playbooks: LayoutPlaybooks{
+			Directories: []string{"."},
+			Patterns:    []string{"*.yml"},
+		},
+		Inventories: LayoutInventories{
+			Paths:   []string{"inventories/*"},
+			Default: "inventories/main.yml",
+		},
+		Variables: LayoutVariables{
+			Directories: []string{"vars"},
+			Main:        "vars/main.yml",
+			Vault:       "vars/vault.yml",
+		},
+	}
+}
+
+// readLayout Reads repository manifest from project directory, missing settings are taken from default layout
+func readLayout(projectDirectory string) (*Layout, bool, error) {
+	layout := defaultLayout()
+
+	manifestPath := filepath.Join(projectDirectory, ManifestFileName)
+	exists, err := fileExists(manifestPath)
+	if err != nil {
+		return nil, false, err
+	}
+	if !exists {
+		return layout, false, nil
+	}
+
+	content, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var manifest Layout
+	if err := yaml.Unmarshal(content, &manifest); err != nil {
+		return nil, false, fmt.Errorf("unable to parse %s: %w", ManifestFileName, err)
+	}
+
+	if len(manifest.Playbooks.Directories) != 0 {
+		layout.Playbooks.Directories = manifest.Playbooks.Directories
+	}
+	if len(manifest.Playbooks.Patterns) != 0 {
+		layout.Playbooks.Patterns = manifest.Playbooks.Patterns
+	}
+	if len(manifest.Inventories.Paths) != 0 {
+		layout.Inventories.Paths = manifest.Inventories.Paths
+		layout.Inventories.Default = ""
+	}
+	if len(manifest.Inventories.Default) != 0 {
+		layout.Inventories.Default = manifest.Inventories.Default
+	}
+	if len(manifest.Variables.Directories) != 0 {
+		layout.Variables.Directories = manifest.Variables.Directories
+		layout.Variables.Main = ""
+		layout.Variables.Vault = ""
+	}
+	if len(manifest.Variables.Main) != 0 {
+		layout.Variables.Main = manifest.Variables.Main
+	}
+	if len(manifest.Variables.Vault) != 0 {
+		layout.Variables.Vault = manifest.Variables.Vault
+	}
+
+	if err := layout.clean(); err != nil {
+		return nil, false, fmt.Errorf("%s: %w", ManifestFileName, err)
+	}
+
+	return layout, true, nil
+}
+
+// clean Normalizes layout paths and checks that all of them are inside repository
+func (l *Layout) clean() error {
+	var err error
+
+	for i := range l.Playbooks.Directories {
+		if l.Playbooks.Directories[i], err = cleanRelativePath(l.Playbooks.Directories[i]); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range l.Playbooks.Patterns {
+		if strings.Contains(pattern, "/") {
+			return fmt.Errorf("playbook pattern %s should not contain directories", pattern)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("playbook pattern %s: %w", pattern, err)
+		}
+	}
+	for i := range l.Inventories.Paths {
+		if l.Inventories.Paths[i], err = cleanRelativePath(l.Inventories.Paths[i]); err != nil {
+			return err
+		}
+		if _, err := path.Match(l.Inventories.Paths[i], ""); err != nil {
+			return fmt.Errorf("inventory path %s: %w", l.Inventories.Paths[i], err)
+		}
+	}
+	if len(l.Inventories.Default) != 0 {
+		if l.Inventories.Default, err = cleanRelativePath(l.Inventories.Default); err != nil {
+			return err
+		}
+	}
+	for i := range l.Variables.Directories {
+		if l.Variables.Directories[i], err = cleanRelativePath(l.Variables.Directories[i]); err != nil {
+			return err
+		}
+	}
+	if len(l.Variables.Main) != 0 {
+		if l.Variables.Main, err = cleanRelativePath(l.Variables.Main); err != nil {
+			return err
+		}
+	}
+	if len(l.Variables.Vault) != 0 {
+		if l.Variables.Vault, err = cleanRelativePath(l.Variables.Vault); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func cleanRelativePath(p string) (string, error) {
+	cleaned := path.Clean(strings.TrimSpace(p))
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("path %s should be inside repository", p)
+	}
+	return cleaned, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// inventories Inventory paths (relative to repository root) matching layout, directories end with "/"
+func (l *Layout) inventories(projectDirectory string) ([]string, error) {
+	found := make(map[string]bool)
+
+	for _, pattern := range l.Inventories.Paths {
+		matches, err := filepath.Glob(filepath.Join(projectDirectory, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			name := filepath.Base(match)
+			if strings.HasPrefix(name, ".") || name == "group_vars" || name == "host_vars" {
+				continue
+			}
+			stat, err := os.Stat(match)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			relative, err := filepath.Rel(projectDirectory, match)
+			if err != nil {
+				return nil, err
+			}
+			relative = filepath.ToSlash(relative)
+			if stat.IsDir() {
+				//inventory directory with hosts files, group_vars and host_vars
+				relative += "/"
+			}
+			found[relative] = true
+		}
+	}
+
+	var inventories []string
+	for inventory := range found {
+		inventories = append(inventories, inventory)
+	}
+	sort.Strings(inventories)
+
+	if len(inventories) == 0 {
+		return nil, errors.New("inventories not found")
+	}
+
+	return inventories, nil
+}
+
+// defaultInventory Default inventory of project, first found inventory when not set
+func (l *Layout) defaultInventory(inventories []string) (string, error) {
+	if len(l.Inventories.Default) == 0 {
+		return inventories[0], nil
+	}
+	for _, inventory := range inventories {
+		if strings.TrimSuffix(inventory, "/") == l.Inventories.Default {
+			return inventory, nil
+		}
+	}
+	return "", fmt.Errorf("default inventory %s not found", l.Inventories.Default)
+}
+
+// variables Alternative variable files (relative to repository root), main and vault files are excluded
+func (l *Layout) variables(projectDirectory string) ([]string, error) {
+	var variables []string
+
+	for _, directory := range l.Variables.Directories {
+		exists, err := directoryExists(filepath.Join(projectDirectory, directory))
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+
+		entries, err := os.ReadDir(filepath.Join(projectDirectory, directory))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || !isYamlFile(entry.Name()) {
+				continue
+			}
+			variablesFile := path.Join(directory, entry.Name())
+			if variablesFile == l.Variables.Main || variablesFile == l.Variables.Vault {
+				continue
+			}
+			variables = append(variables, variablesFile)
+		}
+	}
+
+	sort.Strings(variables)
+
+	return variables, nil
+}
+
+// playbookFiles Playbook paths (relative to repository root) matching layout
+func (l *Layout) playbookFiles(projectDirectory string) ([]string, error) {
+	var playbooks []string
+
+	for _, directory := range l.Playbooks.Directories {
+		exists, err := directoryExists(filepath.Join(projectDirectory, directory))
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+
+		entries, err := os.ReadDir(filepath.Join(projectDirectory, directory))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			if directory == "." && entry.Name() == ManifestFileName {
+				continue
+			}
+			for _, pattern := range l.Playbooks.Patterns {
+				if ok, _ := path.Match(pattern, entry.Name()); ok {
+					playbooks = append(playbooks, path.Join(directory, entry.Name()))
+					break
+				}
+			}
+		}
+	}
+
+	return playbooks, nil
+}
+
+// optionalFile Path of file when it exists in project directory, otherwise empty string
+func optionalFile(projectDirectory, file string) (string, error) {
+	if len(file) == 0 {
+		return "", nil
+	}
+	exists, err := fileExists(filepath.Join(projectDirectory, file))
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", nil
+	}
+	return file, nil
+}
+
+func isYamlFile(name string) bool {
+	return strings.HasSuffix(name, ".yml") || strings.HasSuffix(name, ".yaml")
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeLayoutFiles(t *testing.T, directory string, files ...string) {
+	for _, file := range files {
+		path := filepath.Join(directory, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("---\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadLayoutDefault(t *testing.T) {
+	directory := t.TempDir()
+	writeLayoutFiles(t, directory, "site.yml", "inventories/main.yml", "inventories/stage.yml", "vars/main.yml", "vars/extra.yml")
+
+	layout, manifest, err := readLayout(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest {
+		t.Error("manifest should not be found")
+	}
+
+	inventories, err := layout.inventories(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(inventories, []string{"inventories/main.yml", "inventories/stage.yml"}) {
+		t.Errorf("unexpected inventories %v", inventories)
+	}
+
+	variables, err := layout.variables(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(variables, []string{"vars/extra.yml"}) {
+		t.Errorf("unexpected variables %v", variables)
+	}
+
+	playbooks, err := layout.playbookFiles(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(playbooks, []string{"site.yml"}) {
+		t.Errorf("unexpected playbooks %v", playbooks)
+	}
+}
+
+func TestReadLayoutManifest(t *testing.T) {
+	directory := t.TempDir()
+	writeLayoutFiles(t, directory, "playbooks/site.yml", "environments/prod/hosts", "environments/stage/hosts")
+	manifest := "playbooks:\n  directories: [playbooks]\ninventories:\n  paths: [environments/*/hosts]\n"
+	if err := os.WriteFile(filepath.Join(directory, ManifestFileName), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	layout, found, err := readLayout(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Error("manifest should be found")
+	}
+
+	inventories, err := layout.inventories(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultInventory, err := layout.defaultInventory(inventories)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defaultInventory != "environments/prod/hosts" {
+		t.Errorf("unexpected default inventory %s", defaultInventory)
+	}
+
+	playbooks, err := layout.playbookFiles(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(playbooks, []string{"playbooks/site.yml"}) {
+		t.Errorf("unexpected playbooks %v", playbooks)
+	}
+}
+
+func TestReadLayoutOutsideRepository(t *testing.T) {
+	directory := t.TempDir()
+	manifest := "variables:\n  vault: ../secrets.yml\n"
+	if err := os.WriteFile(filepath.Join(directory, ManifestFileName), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := readLayout(directory); err == nil {
+		t.Error("path outside repository should be rejected")
+	}
+}
+
+func TestLayoutInventoryDirectories(t *testing.T) {
+	directory := t.TempDir()
+	writeLayoutFiles(t, directory, "inventories/main.yml", "inventories/prod/hosts", "inventories/prod/group_vars/all.yml", "inventories/group_vars/all.yml")
+
+	layout, _, err := readLayout(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inventories, err := layout.inventories(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(inventories, []string{"inventories/main.yml", "inventories/prod/"}) {
+		t.Errorf("unexpected inventories %v", inventories)
+	}
+}
+
+func TestInventoryKind(t *testing.T) {
+	directory := t.TempDir()
+	writeLayoutFiles(t, directory, "inventories/main.yml", "inventories/prod/hosts")
+	if err := os.WriteFile(filepath.Join(directory, "inventories/aws_ec2.yml"), []byte("plugin: amazon.aws.aws_ec2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(directory, "inventories/cmdb.py"), []byte("#!/usr/bin/env python3\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := map[string]int{
+		"inventories/main.yml":    inventoryStatic,
+		"inventories/prod/":       inventoryStatic,
+		"inventories/aws_ec2.yml": inventoryPlugin,
+		"inventories/cmdb.py":     inventoryScript,
+	}
+	for inventory, expected := range kinds {
+		kind, err := inventoryKind(directory, inventory)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kind != expected {
+			t.Errorf("inventory %s kind %d, expected %d", inventory, kind, expected)
+		}
+	}
+}
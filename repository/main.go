@@ -1,28 +1,52 @@
 package repository
 
 import (
+	"context"
+	"encoding/json"
+	"ensemble/privatekeys"
+	"ensemble/runner"
+	"ensemble/secrets"
 	"ensemble/storage"
 	"ensemble/storage/structures"
 	"errors"
 	"fmt"
 	"github.com/alessio/shellescape"
 	log "github.com/sirupsen/logrus"
-	"io/ioutil"
 	"os"
 	"os/exec"
-	"regexp"
+	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
 type Manager struct {
-	config Configuration
-	store  *storage.Storage
+	config     Configuration
+	store      storage.Store
+	keyManager *privatekeys.KeyManager
+	runner     *runner.Runner
+	secrets    *secrets.Resolver
+	jobsMutex  sync.Mutex
+	jobs       map[string]*updateJob
+	locks      map[string]*sync.Mutex
+	retries    map[string]*updateRetry
 }
 
 type Configuration struct {
-	Path string
+	Path              string
+	AskPassScript     string
+	CommandTimeout    time.Duration
+	CloneDepth        int
+	LocalRoot         string
+	LockedWaitTimeout time.Duration
+}
+
+type updateRevision struct {
+	title string
+	from  string
+	to    string
 }
 
 type result struct {
@@ -32,47 +56,72 @@ type result struct {
 
 ///////////////////////////////////////////////////////////////////////////////
 
-func New(config Configuration, store *storage.Storage) *Manager {
+func New(config Configuration, store storage.Store, keyManager *privatekeys.KeyManager, runner *runner.Runner, secrets *secrets.Resolver) *Manager {
+	if len(config.AskPassScript) != 0 {
+		//git commands are executed in project directories
+		if script, err := filepath.Abs(config.AskPassScript); err == nil {
+			config.AskPassScript = script
+		} else {
+			log.Warnf("unable to resolve git askpass script path: %s", err)
+		}
+	}
 	return &Manager{
-		config: config,
-		store:  store,
+		config:     config,
+		store:      store,
+		keyManager: keyManager,
+		runner:     runner,
+		secrets:    secrets,
+		jobs:       make(map[string]*updateJob),
+		locks:      make(map[string]*sync.Mutex),
+		retries:    make(map[string]*updateRetry),
 	}
 }
 
 ///////////////////////////////////////////////////////////////////////////////
 
-// UpdateAll Updates all projects in storage
-func (m *Manager) UpdateAll() {
-	projects, err := m.store.ProjectGetAll()
-	if err != nil {
-		log.Warnf("unable to get projects: %s", err)
-		return
-	}
+// Update Updates project synchronously, waits for running update of the same project to finish
+func (m *Manager) Update(project *structures.Project) error {
+	lock := m.projectLock(project.Id)
+	lock.Lock()
+	defer lock.Unlock()
 
-	for _, project := range projects {
-		log.Infof("updating project %s...", project.Id)
-		if err := m.Update(project); err != nil {
-			log.Warnf("unable to update project %s: %s", project.Name, err)
-		}
-	}
+	return m.update(project)
 }
 
-func (m *Manager) Update(project *structures.Project) error {
-	if m.store.ProjectHasLockedPlaybooks(project.Id) {
-		return errors.New("project has locked playbooks")
+func (m *Manager) update(project *structures.Project) error {
+	ctx, output := m.startJob(project)
+	defer m.finishJob(output)
+
+	return m.runUpdate(ctx, project, output)
+}
+
+// runUpdate Updates project within started job and records update result
+func (m *Manager) runUpdate(ctx context.Context, project *structures.Project, output *updateJob) (err error) {
+	if err := m.applyUpdatePolicy(ctx, project, output); err != nil {
+		return err
 	}
 
-	output := strings.Builder{}
 	success := false
-	revision := "unknown revision"
+	revision := &updateRevision{title: "unknown revision"}
+	changes := structures.ProjectUpdateChanges{}
 
 	defer func() {
+		if err != nil {
+			output.WriteString(fmt.Sprintf("> update failed: %s\n", err))
+		}
+		changesJson, err := json.Marshal(changes)
+		if err != nil {
+			log.Errorf("unable to encode project update changes %s: %s", project.Id, err)
+		}
 		update := structures.ProjectUpdate{
-			ProjectId: project.Id,
-			Date:      time.Now(),
-			Success:   success,
-			Revision:  revision,
-			Log:       output.String(),
+			ProjectId:    project.Id,
+			Date:         time.Now(),
+			Success:      success,
+			Revision:     redactCredentials(project, revision.title, output.Secrets()...),
+			RevisionFrom: revision.from,
+			RevisionTo:   revision.to,
+			Changes:      string(changesJson),
+			Log:          redactCredentials(project, output.String(), output.Secrets()...),
 		}
 		if err := m.store.ProjectUpdateInsert(&update); err != nil {
 			log.Errorf("unable to save project update %s: %s", project.Id, err)
@@ -83,12 +132,73 @@ func (m *Manager) Update(project *structures.Project) error {
 		return err
 	}
 
+	if project.IsGit() {
+		err = m.updateGit(ctx, project, revision, &changes, output)
+	} else {
+		err = m.updateSource(project, revision, &changes, output)
+	}
+	if err != nil {
+		return err
+	}
+
+	layout, manifest, err := readLayout(m.projectDirectory(project))
+	if err != nil {
+		return err
+	}
+	if manifest {
+		output.WriteString(fmt.Sprintf("> using repository layout from %s\n", ManifestFileName))
+	}
+
+	if err := m.updateProjectInfo(project, layout, &changes); err != nil {
+		return err
+	}
+	if err := m.updatePlaybooksInfo(project, layout, &changes); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	syntaxResult, err := m.syntaxCheck(project)
+	if err != nil {
+		//playbooks are updated already, keep previous syntax check results
+		log.Warnf("unable to check project %s playbooks syntax: %s", project.Id, err)
+		syntaxResult = fmt.Sprintf("> syntax check failed: %s\n", err)
+	}
+	output.WriteString(syntaxResult)
+
+	success = true
+
+	return nil
+}
+
+// updateGit Clones or pulls git repository of the project
+func (m *Manager) updateGit(ctx context.Context, project *structures.Project, revision *updateRevision, changes *structures.ProjectUpdateChanges, output *updateJob) error {
+	env, cleanup, err := m.gitEnvironment(ctx, project, output)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	revision.from, err = m.head(project)
+	if err != nil {
+		return err
+	}
+
 	exists, err := m.projectRepositoryExists(project)
 	if err != nil {
 		return err
 	}
 	if !exists {
-		cloneResult, err := m.clone(project)
+		//directory could keep content of archive or local directory source
+		if err := os.RemoveAll(m.projectDirectory(project)); err != nil {
+			return err
+		}
+		if err := m.ensureProjectDirectoryExists(project); err != nil {
+			return err
+		}
+		cloneResult, err := m.clone(ctx, project, env)
 		if err != nil {
 			return err
 		}
@@ -116,16 +226,36 @@ func (m *Manager) Update(project *structures.Project) error {
 		return errors.New("unable to execute git reset")
 	}
 
-	pullResult, err := m.pull(project)
+	fetchResult, err := m.fetch(ctx, project, env)
+	if err != nil {
+		return err
+	}
+	output.WriteString(fmt.Sprintf("> git fetch\n\n%s\n", fetchResult.output))
+	if !fetchResult.success {
+		return errors.New("unable to execute git fetch")
+	}
+
+	//only full SHA can be fetched directly, abbreviated one should be within clone depth
+	if m.config.CloneDepth > 0 && project.RevisionType == structures.ProjectRevisionCommit && len(project.Revision) == 40 {
+		fetchCommitResult, err := m.fetchCommit(ctx, project, env)
+		if err != nil {
+			return err
+		}
+		output.WriteString(fmt.Sprintf("> git fetch commit\n\n%s\n", fetchCommitResult.output))
+		if !fetchCommitResult.success {
+			return errors.New("unable to fetch commit")
+		}
+	}
+
+	target, err := m.revisionTarget(project)
 	if err != nil {
 		return err
 	}
-	output.WriteString(fmt.Sprintf("> git pull\n\n%s\n", pullResult.output))
-	if !pullResult.success {
-		return errors.New("unable to execute git pull")
+	if project.RevisionType == structures.ProjectRevisionTagPattern {
+		output.WriteString(fmt.Sprintf("> latest tag matching %s: %s\n\n", project.Revision, target))
 	}
 
-	checkoutResult, err := m.checkout(project)
+	checkoutResult, err := m.checkout(project, target)
 	if err != nil {
 		return err
 	}
@@ -134,21 +264,42 @@ func (m *Manager) Update(project *structures.Project) error {
 		return errors.New("unable to execute git checkout")
 	}
 
-	revision, err = m.revision(project)
+	if project.RevisionType == structures.ProjectRevisionBranch {
+		pullResult, err := m.pull(ctx, project, env)
+		if err != nil {
+			return err
+		}
+		output.WriteString(fmt.Sprintf("> git pull\n\n%s\n", pullResult.output))
+		if !pullResult.success {
+			return errors.New("unable to execute git pull")
+		}
+	}
+
+	if project.RepositorySubmodules {
+		if err := m.updateSubmodules(ctx, project, env, changes, output); err != nil {
+			return err
+		}
+	}
+	if project.RepositoryLfs {
+		if err := m.updateLfs(ctx, project, env, output); err != nil {
+			return err
+		}
+	}
+
+	revision.title, err = m.revision(project)
 	if err != nil {
 		return err
 	}
-	output.WriteString(fmt.Sprintf("> current revision: %s\n", revision))
+	output.WriteString(fmt.Sprintf("> current revision: %s\n", revision.title))
 
-	if err := m.updateProjectInfo(project); err != nil {
+	revision.to, err = m.head(project)
+	if err != nil {
 		return err
 	}
-	if err := m.updatePlaybooksInfo(project); err != nil {
+	if err := m.revisionChanges(project, revision.from, revision.to, changes); err != nil {
 		return err
 	}
 
-	success = true
-
 	return nil
 }
 
@@ -183,9 +334,90 @@ func (m *Manager) ensureProjectDirectoryExists(p *structures.Project) error {
 
 ///////////////////////////////////////////////////////////////////////////////
 
-func (m *Manager) clone(p *structures.Project) (*result, error) {
-	command := fmt.Sprintf("git clone --branch %s %s .", shellescape.Quote(p.RepositoryBranch), shellescape.Quote(p.RepositoryUrlFull()))
-	return m.executeCommand(command, m.projectDirectory(p))
+func (m *Manager) projectKnownHostsFile(p *structures.Project) string {
+	return fmt.Sprintf("%s/%s.known_hosts", m.config.Path, p.Id)
+}
+
+// gitEnvironment Environment for git commands accessing remote repository.
+// Selects project deploy key, pins ssh host keys of git server and provides HTTP credentials,
+// resolved credentials are added to job secrets.
+func (m *Manager) gitEnvironment(ctx context.Context, p *structures.Project, output *updateJob) ([]string, func(), error) {
+	var cleanups []func()
+	cleanup := func() {
+		for _, f := range cleanups {
+			f()
+		}
+	}
+
+	sshCommand := strings.Builder{}
+	sshCommand.WriteString("ssh -o BatchMode=yes")
+
+	if len(strings.TrimSpace(p.RepositoryHostKeys)) != 0 {
+		knownHostsFile, err := os.CreateTemp("", "ensemble-known-hosts-")
+		if err != nil {
+			return nil, cleanup, err
+		}
+		cleanups = append(cleanups, func() {
+			if err := os.Remove(knownHostsFile.Name()); err != nil {
+				log.Warnf("known hosts file remove error %s: %s", p.Id, err)
+			}
+		})
+		_, err = knownHostsFile.WriteString(strings.ReplaceAll(p.RepositoryHostKeys, "\r\n", "\n") + "\n")
+		if closeErr := knownHostsFile.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, cleanup, err
+		}
+		sshCommand.WriteString(fmt.Sprintf(" -o UserKnownHostsFile=%s -o StrictHostKeyChecking=yes", shellescape.Quote(knownHostsFile.Name())))
+	} else {
+		sshCommand.WriteString(fmt.Sprintf(" -o UserKnownHostsFile=%s -o StrictHostKeyChecking=accept-new", shellescape.Quote(m.projectKnownHostsFile(p))))
+	}
+
+	var env []string
+
+	if len(p.RepositoryKeyId) != 0 {
+		key, err := m.store.KeyGet(p.RepositoryKeyId)
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("unable to get project deploy key: %w", err)
+		}
+		sshCommand.WriteString(fmt.Sprintf(" -o IdentitiesOnly=yes -i %s", shellescape.Quote(m.keyManager.KeyPath(key))))
+
+		if len(key.Password) != 0 {
+			agent, err := m.keyManager.StartAgent(key)
+			if err != nil {
+				return nil, cleanup, err
+			}
+			cleanups = append(cleanups, agent.Stop)
+			env = append(env, fmt.Sprintf("SSH_AUTH_SOCK=%s", agent.Sock))
+		} else {
+			sshCommand.WriteString(" -o IdentityAgent=none")
+		}
+	}
+
+	credentialsEnv, secrets, err := m.credentialsEnvironment(ctx, p)
+	if err != nil {
+		return nil, cleanup, err
+	}
+	output.AddSecrets(secrets...)
+	env = append(env, fmt.Sprintf("GIT_SSH_COMMAND=%s", sshCommand.String()))
+	env = append(env, credentialsEnv...)
+
+	return env, cleanup, nil
+}
+
+func (m *Manager) clone(ctx context.Context, p *structures.Project, env []string) (*result, error) {
+	command := strings.Builder{}
+	command.WriteString("git clone")
+	if m.config.CloneDepth > 0 {
+		//later fetches keep history shallow, commits older than depth are fetched on demand
+		command.WriteString(fmt.Sprintf(" --depth %d --no-single-branch", m.config.CloneDepth))
+	}
+	if p.RevisionType == structures.ProjectRevisionBranch {
+		command.WriteString(fmt.Sprintf(" --branch %s", shellescape.Quote(p.RepositoryBranch)))
+	}
+	command.WriteString(fmt.Sprintf(" %s .", shellescape.Quote(p.RepositoryUrl)))
+	return m.executeCommandContext(ctx, command.String(), m.projectDirectory(p), env...)
 }
 
 func (m *Manager) revision(p *structures.Project) (string, error) {
@@ -204,7 +436,7 @@ func (m *Manager) revision(p *structures.Project) (string, error) {
 }
 
 func (m *Manager) origin(p *structures.Project) (*result, error) {
-	command := fmt.Sprintf("git remote set-url origin %s", shellescape.Quote(p.RepositoryUrlFull()))
+	command := fmt.Sprintf("git remote set-url origin %s", shellescape.Quote(p.RepositoryUrl))
 	return m.executeCommand(command, m.projectDirectory(p))
 }
 
@@ -212,76 +444,120 @@ func (m *Manager) reset(p *structures.Project) (*result, error) {
 	return m.executeCommand("git reset --hard", m.projectDirectory(p))
 }
 
-func (m *Manager) checkout(p *structures.Project) (*result, error) {
-	command := fmt.Sprintf("git checkout %s", shellescape.Quote(p.RepositoryBranch))
+// revisionTarget Branch name, tag or commit to check out
+func (m *Manager) revisionTarget(p *structures.Project) (string, error) {
+	switch p.RevisionType {
+	case structures.ProjectRevisionTag, structures.ProjectRevisionCommit:
+		return p.Revision, nil
+	case structures.ProjectRevisionTagPattern:
+		tag, err := m.latestTag(p, p.Revision)
+		if err != nil {
+			return "", err
+		}
+		if len(tag) == 0 {
+			return "", fmt.Errorf("no tags matching %s found", p.Revision)
+		}
+		return tag, nil
+	default:
+		return p.RepositoryBranch, nil
+	}
+}
+
+func (m *Manager) checkout(p *structures.Project, target string) (*result, error) {
+	command := fmt.Sprintf("git checkout %s", shellescape.Quote(target))
+	switch p.RevisionType {
+	case structures.ProjectRevisionTag, structures.ProjectRevisionTagPattern:
+		command = fmt.Sprintf("git checkout --detach %s", shellescape.Quote("refs/tags/"+target))
+	case structures.ProjectRevisionCommit:
+		command = fmt.Sprintf("git checkout --detach %s", shellescape.Quote(target))
+	}
 	return m.executeCommand(command, m.projectDirectory(p))
 }
 
-func (m *Manager) pull(p *structures.Project) (*result, error) {
-	return m.executeCommand("git pull", m.projectDirectory(p))
+func (m *Manager) fetch(ctx context.Context, p *structures.Project, env []string) (*result, error) {
+	return m.executeCommandContext(ctx, "git fetch --tags --prune --force origin", m.projectDirectory(p), env...)
+}
+
+// fetchCommit Fetches pinned commit missing in shallow clone
+func (m *Manager) fetchCommit(ctx context.Context, p *structures.Project, env []string) (*result, error) {
+	command := fmt.Sprintf("git fetch --depth %d origin %s", m.config.CloneDepth, shellescape.Quote(p.Revision))
+	return m.executeCommandContext(ctx, command, m.projectDirectory(p), env...)
+}
+
+func (m *Manager) pull(ctx context.Context, p *structures.Project, env []string) (*result, error) {
+	return m.executeCommandContext(ctx, "git pull", m.projectDirectory(p), env...)
 }
 
 ///////////////////////////////////////////////////////////////////////////////
 
-func (m *Manager) updateProjectInfo(p *structures.Project) error {
+func (m *Manager) updateProjectInfo(p *structures.Project, layout *Layout, changes *structures.ProjectUpdateChanges) error {
 	projectDirectory := m.projectDirectory(p)
+	inventoriesBefore := p.InventoryList()
+	variablesBefore := variableFiles(p)
 
-	inventoryMainFileName := fmt.Sprintf("%s/inventories/main.yml", projectDirectory)
-	exists, err := fileExists(inventoryMainFileName)
+	inventories, err := layout.inventories(projectDirectory)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return errors.New("main inventory file not found")
+	p.Inventories = strings.Join(inventories, "|")
+
+	var scripts, plugins []string
+	for _, inventory := range inventories {
+		kind, err := inventoryKind(projectDirectory, inventory)
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case inventoryScript:
+			scripts = append(scripts, inventory)
+		case inventoryPlugin:
+			plugins = append(plugins, inventory)
+		}
 	}
+	p.InventoryScripts = strings.Join(scripts, "|")
+	p.InventoryPlugins = strings.Join(plugins, "|")
 
-	variablesMainFileName := fmt.Sprintf("%s/vars/main.yml", projectDirectory)
-	exists, err = fileExists(variablesMainFileName)
+	p.InventoryDefault, err = layout.defaultInventory(inventories)
 	if err != nil {
 		return err
 	}
-	p.VariablesMain = exists
 
-	vaultFileName := fmt.Sprintf("%s/vars/vault.yml", projectDirectory)
-	exists, err = fileExists(vaultFileName)
-	if err != nil {
-		return err
+	var selectedInventories []string
+	for _, inventory := range p.InventorySelectedList() {
+		if listContains(inventories, inventory) {
+			selectedInventories = append(selectedInventories, inventory)
+		}
+	}
+	if len(selectedInventories) == 0 {
+		selectedInventories = []string{p.InventoryDefault}
 	}
-	p.VariablesVault = exists
+	p.Inventory = strings.Join(selectedInventories, "|")
 
-	inventories, err := m.projectInventories(p)
+	p.VariablesMainFile, err = optionalFile(projectDirectory, layout.Variables.Main)
 	if err != nil {
 		return err
 	}
-	p.Inventories = strings.Join(inventories, "|")
+	p.VariablesMain = len(p.VariablesMainFile) != 0
 
-	inventoryFound := false
-	for _, i := range inventories {
-		if i == p.Inventory {
-			inventoryFound = true
-			break
-		}
-	}
-	if !inventoryFound {
-		p.Inventory = "main.yml"
+	p.VariablesVaultFile, err = optionalFile(projectDirectory, layout.Variables.Vault)
+	if err != nil {
+		return err
 	}
+	p.VariablesVault = len(p.VariablesVaultFile) != 0
 
-	variables, err := m.projectVariables(p)
+	variables, err := layout.variables(projectDirectory)
 	if err != nil {
 		return err
 	}
 	p.VariablesAvailable = strings.Join(variables, "|")
 
-	variablesFound := false
-	for _, v := range variables {
-		if v == p.Variables {
-			variablesFound = true
-			break
+	var selectedVariables []string
+	for _, v := range p.VariablesSelectedList() {
+		if listContains(variables, v) {
+			selectedVariables = append(selectedVariables, v)
 		}
 	}
-	if !variablesFound {
-		p.Variables = ""
-	}
+	p.Variables = strings.Join(selectedVariables, "|")
 
 	collections, err := m.projectCollections(p)
 	if err != nil {
@@ -289,6 +565,9 @@ func (m *Manager) updateProjectInfo(p *structures.Project) error {
 	}
 	p.Collections = strings.Join(collections, "|")
 
+	changes.InventoriesAdded, changes.InventoriesRemoved = diffLists(inventoriesBefore, p.InventoryList())
+	changes.VariablesAdded, changes.VariablesRemoved = diffLists(variablesBefore, variableFiles(p))
+
 	if err := m.store.ProjectUpdate(p); err != nil {
 		return err
 	}
@@ -321,81 +600,15 @@ func (m *Manager) projectCollections(p *structures.Project) ([]string, error) {
 	return collections, nil
 }
 
-func (m *Manager) projectVariables(p *structures.Project) ([]string, error) {
-	variablesDirectory := fmt.Sprintf("%s/vars", m.projectDirectory(p))
-	exists, err := directoryExists(variablesDirectory)
-	if err != nil {
-		return nil, err
-	}
-	if !exists {
-		return []string{}, nil
-	}
-
-	pattern, err := regexp.Compile("^.+\\.yml$")
-	if err != nil {
-		return nil, err
-	}
-
-	entries, err := ioutil.ReadDir(variablesDirectory)
-	if err != nil {
-		return nil, err
-	}
-
-	var variables []string
-
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-		name := entry.Name()
-		if pattern.MatchString(name) && name != "main.yml" && name != "vault.yml" {
-			variables = append(variables, name)
-		}
-	}
-
-	sort.Strings(variables)
-
-	return variables, nil
-}
-
-func (m *Manager) projectInventories(p *structures.Project) ([]string, error) {
-	inventoriesDirectory := fmt.Sprintf("%s/inventories", m.projectDirectory(p))
-	exists, err := directoryExists(inventoriesDirectory)
-	if err != nil {
-		return nil, err
-	}
-	if !exists {
-		return nil, errors.New("inventories directory not found")
-	}
-
-	entries, err := ioutil.ReadDir(inventoriesDirectory)
-	if err != nil {
-		return nil, err
-	}
-
-	var inventories []string
-
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-		inventories = append(inventories, entry.Name())
-	}
-
-	sort.Strings(inventories)
-
-	return inventories, nil
-}
-
 ///////////////////////////////////////////////////////////////////////////////
 
-func (m *Manager) updatePlaybooksInfo(p *structures.Project) error {
+func (m *Manager) updatePlaybooksInfo(p *structures.Project, layout *Layout, changes *structures.ProjectUpdateChanges) error {
 	playbooks, err := m.store.PlaybookGetByProject(p.Id)
 	if err != nil {
 		return err
 	}
 
-	currentPlaybooks, err := m.playbooks(p)
+	currentPlaybooks, err := m.playbooks(p, layout)
 	if err != nil {
 		return err
 	}
@@ -421,6 +634,21 @@ func (m *Manager) updatePlaybooksInfo(p *structures.Project) error {
 		}
 	}
 
+	playbooksById := make(map[string]*structures.Playbook)
+	for _, playbook := range playbooks {
+		playbooksById[playbook.Id] = playbook
+	}
+	for _, playbook := range playbooksToInsert {
+		changes.PlaybooksAdded = append(changes.PlaybooksAdded, playbook.Filename)
+	}
+	for playbookId, toDelete := range playbooksToDelete {
+		if toDelete {
+			changes.PlaybooksRemoved = append(changes.PlaybooksRemoved, playbooksById[playbookId].Filename)
+		}
+	}
+	sort.Strings(changes.PlaybooksAdded)
+	sort.Strings(changes.PlaybooksRemoved)
+
 	for _, playbook := range playbooksToInsert {
 		if err := m.store.PlaybookInsert(playbook); err != nil {
 			log.Errorf("unable to insert playbook %s: %s", playbook.Filename, err)
@@ -443,37 +671,45 @@ func (m *Manager) updatePlaybooksInfo(p *structures.Project) error {
 	return nil
 }
 
-func (m *Manager) playbooks(p *structures.Project) ([]*structures.Playbook, error) {
-	pattern, err := regexp.Compile("^.+\\.yml$")
-	if err != nil {
-		return nil, err
-	}
-
+func (m *Manager) playbooks(p *structures.Project, layout *Layout) ([]*structures.Playbook, error) {
 	projectDirectory := m.projectDirectory(p)
 
-	entries, err := ioutil.ReadDir(projectDirectory)
+	files, err := layout.playbookFiles(projectDirectory)
 	if err != nil {
 		return nil, err
 	}
 
 	var playbooks []*structures.Playbook
 
-	for _, entry := range entries {
-		if entry.IsDir() || !pattern.MatchString(entry.Name()) {
-			continue
-		}
-		path := fmt.Sprintf("%s/%s", projectDirectory, entry.Name())
-		name, description, err := m.playbookInfo(path)
+	for _, file := range files {
+		path := fmt.Sprintf("%s/%s", projectDirectory, file)
+		metadataError := ""
+		metadata, err := m.playbookInfo(path)
 		if err != nil {
-			log.Errorf("unable to read %s: %s", path, err)
-			continue
+			//playbook is kept with file name and without survey, so its runs history is not lost
+			log.Warnf("unable to read metadata of %s: %s", path, err)
+			metadataError = err.Error()
+			metadata = &PlaybookMetadata{}
+		}
+		survey := ""
+		if len(metadata.Survey) != 0 {
+			encoded, err := json.Marshal(metadata.Survey)
+			if err != nil {
+				return nil, err
+			}
+			survey = string(encoded)
 		}
 		playbook := structures.Playbook{
-			ProjectId:   p.Id,
-			Filename:    entry.Name(),
-			Name:        name,
-			Description: description,
-			Locked:      false,
+			ProjectId:     p.Id,
+			Filename:      file,
+			Name:          metadata.Name,
+			Description:   metadata.Description,
+			Category:      metadata.Category,
+			Tags:          strings.Join(metadata.Tags, "|"),
+			Dangerous:     metadata.Dangerous,
+			Survey:        survey,
+			Locked:        false,
+			MetadataError: metadataError,
 		}
 		playbooks = append(playbooks, &playbook)
 	}
@@ -481,34 +717,40 @@ func (m *Manager) playbooks(p *structures.Project) ([]*structures.Playbook, erro
 	return playbooks, nil
 }
 
-func (m *Manager) playbookInfo(filePath string) (string, string, error) {
+func (m *Manager) playbookInfo(filePath string) (*PlaybookMetadata, error) {
 	content, err := os.ReadFile(filePath)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
+	return parsePlaybookMetadata(string(content))
+}
 
-	name := ""
-	description := strings.Builder{}
+// syntaxCheck Checks syntax of all project playbooks and saves results, returns summary for update log
+func (m *Manager) syntaxCheck(p *structures.Project) (string, error) {
+	playbooks, err := m.store.PlaybookGetByProject(p.Id)
+	if err != nil {
+		return "", err
+	}
 
-	lines := strings.Split(string(content), "\n")
+	syntaxErrors, err := m.runner.SyntaxCheck(p, playbooks)
+	if err != nil {
+		return "", err
+	}
 
-	for _, line := range lines {
-		if line == "---" {
-			break
-		}
-		if line[:1] != "#" {
-			continue
+	output := strings.Builder{}
+	output.WriteString(fmt.Sprintf("> syntax check: %d playbooks, %d failed\n", len(playbooks), len(syntaxErrors)))
+
+	for _, playbook := range playbooks {
+		syntaxError, failed := syntaxErrors[playbook.Id]
+		if failed {
+			output.WriteString(fmt.Sprintf("%s\n%s\n", playbook.Filename, syntaxError))
 		}
-		line = line[1:]
-		if len(name) == 0 {
-			name = line
-		} else {
-			description.WriteString(line)
-			description.WriteString("\n")
+		if err := m.store.PlaybookSaveSyntax(playbook.Id, !failed, syntaxError); err != nil {
+			return "", err
 		}
 	}
 
-	return name, description.String(), nil
+	return output.String(), nil
 }
 
 ///////////////////////////////////////////////////////////////////////////////
@@ -535,13 +777,39 @@ func fileExists(file string) (bool, error) {
 	return false, err
 }
 
-func (m *Manager) executeCommand(command, directory string) (*result, error) {
-	cmd := exec.Command("/bin/bash", "-c", command)
+func (m *Manager) executeCommand(command, directory string, env ...string) (*result, error) {
+	return m.executeCommandContext(context.Background(), command, directory, env...)
+}
+
+// executeCommandContext Executes command with configured timeout, command and its children are killed on timeout or cancellation
+func (m *Manager) executeCommandContext(ctx context.Context, command, directory string, env ...string) (*result, error) {
+	if m.config.CommandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.config.CommandTimeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, "/bin/bash", "-c", command)
 	cmd.Dir = directory
+	if len(env) != 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
 
 	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		commandName := strings.Fields(command)
+		if len(commandName) > 2 {
+			commandName = commandName[:2]
+		}
+		return nil, fmt.Errorf("%s interrupted: %w", strings.Join(commandName, " "), ctx.Err())
+	}
 	if err != nil {
-		if errors.Is(err, &exec.ExitError{}) {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
 			return &result{
 				success: false,
 				output:  string(output),
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"ensemble/storage"
+	"path/filepath"
+	"testing"
+)
+
+// newTestStore Storage in temporary SQLite database closed after test
+func newTestStore(t *testing.T) storage.Store {
+	store, err := storage.New(storage.Configuration{Url: "sqlite://" + filepath.Join(t.TempDir(), "ensemble.db")})
+	if err != nil {
+		t.Fatalf("unable to create storage: %s", err)
+	}
+	t.Cleanup(func() {
+		store.Close()
+	})
+	return store
+}
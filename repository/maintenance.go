@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"ensemble/storage/structures"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Usage Disk space taken by projects and shared caches
+type Usage struct {
+	Projects    []*ProjectUsage
+	Deleted     []*ProjectUsage
+	Collections int64
+	Total       int64
+}
+
+// ProjectUsage Disk space taken by single project, run output is stored in database
+type ProjectUsage struct {
+	Project   *structures.Project
+	Id        string
+	Checkout  int64
+	Git       int64
+	Archives  int64
+	RunOutput int64
+}
+
+func (u *ProjectUsage) Files() int64 {
+	return u.Checkout + u.Archives
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// Usage Disk usage of active projects, leftovers of deleted projects and collections cache
+func (m *Manager) Usage() (*Usage, error) {
+	projects, err := m.store.ProjectGetAll()
+	if err != nil {
+		return nil, err
+	}
+	deletedIds, err := m.store.ProjectGetDeletedIds()
+	if err != nil {
+		return nil, err
+	}
+	runOutput, err := m.store.RunResultSizeByProject()
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &Usage{}
+
+	for _, project := range projects {
+		projectUsage, err := m.projectUsage(project.Id)
+		if err != nil {
+			return nil, err
+		}
+		projectUsage.Project = project
+		projectUsage.RunOutput = runOutput[project.Id]
+		usage.Projects = append(usage.Projects, projectUsage)
+		usage.Total += projectUsage.Files()
+	}
+	sort.SliceStable(usage.Projects, func(i, j int) bool {
+		return usage.Projects[i].Files() > usage.Projects[j].Files()
+	})
+
+	for _, id := range deletedIds {
+		projectUsage, err := m.projectUsage(id)
+		if err != nil {
+			return nil, err
+		}
+		if projectUsage.Files() == 0 {
+			continue
+		}
+		usage.Deleted = append(usage.Deleted, projectUsage)
+		usage.Total += projectUsage.Files()
+	}
+
+	if collectionsPath := m.runner.CollectionsPath(); len(collectionsPath) != 0 {
+		if usage.Collections, err = directorySize(collectionsPath); err != nil {
+			return nil, err
+		}
+		usage.Total += usage.Collections
+	}
+
+	return usage, nil
+}
+
+// CollectGarbage Removes checkouts and archives of deleted projects, returns number of cleaned projects
+func (m *Manager) CollectGarbage() (int, error) {
+	deletedIds, err := m.store.ProjectGetDeletedIds()
+	if err != nil {
+		return 0, err
+	}
+
+	cleaned := 0
+	for _, id := range deletedIds {
+		project := &structures.Project{Id: id}
+
+		lock := m.projectLock(id)
+		if !lock.TryLock() {
+			log.Warnf("project %s update is running, files are kept", id)
+			continue
+		}
+
+		paths := []string{
+			m.projectDirectory(project),
+			m.projectArchivesDirectory(project),
+			m.projectKnownHostsFile(project),
+			m.projectSourceFile(project),
+		}
+		removed := false
+		for _, path := range paths {
+			if _, err := os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err := os.RemoveAll(path); err != nil {
+				log.Warnf("unable to remove deleted project %s files: %s", id, err)
+				continue
+			}
+			removed = true
+		}
+		lock.Unlock()
+
+		if removed {
+			log.Infof("files of deleted project %s removed", id)
+			cleaned++
+		}
+	}
+	return cleaned, nil
+}
+
+// GitGc Compacts git repository of project checkout
+func (m *Manager) GitGc(project *structures.Project) (string, error) {
+	exists, err := m.projectRepositoryExists(project)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", errors.New("project repository is not cloned")
+	}
+
+	lock := m.projectLock(project.Id)
+	if !lock.TryLock() {
+		return "", ErrUpdateRunning
+	}
+	defer lock.Unlock()
+
+	//killed after configured git command timeout as other git commands
+	gcResult, err := m.executeCommand("git gc --prune=now", m.projectDirectory(project))
+	if err != nil {
+		return "", err
+	}
+	if !gcResult.success {
+		return gcResult.output, errors.New("unable to execute git gc")
+	}
+	return gcResult.output, nil
+}
+
+// Reclone Removes project checkout and clones repository again in background,
+// update job is started before return so its log can be followed at once
+func (m *Manager) Reclone(project *structures.Project) error {
+	if !project.IsGit() {
+		return errors.New("project is not a git project")
+	}
+
+	lock := m.projectLock(project.Id)
+	if !lock.TryLock() {
+		return ErrUpdateRunning
+	}
+	if m.store.ProjectHasLockedPlaybooks(project.Id) {
+		lock.Unlock()
+		return errors.New("project has locked playbooks")
+	}
+
+	ctx, output := m.startJob(project)
+
+	go func() {
+		defer lock.Unlock()
+		defer m.finishJob(output)
+		output.WriteString("> removing project checkout\n")
+		if err := os.RemoveAll(m.projectDirectory(project)); err != nil {
+			log.Warnf("unable to remove project %s checkout: %s", project.Name, err)
+			return
+		}
+		if err := m.runUpdate(ctx, project, output); err != nil {
+			log.Warnf("unable to clone project %s: %s", project.Name, err)
+		}
+	}()
+
+	return nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func (m *Manager) projectUsage(id string) (*ProjectUsage, error) {
+	project := &structures.Project{Id: id}
+	usage := &ProjectUsage{Id: id}
+
+	var err error
+	if usage.Checkout, err = directorySize(m.projectDirectory(project)); err != nil {
+		return nil, err
+	}
+	if usage.Git, err = directorySize(filepath.Join(m.projectDirectory(project), ".git")); err != nil {
+		return nil, err
+	}
+	if usage.Archives, err = directorySize(m.projectArchivesDirectory(project)); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// directorySize Total size of regular files in directory, zero when it does not exist
+func directorySize(directory string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(directory, func(_ string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("unable to measure %s: %w", directory, err)
+	}
+	return size, nil
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"ensemble/storage"
+	"ensemble/storage/structures"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newMaintenanceManager(t *testing.T, config Configuration) (*Manager, storage.Store) {
+	config.Path = t.TempDir()
+	store := newTestStore(t)
+	return New(config, store, nil, nil, nil), store
+}
+
+func writeFile(t *testing.T, path string, size int) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDirectorySize(t *testing.T) {
+	directory := t.TempDir()
+	writeFile(t, filepath.Join(directory, "site.yml"), 100)
+	writeFile(t, filepath.Join(directory, "roles", "common", "tasks", "main.yml"), 20)
+	//links are not followed and not counted
+	if err := os.Symlink(filepath.Join(directory, "site.yml"), filepath.Join(directory, "link.yml")); err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := directorySize(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 120 {
+		t.Fatalf("expected 120 bytes, got %d", size)
+	}
+
+	size, err = directorySize(filepath.Join(directory, "missing"))
+	if err != nil || size != 0 {
+		t.Fatalf("missing directory should have zero size, got %d: %v", size, err)
+	}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	manager, store := newMaintenanceManager(t, Configuration{})
+
+	var projects []*structures.Project
+	for _, name := range []string{"active", "deleted", "deleted-locked"} {
+		project := &structures.Project{Name: name, RepositoryUrl: "https://example.com/" + name + ".git", RepositoryBranch: structures.ProjectDefaultBranchName}
+		if err := store.ProjectInsert(project); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, filepath.Join(manager.projectDirectory(project), "site.yml"), 10)
+		writeFile(t, filepath.Join(manager.projectArchivesDirectory(project), "1.tar.gz"), 10)
+		projects = append(projects, project)
+	}
+	active, deleted, locked := projects[0], projects[1], projects[2]
+	for _, project := range []*structures.Project{deleted, locked} {
+		if err := store.ProjectDelete(project.Id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lock := manager.projectLock(locked.Id)
+	lock.Lock()
+	cleaned, err := manager.CollectGarbage()
+	lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cleaned != 1 {
+		t.Fatalf("expected one cleaned project, got %d", cleaned)
+	}
+
+	for _, project := range projects {
+		exists, err := manager.projectDirectoryExists(project)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != (project != deleted) {
+			t.Errorf("project %s directory exists: %t", project.Name, exists)
+		}
+	}
+	if _, err := os.Stat(manager.projectArchivesDirectory(deleted)); !os.IsNotExist(err) {
+		t.Errorf("archives of deleted project should be removed: %v", err)
+	}
+	if _, err := os.Stat(manager.projectArchivesDirectory(active)); err != nil {
+		t.Errorf("archives of active project should be kept: %s", err)
+	}
+
+	//files of unlocked project are removed on the next run, removed ones are not counted again
+	if cleaned, err = manager.CollectGarbage(); err != nil || cleaned != 1 {
+		t.Fatalf("expected locked project to be cleaned on the next run, got %d: %v", cleaned, err)
+	}
+	if cleaned, err = manager.CollectGarbage(); err != nil || cleaned != 0 {
+		t.Fatalf("expected nothing to clean, got %d: %v", cleaned, err)
+	}
+}
+
+func TestGitGcTimeout(t *testing.T) {
+	manager, _ := newMaintenanceManager(t, Configuration{CommandTimeout: time.Nanosecond})
+
+	project := &structures.Project{Id: "gc"}
+	if err := os.MkdirAll(manager.projectDirectory(project), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if output, err := exec.Command("git", "init", manager.projectDirectory(project)).CombinedOutput(); err != nil {
+		t.Fatalf("unable to init repository: %s %s", err, output)
+	}
+
+	if _, err := manager.GitGc(project); err == nil || !strings.Contains(err.Error(), "interrupted") {
+		t.Fatalf("git gc should be interrupted by command timeout: %v", err)
+	}
+
+	manager.config.CommandTimeout = time.Minute
+	if _, err := manager.GitGc(project); err != nil {
+		t.Fatalf("git gc failed: %s", err)
+	}
+}
+
+func TestRecloneStartsJob(t *testing.T) {
+	manager, store := newMaintenanceManager(t, Configuration{})
+
+	project := &structures.Project{
+		Name:             "reclone",
+		RepositoryUrl:    "http://127.0.0.1:1/reclone.git",
+		RepositoryBranch: structures.ProjectDefaultBranchName,
+	}
+	if err := store.ProjectInsert(project); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := manager.Reclone(project); err != nil {
+		t.Fatal(err)
+	}
+	//update log can be followed right after reclone is requested
+	if status := manager.UpdateStatus(project.Id); !status.Running {
+		t.Fatal("reclone job should be running")
+	}
+	if err := manager.Reclone(project); err != ErrUpdateRunning {
+		t.Fatalf("second reclone should fail while first one runs: %v", err)
+	}
+
+	lock := manager.projectLock(project.Id)
+	lock.Lock()
+	lock.Unlock()
+
+	if status := manager.UpdateStatus(project.Id); status.Running {
+		t.Fatal("reclone job should be finished")
+	}
+	updates, err := store.ProjectUpdateGetByProject(project.Id)
+	if err != nil || len(updates) != 1 {
+		t.Fatalf("expected one update, got %d: %v", len(updates), err)
+	}
+	if !strings.Contains(updates[0].Log, "> removing project checkout") {
+		t.Fatalf("update log does not contain reclone output: %s", updates[0].Log)
+	}
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"ensemble/storage/structures"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"regexp"
+	"strings"
+)
+
+var surveyVariablePattern = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+// PlaybookMetadata Playbook information from front matter comment
+type PlaybookMetadata struct {
+	Name        string                               `yaml:"name"`
+	Description string                               `yaml:"description"`
+	Category    string                               `yaml:"category"`
+	Tags        []string                             `yaml:"tags"`
+	Dangerous   bool                                 `yaml:"dangerous"`
+	Survey      []*structures.PlaybookSurveyQuestion `yaml:"survey"`
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// parsePlaybookMetadata Reads front matter comment placed before playbook "---" line.
+// Comment is either YAML mapping with metadata fields or plain text: name in first line and description in others.
+func parsePlaybookMetadata(content string) (*PlaybookMetadata, error) {
+	var comment []string
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "---" {
+			break
+		}
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		comment = append(comment, line[1:])
+	}
+
+	if len(comment) == 0 {
+		return &PlaybookMetadata{}, nil
+	}
+
+	var metadata PlaybookMetadata
+	var fields map[string]interface{}
+	block := strings.Join(comment, "\n")
+	if err := yaml.Unmarshal([]byte(block), &fields); err == nil && fields["name"] != nil {
+		if err := yaml.Unmarshal([]byte(block), &metadata); err != nil {
+			return nil, fmt.Errorf("invalid metadata: %w", err)
+		}
+		if err := metadata.validate(); err != nil {
+			return nil, err
+		}
+		return &metadata, nil
+	}
+
+	description := strings.Builder{}
+	for i, line := range comment {
+		if i == 0 {
+			metadata.Name = line
+			continue
+		}
+		description.WriteString(line)
+		description.WriteString("\n")
+	}
+	metadata.Description = description.String()
+
+	return &metadata, nil
+}
+
+func (m *PlaybookMetadata) validate() error {
+	for _, tag := range m.Tags {
+		if strings.Contains(tag, "|") {
+			return fmt.Errorf("tag %s should not contain |", tag)
+		}
+	}
+
+	variables := make(map[string]bool)
+	for _, question := range m.Survey {
+		if !surveyVariablePattern.MatchString(question.Variable) {
+			return fmt.Errorf("survey variable %q should be a valid variable name", question.Variable)
+		}
+		if variables[question.Variable] {
+			return fmt.Errorf("survey variable %s is duplicated", question.Variable)
+		}
+		variables[question.Variable] = true
+
+		if len(question.Type) == 0 {
+			question.Type = structures.PlaybookSurveyString
+		}
+		switch question.Type {
+		case structures.PlaybookSurveyString,
+			structures.PlaybookSurveyInteger,
+			structures.PlaybookSurveyBoolean,
+			structures.PlaybookSurveyMultiline,
+			structures.PlaybookSurveySecret:
+		case structures.PlaybookSurveyChoice:
+			if len(question.Choices) == 0 {
+				return fmt.Errorf("survey variable %s should have choices", question.Variable)
+			}
+		default:
+			return fmt.Errorf("survey variable %s has unknown type %s", question.Variable, question.Type)
+		}
+		if question.Min != nil && question.Max != nil && *question.Min > *question.Max {
+			return fmt.Errorf("survey variable %s min is greater than max", question.Variable)
+		}
+	}
+
+	return nil
+}
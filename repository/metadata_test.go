@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"ensemble/storage/structures"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePlaybookMetadataComment(t *testing.T) {
+	content := "\n#Deploy application\n#Updates code\n#and restarts services\n---\n- hosts: all\n"
+
+	metadata, err := parsePlaybookMetadata(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Name != "Deploy application" {
+		t.Errorf("unexpected name %q", metadata.Name)
+	}
+	if metadata.Description != "Updates code\nand restarts services\n" {
+		t.Errorf("unexpected description %q", metadata.Description)
+	}
+}
+
+func TestParsePlaybookMetadataYaml(t *testing.T) {
+	content := `# name: Deploy application
+# category: web
+# tags: [deploy, app]
+# dangerous: true
+# survey:
+#   - variable: version
+#     label: Version
+#     required: true
+#   - variable: replicas
+#     type: integer
+#     min: 1
+#     max: 10
+#   - variable: environment
+#     type: choice
+#     choices: [stage, prod]
+---
+- hosts: all
+`
+
+	metadata, err := parsePlaybookMetadata(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Name != "Deploy application" || metadata.Category != "web" || !metadata.Dangerous {
+		t.Errorf("unexpected metadata %+v", metadata)
+	}
+	if len(metadata.Tags) != 2 {
+		t.Errorf("unexpected tags %v", metadata.Tags)
+	}
+	if len(metadata.Survey) != 3 {
+		t.Fatalf("unexpected survey %v", metadata.Survey)
+	}
+	if metadata.Survey[0].Type != structures.PlaybookSurveyString {
+		t.Errorf("survey question type should default to string, got %s", metadata.Survey[0].Type)
+	}
+	if metadata.Survey[1].Max == nil || *metadata.Survey[1].Max != 10 {
+		t.Errorf("unexpected survey question max %v", metadata.Survey[1].Max)
+	}
+}
+
+func TestParsePlaybookMetadataInvalidSurvey(t *testing.T) {
+	content := "# name: Deploy\n# survey:\n#   - variable: environment\n#     type: choice\n---\n"
+
+	if _, err := parsePlaybookMetadata(content); err == nil {
+		t.Error("choice question without choices should be rejected")
+	}
+}
+
+func TestPlaybooksKeepInvalidMetadata(t *testing.T) {
+	directory := t.TempDir()
+	project := &structures.Project{Id: "project"}
+	content := "# name: Deploy\n# survey:\n#   - variable: environment\n#     type: choice\n---\n"
+	if err := os.MkdirAll(filepath.Join(directory, project.Id), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(directory, project.Id, "deploy.yml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manager{config: Configuration{Path: directory}}
+	layout, _, err := readLayout(m.projectDirectory(project))
+	if err != nil {
+		t.Fatal(err)
+	}
+	playbooks, err := m.playbooks(project, layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(playbooks) != 1 {
+		t.Fatalf("playbook with invalid metadata should be kept, got %d playbooks", len(playbooks))
+	}
+	playbook := playbooks[0]
+	if playbook.Filename != "deploy.yml" || len(playbook.Name) != 0 || len(playbook.Survey) != 0 {
+		t.Errorf("playbook should fall back to file name without survey: %+v", playbook)
+	}
+	if len(playbook.MetadataError) == 0 {
+		t.Error("metadata error should be recorded")
+	}
+}
@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"context"
+	"ensemble/storage/structures"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	lockedPollInterval = 5 * time.Second
+	lockedWaitDefault  = time.Hour
+	retryDelayInitial  = time.Minute
+	retryDelayMax      = 30 * time.Minute
+	retryAttemptsMax   = 6
+)
+
+var ErrUpdateDeferred = errors.New("project update deferred, project has locked playbooks")
+
+type updateRetry struct {
+	attempt int
+	timer   *time.Timer
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// applyUpdatePolicy Handles locked playbooks with project update policy, ErrUpdateDeferred means update should not proceed
+func (m *Manager) applyUpdatePolicy(ctx context.Context, project *structures.Project, output *updateJob) error {
+	if !m.store.ProjectHasLockedPlaybooks(project.Id) {
+		m.resetRetry(project.Id)
+		return nil
+	}
+
+	switch project.UpdatePolicy {
+	case structures.ProjectUpdatePolicyWait:
+		wait := m.lockedWait()
+		output.WriteString(fmt.Sprintf("> project has locked playbooks, waiting up to %s for runs to finish\n\n", wait))
+
+		//project lock is held while waiting, so waiting is limited
+		deadline := time.NewTimer(wait)
+		defer deadline.Stop()
+		ticker := time.NewTicker(lockedPollInterval)
+		defer ticker.Stop()
+
+		for m.store.ProjectHasLockedPlaybooks(project.Id) {
+			select {
+			case <-ctx.Done():
+				output.WriteString("> waiting for runs interrupted, update skipped\n")
+				m.insertDeferred(project, output.String())
+				return fmt.Errorf("waiting for locked playbooks interrupted: %w", ctx.Err())
+			case <-deadline.C:
+				output.WriteString(fmt.Sprintf("> playbooks still locked after %s, update skipped\n", wait))
+				m.insertDeferred(project, output.String())
+				return ErrUpdateDeferred
+			case <-ticker.C:
+			}
+		}
+
+		output.WriteString("> playbooks unlocked, updating\n\n")
+		return nil
+
+	case structures.ProjectUpdatePolicyRetry:
+		attempt := m.scheduleRetry(project.Id)
+		if attempt == 0 {
+			output.WriteString(fmt.Sprintf("> project has locked playbooks, update skipped after %d retries\n", retryAttemptsMax))
+		} else {
+			output.WriteString(fmt.Sprintf("> project has locked playbooks, retry %d of %d in %s\n", attempt, retryAttemptsMax, retryDelay(attempt)))
+		}
+		m.insertDeferred(project, output.String())
+		return ErrUpdateDeferred
+
+	default:
+		output.WriteString("> project has locked playbooks, update skipped\n")
+		m.insertDeferred(project, output.String())
+		return ErrUpdateDeferred
+	}
+}
+
+// insertDeferred Records update attempt which was not performed, so stale checkout can be explained
+func (m *Manager) insertDeferred(project *structures.Project, output string) {
+	revision, err := m.revision(project)
+	if err != nil {
+		revision = "unknown revision"
+	}
+
+	update := structures.ProjectUpdate{
+		ProjectId: project.Id,
+		Date:      time.Now(),
+		Success:   false,
+		Deferred:  true,
+		Revision:  redactCredentials(project, revision),
+		Log:       redactCredentials(project, output),
+	}
+	if err := m.store.ProjectUpdateInsert(&update); err != nil {
+		log.Errorf("unable to save deferred project update %s: %s", project.Id, err)
+	}
+}
+
+// scheduleRetry Starts timer for the next update attempt, returns attempt number or 0 when attempts are exhausted
+func (m *Manager) scheduleRetry(projectId string) int {
+	m.jobsMutex.Lock()
+	defer m.jobsMutex.Unlock()
+
+	retry, ok := m.retries[projectId]
+	if !ok {
+		retry = &updateRetry{}
+		m.retries[projectId] = retry
+	}
+	if retry.timer != nil {
+		retry.timer.Stop()
+	}
+
+	retry.attempt++
+	if retry.attempt > retryAttemptsMax {
+		delete(m.retries, projectId)
+		return 0
+	}
+
+	attempt := retry.attempt
+	retry.timer = time.AfterFunc(retryDelay(attempt), func() {
+		m.retryUpdate(projectId, attempt)
+	})
+	return attempt
+}
+
+// rescheduleRetry Repeats attempt later, returns false when retry was reset or replaced by newer attempt
+func (m *Manager) rescheduleRetry(projectId string, attempt int, delay time.Duration) bool {
+	m.jobsMutex.Lock()
+	defer m.jobsMutex.Unlock()
+
+	retry, ok := m.retries[projectId]
+	if !ok || retry.attempt != attempt {
+		return false
+	}
+	retry.timer = time.AfterFunc(delay, func() {
+		m.retryUpdate(projectId, attempt)
+	})
+	return true
+}
+
+// retryCurrent Checks that attempt was not reset or replaced by newer attempt while its timer fired
+func (m *Manager) retryCurrent(projectId string, attempt int) bool {
+	m.jobsMutex.Lock()
+	defer m.jobsMutex.Unlock()
+
+	retry, ok := m.retries[projectId]
+	return ok && retry.attempt == attempt
+}
+
+func (m *Manager) resetRetry(projectId string) {
+	m.jobsMutex.Lock()
+	defer m.jobsMutex.Unlock()
+
+	if retry, ok := m.retries[projectId]; ok {
+		retry.timer.Stop()
+		delete(m.retries, projectId)
+	}
+}
+
+func (m *Manager) retryUpdate(projectId string, attempt int) {
+	if !m.retryCurrent(projectId, attempt) {
+		return
+	}
+
+	//project could be changed or deleted while waiting
+	project, err := m.store.ProjectGet(projectId)
+	if err != nil {
+		log.Warnf("unable to retry project %s update: %s", projectId, err)
+		m.resetRetry(projectId)
+		return
+	}
+
+	log.Infof("retry project %s update", project.Name)
+
+	err = m.UpdateAsync(project)
+	if errors.Is(err, ErrUpdateRunning) {
+		//running update applies policy itself and resets or replaces this attempt,
+		//maintenance jobs do not, so attempt is repeated until project is free
+		if m.rescheduleRetry(projectId, attempt, retryDelayInitial) {
+			log.Infof("project %s is busy, retry %d postponed", project.Name, attempt)
+		}
+		return
+	}
+	if err != nil {
+		log.Warnf("unable to retry project %s update: %s", project.Name, err)
+		m.resetRetry(projectId)
+	}
+}
+
+// lockedWait Maximum time to wait for locked playbooks with wait policy
+func (m *Manager) lockedWait() time.Duration {
+	if m.config.LockedWaitTimeout > 0 {
+		return m.config.LockedWaitTimeout
+	}
+	return lockedWaitDefault
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// retryDelay Exponential backoff starting from retryDelayInitial
+func retryDelay(attempt int) time.Duration {
+	delay := retryDelayInitial
+	for i := 1; i < attempt && delay < retryDelayMax; i++ {
+		delay *= 2
+	}
+	if delay > retryDelayMax {
+		delay = retryDelayMax
+	}
+	return delay
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"ensemble/storage"
+	"ensemble/storage/structures"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newPolicyManager(t *testing.T, policy int) (*Manager, storage.Store, *structures.Project) {
+	directory := t.TempDir()
+	store := newTestStore(t)
+
+	project := &structures.Project{
+		Name:             "locked",
+		RepositoryUrl:    "http://127.0.0.1:1/locked.git",
+		RepositoryBranch: structures.ProjectDefaultBranchName,
+		UpdatePolicy:     policy,
+	}
+	if err := store.ProjectInsert(project); err != nil {
+		t.Fatal(err)
+	}
+	playbook := &structures.Playbook{ProjectId: project.Id, Filename: "site.yml"}
+	if err := store.PlaybookInsert(playbook); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PlaybookLock(playbook.Id, true); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := New(Configuration{Path: directory, LockedWaitTimeout: 50 * time.Millisecond}, store, nil, nil, nil)
+	return manager, store, project
+}
+
+func deferredUpdates(t *testing.T, store storage.Store, projectId string) []*structures.ProjectUpdate {
+	updates, err := store.ProjectUpdateGetByProject(projectId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, update := range updates {
+		if !update.Deferred || update.Success {
+			t.Errorf("update should be recorded as deferred: %+v", update)
+		}
+	}
+	return updates
+}
+
+func TestRetryDelay(t *testing.T) {
+	expected := map[int]time.Duration{
+		1: time.Minute,
+		2: 2 * time.Minute,
+		3: 4 * time.Minute,
+		5: 16 * time.Minute,
+		6: 30 * time.Minute,
+		9: 30 * time.Minute,
+	}
+	for attempt, delay := range expected {
+		if actual := retryDelay(attempt); actual != delay {
+			t.Errorf("attempt %d: expected delay %s, got %s", attempt, delay, actual)
+		}
+	}
+}
+
+func TestUpdatePolicyUnlocked(t *testing.T) {
+	manager, store, project := newPolicyManager(t, structures.ProjectUpdatePolicyRetry)
+	manager.scheduleRetry(project.Id)
+
+	playbooks, err := store.PlaybookGetByProject(project.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PlaybookLock(playbooks[0].Id, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := manager.applyUpdatePolicy(context.Background(), project, &updateJob{}); err != nil {
+		t.Fatalf("update of unlocked project should proceed: %s", err)
+	}
+	if manager.retryCurrent(project.Id, 1) {
+		t.Error("retry should be reset when playbooks are unlocked")
+	}
+	if updates := deferredUpdates(t, store, project.Id); len(updates) != 0 {
+		t.Errorf("expected no deferred updates, got %d", len(updates))
+	}
+}
+
+func TestUpdatePolicySkip(t *testing.T) {
+	manager, store, project := newPolicyManager(t, structures.ProjectUpdatePolicySkip)
+
+	err := manager.applyUpdatePolicy(context.Background(), project, &updateJob{})
+	if !errors.Is(err, ErrUpdateDeferred) {
+		t.Fatalf("expected deferred update, got %v", err)
+	}
+	if updates := deferredUpdates(t, store, project.Id); len(updates) != 1 {
+		t.Errorf("expected one deferred update, got %d", len(updates))
+	}
+}
+
+func TestUpdatePolicyWaitTimeout(t *testing.T) {
+	manager, store, project := newPolicyManager(t, structures.ProjectUpdatePolicyWait)
+
+	err := manager.applyUpdatePolicy(context.Background(), project, &updateJob{})
+	if !errors.Is(err, ErrUpdateDeferred) {
+		t.Fatalf("expected deferred update after wait timeout, got %v", err)
+	}
+	updates := deferredUpdates(t, store, project.Id)
+	if len(updates) != 1 {
+		t.Fatalf("expected one deferred update, got %d", len(updates))
+	}
+	if !strings.Contains(updates[0].Log, "still locked") {
+		t.Errorf("update log should explain timeout: %s", updates[0].Log)
+	}
+}
+
+func TestUpdatePolicyWaitCancelled(t *testing.T) {
+	manager, store, project := newPolicyManager(t, structures.ProjectUpdatePolicyWait)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := manager.applyUpdatePolicy(ctx, project, &updateJob{})
+	if err == nil || errors.Is(err, ErrUpdateDeferred) {
+		t.Fatalf("expected interrupted wait, got %v", err)
+	}
+	if updates := deferredUpdates(t, store, project.Id); len(updates) != 1 {
+		t.Errorf("expected one deferred update, got %d", len(updates))
+	}
+}
+
+func TestUpdatePolicyRetry(t *testing.T) {
+	manager, store, project := newPolicyManager(t, structures.ProjectUpdatePolicyRetry)
+	defer manager.resetRetry(project.Id)
+
+	for attempt := 1; attempt <= retryAttemptsMax+1; attempt++ {
+		err := manager.applyUpdatePolicy(context.Background(), project, &updateJob{})
+		if !errors.Is(err, ErrUpdateDeferred) {
+			t.Fatalf("attempt %d: expected deferred update, got %v", attempt, err)
+		}
+		if attempt <= retryAttemptsMax && !manager.retryCurrent(project.Id, attempt) {
+			t.Fatalf("attempt %d should be scheduled", attempt)
+		}
+	}
+	if manager.retryCurrent(project.Id, retryAttemptsMax+1) {
+		t.Error("retries should stop after last attempt")
+	}
+	if updates := deferredUpdates(t, store, project.Id); len(updates) != retryAttemptsMax+1 {
+		t.Errorf("expected %d deferred updates, got %d", retryAttemptsMax+1, len(updates))
+	}
+}
+
+func TestRetryUpdateWhileRunning(t *testing.T) {
+	manager, _, project := newPolicyManager(t, structures.ProjectUpdatePolicyRetry)
+	defer manager.resetRetry(project.Id)
+
+	attempt := manager.scheduleRetry(project.Id)
+	lock := manager.projectLock(project.Id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	manager.retryUpdate(project.Id, attempt)
+	if !manager.retryCurrent(project.Id, attempt) {
+		t.Fatal("attempt should be kept while project is busy")
+	}
+
+	//stale timer of replaced attempt does nothing
+	next := manager.scheduleRetry(project.Id)
+	manager.retryUpdate(project.Id, attempt)
+	if !manager.retryCurrent(project.Id, next) {
+		t.Error("stale retry should not change newer attempt")
+	}
+}
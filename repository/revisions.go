@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"ensemble/storage/structures"
+	"errors"
+	"fmt"
+	"github.com/alessio/shellescape"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	revisionsLimit   = 50
+	revisionsSep     = "\x1f"
+	revisionsDateFmt = time.RFC3339
+)
+
+var commitPattern = regexp.MustCompile("^[0-9a-fA-F]{4,40}$")
+
+type Commit struct {
+	Hash      string
+	ShortHash string
+	Author    string
+	Date      time.Time
+	Subject   string
+}
+
+type Tag struct {
+	Name    string
+	Hash    string
+	Date    time.Time
+	Subject string
+}
+
+type Revisions struct {
+	Current string
+	Commits []*Commit
+	Tags    []*Tag
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// ValidateRevision Checks project revision settings
+func ValidateRevision(p *structures.Project) error {
+	if !p.IsGit() {
+		return nil
+	}
+	switch p.RevisionType {
+	case structures.ProjectRevisionBranch:
+		if strings.HasPrefix(p.RepositoryBranch, "-") {
+			return errors.New("branch should not start with -")
+		}
+	case structures.ProjectRevisionTag:
+		if len(p.Revision) == 0 {
+			return errors.New("tag should not be empty")
+		}
+		//quoting does not stop git from reading it as an option
+		if strings.HasPrefix(p.Revision, "-") {
+			return errors.New("tag should not start with -")
+		}
+	case structures.ProjectRevisionCommit:
+		if !commitPattern.MatchString(p.Revision) {
+			return errors.New("commit should be a SHA")
+		}
+	case structures.ProjectRevisionTagPattern:
+		if len(p.Revision) == 0 {
+			return errors.New("tag pattern should not be empty")
+		}
+		if strings.HasPrefix(p.Revision, "-") {
+			return errors.New("tag pattern should not start with -")
+		}
+	default:
+		return errors.New("unknown revision type")
+	}
+	return nil
+}
+
+// Revisions Recent commits and tags of project checkout
+func (m *Manager) Revisions(p *structures.Project) (*Revisions, error) {
+	exists, err := m.projectRepositoryExists(p)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.New("project repository not found, update project first")
+	}
+
+	revisions := &Revisions{}
+
+	currentResult, err := m.executeCommand("git rev-parse HEAD", m.projectDirectory(p))
+	if err != nil {
+		return nil, err
+	}
+	if currentResult.success {
+		revisions.Current = strings.TrimSpace(currentResult.output)
+	}
+
+	commitsCommand := fmt.Sprintf("git log -n %d --date-order --branches --remotes --tags --format=%s", revisionsLimit, shellescape.Quote("%H%x1f%h%x1f%an%x1f%aI%x1f%s"))
+	commitsResult, err := m.executeCommand(commitsCommand, m.projectDirectory(p))
+	if err != nil {
+		return nil, err
+	}
+	if !commitsResult.success {
+		return nil, errors.New("unable to execute git log")
+	}
+	for _, line := range outputLines(commitsResult.output) {
+		fields := strings.SplitN(line, revisionsSep, 5)
+		if len(fields) != 5 {
+			continue
+		}
+		date, _ := time.Parse(revisionsDateFmt, fields[3])
+		revisions.Commits = append(revisions.Commits, &Commit{
+			Hash:      fields[0],
+			ShortHash: fields[1],
+			Author:    fields[2],
+			Date:      date,
+			Subject:   fields[4],
+		})
+	}
+
+	tagsCommand := fmt.Sprintf("git for-each-ref --sort=-creatordate --count=%d --format=%s refs/tags", revisionsLimit, shellescape.Quote("%(refname:short)%1f%(objectname)%1f%(*objectname)%1f%(creatordate:iso-strict)%1f%(subject)"))
+	tagsResult, err := m.executeCommand(tagsCommand, m.projectDirectory(p))
+	if err != nil {
+		return nil, err
+	}
+	if !tagsResult.success {
+		return nil, errors.New("unable to execute git for-each-ref")
+	}
+	for _, line := range outputLines(tagsResult.output) {
+		fields := strings.SplitN(line, revisionsSep, 5)
+		if len(fields) != 5 {
+			continue
+		}
+		hash := fields[1]
+		if len(fields[2]) != 0 {
+			//annotated tag, use tagged commit
+			hash = fields[2]
+		}
+		date, _ := time.Parse(revisionsDateFmt, fields[3])
+		revisions.Tags = append(revisions.Tags, &Tag{
+			Name:    fields[0],
+			Hash:    hash,
+			Date:    date,
+			Subject: fields[4],
+		})
+	}
+
+	return revisions, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// latestTag Latest tag (by version sort) matching glob pattern
+func (m *Manager) latestTag(p *structures.Project, pattern string) (string, error) {
+	command := fmt.Sprintf("git tag --list --sort=-v:refname -- %s", shellescape.Quote(pattern))
+	result, err := m.executeCommand(command, m.projectDirectory(p))
+	if err != nil {
+		return "", err
+	}
+	if !result.success {
+		return "", errors.New("unable to execute git tag")
+	}
+	lines := outputLines(result.output)
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return lines[0], nil
+}
+
+func outputLines(output string) []string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) != 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"ensemble/storage/structures"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestValidateRevision(t *testing.T) {
+	tests := []struct {
+		revisionType int
+		branch       string
+		revision     string
+		valid        bool
+	}{
+		{structures.ProjectRevisionBranch, "main", "", true},
+		{structures.ProjectRevisionBranch, "--orphan=x", "", false},
+		{structures.ProjectRevisionTag, "main", "v1.0", true},
+		{structures.ProjectRevisionTag, "main", "--detach", false},
+		{structures.ProjectRevisionTag, "main", "", false},
+		{structures.ProjectRevisionTagPattern, "main", "v1.*", true},
+		{structures.ProjectRevisionTagPattern, "main", "--contains=HEAD", false},
+		{structures.ProjectRevisionCommit, "main", "4f2a9c1e", true},
+		{structures.ProjectRevisionCommit, "main", "-4f2a9c1e", false},
+	}
+	for _, test := range tests {
+		project := &structures.Project{
+			RepositoryUrl:    "https://example.com/repo.git",
+			RepositoryBranch: test.branch,
+			RevisionType:     test.revisionType,
+			Revision:         test.revision,
+		}
+		if err := ValidateRevision(project); (err == nil) != test.valid {
+			t.Errorf("revision type %d branch %q revision %q: unexpected result %v", test.revisionType, test.branch, test.revision, err)
+		}
+	}
+}
+
+func TestLatestTagPatternIsNotOption(t *testing.T) {
+	manager := New(Configuration{Path: t.TempDir()}, nil, nil, nil, nil)
+	project := &structures.Project{Id: "tags"}
+
+	directory := manager.projectDirectory(project)
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "initial"},
+		{"tag", "v1.0"},
+		{"tag", "v1.10"},
+		{"tag", "v1.2"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = directory
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s %s", args, err, output)
+		}
+	}
+
+	if tag, err := manager.latestTag(project, "v1.*"); err != nil || tag != "v1.10" {
+		t.Fatalf("expected v1.10, got %q: %v", tag, err)
+	}
+	if tag, err := manager.latestTag(project, "--contains=HEAD"); err != nil || len(tag) != 0 {
+		t.Fatalf("pattern should not be read as option, got %q: %v", tag, err)
+	}
+}
@@ -0,0 +1,565 @@
+package repository
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"ensemble/storage"
+	"ensemble/storage/structures"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ArchiveMaxSize        = 256 << 20
+	archiveExtractMaxSize = 1 << 30
+)
+
+///////////////////////////////////////////////////////////////////////////////
+
+// ArchiveExtension Normalized extension of supported archive, empty for unsupported files
+func ArchiveExtension(filename string) string {
+	name := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return ".tar.gz"
+	case strings.HasSuffix(name, ".zip"):
+		return ".zip"
+	default:
+		return ""
+	}
+}
+
+// ValidateSource Checks content source settings of non-git project
+func (m *Manager) ValidateSource(p *structures.Project) error {
+	switch p.SourceType {
+	case structures.ProjectSourceGit, structures.ProjectSourceArchive:
+		return nil
+	case structures.ProjectSourceLocal:
+		_, err := m.localSourcePath(p)
+		return err
+	default:
+		return errors.New("unknown project source")
+	}
+}
+
+// ArchiveSave Stores uploaded archive as the new version of archive project
+func (m *Manager) ArchiveSave(p *structures.Project, userId, filename string, content io.Reader) (*structures.ProjectArchive, error) {
+	if p.SourceType != structures.ProjectSourceArchive {
+		return nil, errors.New("project is not an archive project")
+	}
+	if len(ArchiveExtension(filename)) == 0 {
+		return nil, errors.New("archive should be a .tar.gz, .tgz or .zip file")
+	}
+
+	archive := &structures.ProjectArchive{
+		Id:        storage.NewId(),
+		ProjectId: p.Id,
+		UserId:    userId,
+		Date:      time.Now(),
+		Filename:  filepath.Base(filename),
+	}
+
+	if err := os.MkdirAll(m.projectArchivesDirectory(p), 0777); err != nil {
+		return nil, err
+	}
+	archivePath := m.archivePath(archive)
+
+	file, err := os.Create(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(content, ArchiveMaxSize+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size > ArchiveMaxSize {
+		err = fmt.Errorf("archive should not be larger than %d MB", ArchiveMaxSize>>20)
+	}
+	if err == nil {
+		err = checkArchive(archivePath)
+	}
+	if err != nil {
+		_ = os.Remove(archivePath)
+		return nil, err
+	}
+
+	archive.Size = size
+	archive.Checksum = hex.EncodeToString(hash.Sum(nil))
+
+	if err := m.store.ProjectArchiveInsert(archive); err != nil {
+		_ = os.Remove(archivePath)
+		return nil, err
+	}
+	return archive, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// updateSource Replaces project directory with content of uploaded archive or local directory
+func (m *Manager) updateSource(project *structures.Project, revision *updateRevision, changes *structures.ProjectUpdateChanges, output *updateJob) error {
+	if previous, err := os.ReadFile(m.projectSourceFile(project)); err == nil {
+		revision.from = strings.TrimSpace(string(previous))
+	}
+
+	before, err := directoryChecksums(m.projectDirectory(project))
+	if err != nil {
+		return err
+	}
+
+	staging, err := os.MkdirTemp(m.config.Path, ".staging-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	root := staging
+
+	switch project.SourceType {
+	case structures.ProjectSourceArchive:
+		archive, err := m.projectArchive(project)
+		if err != nil {
+			return err
+		}
+		output.WriteString(fmt.Sprintf("> unpack archive %s\n\nsha256 %s\n\n", archive.Filename, archive.Checksum))
+		if err := extractArchive(m.archivePath(archive), staging); err != nil {
+			return fmt.Errorf("unable to unpack archive: %w", err)
+		}
+		if root, err = archiveRoot(staging); err != nil {
+			return err
+		}
+		revision.title = sourceRevisionTitle(archive.Filename, archive.Checksum)
+		revision.to = archive.Checksum
+
+	case structures.ProjectSourceLocal:
+		source, err := m.localSourcePath(project)
+		if err != nil {
+			return err
+		}
+		output.WriteString(fmt.Sprintf("> copy directory %s\n\n", source))
+		if err := copyDirectory(source, staging); err != nil {
+			return fmt.Errorf("unable to copy directory: %w", err)
+		}
+
+	default:
+		return errors.New("unknown project source")
+	}
+
+	after, err := directoryChecksums(root)
+	if err != nil {
+		return err
+	}
+	if project.SourceType == structures.ProjectSourceLocal {
+		revision.to = contentChecksum(after)
+		revision.title = sourceRevisionTitle(project.SourcePath, revision.to)
+	}
+
+	changes.Files = diffChecksums(before, after)
+	output.WriteString(fmt.Sprintf("> %d files changed\n\n", len(changes.Files)))
+
+	if err := os.RemoveAll(m.projectDirectory(project)); err != nil {
+		return err
+	}
+	if err := os.Rename(root, m.projectDirectory(project)); err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.projectSourceFile(project), []byte(revision.to), 0600); err != nil {
+		return err
+	}
+
+	output.WriteString(fmt.Sprintf("> current revision: %s\n", revision.title))
+
+	return nil
+}
+
+// projectArchive Pinned archive version of the project or the latest uploaded one
+func (m *Manager) projectArchive(p *structures.Project) (*structures.ProjectArchive, error) {
+	var archive *structures.ProjectArchive
+	var err error
+	if len(p.Revision) != 0 {
+		archive, err = m.store.ProjectArchiveGet(p.Revision)
+		if err == nil && archive.ProjectId != p.Id {
+			err = sql.ErrNoRows
+		}
+	} else {
+		archive, err = m.store.ProjectArchiveGetProjectLatest(p.Id)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("project archive is not uploaded")
+	}
+	return archive, err
+}
+
+// localSourcePath Directory of local project, it should be inside of configured local root
+func (m *Manager) localSourcePath(p *structures.Project) (string, error) {
+	if len(m.config.LocalRoot) == 0 {
+		return "", errors.New("local directory projects are disabled, ENSEMBLE_LOCAL_ROOT is not set")
+	}
+	if !filepath.IsAbs(p.SourcePath) {
+		return "", errors.New("local directory should be an absolute path")
+	}
+
+	exists, err := directoryExists(p.SourcePath)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("local directory %s does not exist", p.SourcePath)
+	}
+
+	//symlinks are resolved, so they can not lead outside of local root
+	source, err := filepath.EvalSymlinks(p.SourcePath)
+	if err != nil {
+		return "", err
+	}
+	root, err := filepath.EvalSymlinks(m.config.LocalRoot)
+	if err != nil {
+		return "", err
+	}
+	relative, err := filepath.Rel(root, source)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, "../") {
+		return "", fmt.Errorf("local directory should be inside of %s", m.config.LocalRoot)
+	}
+	return source, nil
+}
+
+func (m *Manager) projectSourceFile(p *structures.Project) string {
+	return fmt.Sprintf("%s/%s.source", m.config.Path, p.Id)
+}
+
+func (m *Manager) projectArchivesDirectory(p *structures.Project) string {
+	return fmt.Sprintf("%s/archives/%s", m.config.Path, p.Id)
+}
+
+func (m *Manager) archivePath(archive *structures.ProjectArchive) string {
+	return fmt.Sprintf("%s/archives/%s/%s%s", m.config.Path, archive.ProjectId, archive.Id, ArchiveExtension(archive.Filename))
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func sourceRevisionTitle(name, checksum string) string {
+	title := fmt.Sprintf("%s sha256:%s", name, checksum)
+	if len([]rune(title)) > structures.ProjectUpdateRevisionMaxLength {
+		title = fmt.Sprintf("...%s", string([]rune(title)[len([]rune(title))-structures.ProjectUpdateRevisionMaxLength:]))
+	}
+	return title
+}
+
+// checkArchive Makes sure uploaded file can be unpacked
+func checkArchive(archivePath string) error {
+	directory, err := os.MkdirTemp("", "ensemble-archive-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(directory)
+
+	if err := extractArchive(archivePath, directory); err != nil {
+		return fmt.Errorf("unable to unpack archive: %w", err)
+	}
+	return nil
+}
+
+// extractArchive Unpacks regular files and directories, other entries like symlinks are skipped
+func extractArchive(archivePath, directory string) error {
+	switch ArchiveExtension(archivePath) {
+	case ".tar.gz":
+		return extractTarGz(archivePath, directory)
+	case ".zip":
+		return extractZip(archivePath, directory)
+	default:
+		return errors.New("unknown archive type")
+	}
+}
+
+func extractTarGz(archivePath, directory string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	var total int64
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := archiveEntryPath(directory, header.Name)
+		if len(target) == 0 {
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0777); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			written, err := writeArchiveFile(target, reader, header.FileInfo().Mode(), archiveExtractMaxSize-total)
+			if err != nil {
+				return err
+			}
+			total += written
+		}
+	}
+}
+
+func extractZip(archivePath, directory string) error {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	var total int64
+	for _, file := range reader.File {
+		target := archiveEntryPath(directory, file.Name)
+		if len(target) == 0 {
+			continue
+		}
+
+		if file.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0777); err != nil {
+				return err
+			}
+			continue
+		}
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		content, err := file.Open()
+		if err != nil {
+			return err
+		}
+		written, err := writeArchiveFile(target, content, file.Mode(), archiveExtractMaxSize-total)
+		content.Close()
+		if err != nil {
+			return err
+		}
+		total += written
+	}
+	return nil
+}
+
+// archiveEntryPath Path of archive entry inside of directory, entries can not point outside of it
+func archiveEntryPath(directory, name string) string {
+	relative := strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, "\\", "/")), "/")
+	if len(relative) == 0 {
+		return ""
+	}
+	return filepath.Join(directory, filepath.FromSlash(relative))
+}
+
+func writeArchiveFile(target string, content io.Reader, mode fs.FileMode, limit int64) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+		return 0, err
+	}
+
+	//executable bit is kept for inventory scripts
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0600)
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(file, io.LimitReader(content, limit+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written > limit {
+		err = fmt.Errorf("unpacked archive should not be larger than %d MB", archiveExtractMaxSize>>20)
+	}
+	return written, err
+}
+
+// archiveRoot Archives with single top level directory are unpacked without it
+func archiveRoot(directory string) (string, error) {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		return filepath.Join(directory, entries[0].Name()), nil
+	}
+	return directory, nil
+}
+
+// copyDirectory Copies directory content without .git, symlinks to files inside of source are copied
+// as relative links, symlinks leading outside of source or to missing files are skipped
+func copyDirectory(source, target string) error {
+	root, err := filepath.EvalSymlinks(source)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		if relative == "." {
+			return nil
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		destination := filepath.Join(target, relative)
+
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(destination, 0777)
+		case entry.Type()&fs.ModeSymlink != 0:
+			link, ok := sourceLink(root, filePath)
+			if !ok {
+				log.Warnf("symlink %s leads outside of %s, skipped", relative, source)
+				return nil
+			}
+			return os.Symlink(link, destination)
+		case entry.Type().IsRegular():
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			content, err := os.Open(filePath)
+			if err != nil {
+				return err
+			}
+			defer content.Close()
+			_, err = writeArchiveFile(destination, content, info.Mode(), info.Size())
+			return err
+		default:
+			return nil
+		}
+	})
+}
+
+// sourceLink Target of symlink relative to its directory, false when target is missing or outside of root
+func sourceLink(root, linkPath string) (string, bool) {
+	resolved, err := filepath.EvalSymlinks(linkPath)
+	if err != nil {
+		return "", false
+	}
+	inside, err := filepath.Rel(root, resolved)
+	if err != nil || inside == ".." || strings.HasPrefix(inside, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	link, err := filepath.Rel(filepath.Dir(linkPath), resolved)
+	if err != nil {
+		return "", false
+	}
+	return link, true
+}
+
+// directoryChecksums Content checksum of each file by slash separated relative path
+func directoryChecksums(directory string) (map[string]string, error) {
+	checksums := make(map[string]string)
+
+	exists, err := directoryExists(directory)
+	if err != nil || !exists {
+		return checksums, err
+	}
+
+	err = filepath.WalkDir(directory, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relative, err := filepath.Rel(directory, filePath)
+		if err != nil {
+			return err
+		}
+
+		if entry.Type()&fs.ModeSymlink != 0 {
+			link, err := os.Readlink(filePath)
+			if err != nil {
+				return err
+			}
+			checksums[filepath.ToSlash(relative)] = "link:" + link
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		hash := sha256.New()
+		if _, err := io.Copy(hash, file); err != nil {
+			return err
+		}
+		checksums[filepath.ToSlash(relative)] = hex.EncodeToString(hash.Sum(nil))
+		return nil
+	})
+	return checksums, err
+}
+
+// contentChecksum Single checksum of directory content
+func contentChecksum(checksums map[string]string) string {
+	paths := make([]string, 0, len(checksums))
+	for filePath := range checksums {
+		paths = append(paths, filePath)
+	}
+	sort.Strings(paths)
+
+	hash := sha256.New()
+	for _, filePath := range paths {
+		_, _ = fmt.Fprintf(hash, "%s\x00%s\n", filePath, checksums[filePath])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func diffChecksums(before, after map[string]string) []structures.ProjectUpdateFile {
+	var files []structures.ProjectUpdateFile
+	for filePath, checksum := range after {
+		previous, exists := before[filePath]
+		if !exists {
+			files = append(files, structures.ProjectUpdateFile{Status: "A", Path: filePath})
+		} else if previous != checksum {
+			files = append(files, structures.ProjectUpdateFile{Status: "M", Path: filePath})
+		}
+	}
+	for filePath := range before {
+		if _, exists := after[filePath]; !exists {
+			files = append(files, structures.ProjectUpdateFile{Status: "D", Path: filePath})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files
+}
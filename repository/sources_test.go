@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"archive/zip"
+	"ensemble/storage/structures"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExtractZipStaysInsideDirectory(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "bundle.zip")
+
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := zip.NewWriter(file)
+	for _, name := range []string{"bundle/site.yml", "bundle/inventories/main.yml", "../../escape.yml"} {
+		entry, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := entry.Write([]byte("---\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	directory := filepath.Join(t.TempDir(), "extract")
+	if err := extractArchive(archivePath, directory); err != nil {
+		t.Fatal(err)
+	}
+
+	checksums, err := directoryChecksums(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for file := range checksums {
+		files = append(files, file)
+	}
+	if len(files) != 3 {
+		t.Errorf("unexpected files %v", files)
+	}
+	if _, err := os.Stat(filepath.Join(directory, "escape.yml")); err != nil {
+		t.Errorf("escaping entry should be unpacked inside directory: %s", err)
+	}
+
+	root, err := archiveRoot(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != directory {
+		t.Errorf("archive with several top level entries should be unpacked as is, got %s", root)
+	}
+}
+
+func TestDiffChecksums(t *testing.T) {
+	before := map[string]string{"site.yml": "1", "old.yml": "2", "vars/main.yml": "3"}
+	after := map[string]string{"site.yml": "1", "new.yml": "4", "vars/main.yml": "5"}
+
+	files := diffChecksums(before, after)
+	expected := []structures.ProjectUpdateFile{
+		{Status: "A", Path: "new.yml"},
+		{Status: "D", Path: "old.yml"},
+		{Status: "M", Path: "vars/main.yml"},
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("unexpected changes %v", files)
+	}
+
+	if contentChecksum(before) == contentChecksum(after) {
+		t.Error("content checksum should change")
+	}
+}
+
+func TestCopyDirectorySkipsOutsideLinks(t *testing.T) {
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := t.TempDir()
+	writeLayoutFiles(t, source, "site.yml", "vars/main.yml")
+	links := map[string]string{
+		"main.yml":   "vars/main.yml",
+		"vars/up":    "../site.yml",
+		"secret.txt": outside,
+		"escape.txt": "../../" + filepath.Base(filepath.Dir(outside)) + "/secret.txt",
+		"missing":    "vars/missing.yml",
+	}
+	for name, link := range links {
+		if err := os.Symlink(link, filepath.Join(source, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	target := t.TempDir()
+	if err := copyDirectory(source, target); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"main.yml", "vars/up"} {
+		content, err := os.ReadFile(filepath.Join(target, name))
+		if err != nil || string(content) != "---\n" {
+			t.Errorf("link %s inside of source should be copied: %v", name, err)
+		}
+		link, err := os.Readlink(filepath.Join(target, name))
+		if err != nil || filepath.IsAbs(link) {
+			t.Errorf("link %s should be relative, got %q: %v", name, link, err)
+		}
+	}
+	for _, name := range []string{"secret.txt", "escape.txt", "missing"} {
+		if _, err := os.Lstat(filepath.Join(target, name)); !os.IsNotExist(err) {
+			t.Errorf("link %s should be skipped", name)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"ensemble/storage/structures"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+
+// updateSubmodules Checks out submodules recursively, they are fetched with credentials of the main repository
+func (m *Manager) updateSubmodules(ctx context.Context, p *structures.Project, env []string, changes *structures.ProjectUpdateChanges, output *updateJob) error {
+	//submodule URLs could be changed in .gitmodules
+	syncResult, err := m.executeCommandContext(ctx, "git submodule sync --recursive", m.projectDirectory(p), env...)
+	if err != nil {
+		return err
+	}
+	output.WriteString(fmt.Sprintf("> git submodule sync\n\n%s\n", syncResult.output))
+	if !syncResult.success {
+		return errors.New("unable to execute git submodule sync")
+	}
+
+	updateResult, err := m.executeCommandContext(ctx, "git submodule update --init --recursive --force", m.projectDirectory(p), env...)
+	if err != nil {
+		return err
+	}
+	output.WriteString(fmt.Sprintf("> git submodule update\n\n%s\n", updateResult.output))
+	if !updateResult.success {
+		return errors.New("unable to execute git submodule update")
+	}
+
+	statusResult, err := m.executeCommand("git submodule status --recursive", m.projectDirectory(p))
+	if err != nil {
+		return err
+	}
+	if !statusResult.success {
+		return errors.New("unable to execute git submodule status")
+	}
+	changes.Submodules = parseSubmoduleStatus(statusResult.output)
+	for _, submodule := range changes.Submodules {
+		output.WriteString(fmt.Sprintf("> submodule %s: %s\n", submodule.Path, submodule.Hash))
+	}
+
+	return nil
+}
+
+// updateLfs Downloads Git LFS objects of checked out revision
+func (m *Manager) updateLfs(ctx context.Context, p *structures.Project, env []string, output *updateJob) error {
+	installResult, err := m.executeCommand("git lfs install --local", m.projectDirectory(p))
+	if err != nil {
+		return err
+	}
+	output.WriteString(fmt.Sprintf("> git lfs install\n\n%s\n", installResult.output))
+	if !installResult.success {
+		return errors.New("unable to execute git lfs install, is git-lfs installed?")
+	}
+
+	pullResult, err := m.executeCommandContext(ctx, "git lfs pull", m.projectDirectory(p), env...)
+	if err != nil {
+		return err
+	}
+	output.WriteString(fmt.Sprintf("> git lfs pull\n\n%s\n", pullResult.output))
+	if !pullResult.success {
+		return errors.New("unable to execute git lfs pull")
+	}
+
+	if p.RepositorySubmodules {
+		submodulesResult, err := m.executeCommandContext(ctx, "git submodule foreach --recursive 'git lfs install --local && git lfs pull'", m.projectDirectory(p), env...)
+		if err != nil {
+			return err
+		}
+		output.WriteString(fmt.Sprintf("> git lfs pull in submodules\n\n%s\n", submodulesResult.output))
+		if !submodulesResult.success {
+			return errors.New("unable to execute git lfs pull in submodules")
+		}
+	}
+
+	return nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// parseSubmoduleStatus Commits of submodules from git submodule status output,
+// each line is status character, commit, path and optional description
+func parseSubmoduleStatus(status string) []structures.ProjectUpdateSubmodule {
+	var submodules []structures.ProjectUpdateSubmodule
+	for _, line := range outputLines(status) {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		submodules = append(submodules, structures.ProjectUpdateSubmodule{
+			Path: fields[1],
+			Hash: strings.TrimLeft(fields[0], "+-U"),
+		})
+	}
+	return submodules
+}
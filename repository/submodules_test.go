@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"ensemble/storage/structures"
+	"reflect"
+	"testing"
+)
+
+func TestParseSubmoduleStatus(t *testing.T) {
+	status := " 1a2b3c4d5e6f libs/common (v1.0)\n" +
+		"-2b3c4d5e6f7a libs/missing\n" +
+		"+3c4d5e6f7a8b libs/changed (heads/main)\n" +
+		"U4d5e6f7a8b9c libs/conflict\n" +
+		" 5e6f7a8b9c0d libs/common/vendor/nested (heads/x)\n" +
+		"\n" +
+		"broken\n"
+
+	expected := []structures.ProjectUpdateSubmodule{
+		{Path: "libs/common", Hash: "1a2b3c4d5e6f"},
+		{Path: "libs/missing", Hash: "2b3c4d5e6f7a"},
+		{Path: "libs/changed", Hash: "3c4d5e6f7a8b"},
+		{Path: "libs/conflict", Hash: "4d5e6f7a8b9c"},
+		{Path: "libs/common/vendor/nested", Hash: "5e6f7a8b9c0d"},
+	}
+
+	if submodules := parseSubmoduleStatus(status); !reflect.DeepEqual(submodules, expected) {
+		t.Fatalf("unexpected submodules: %+v", submodules)
+	}
+	if submodules := parseSubmoduleStatus(""); len(submodules) != 0 {
+		t.Fatalf("empty status should have no submodules: %+v", submodules)
+	}
+}
@@ -0,0 +1,122 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"ensemble/storage/structures"
+	"fmt"
+	"github.com/alessio/shellescape"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var envNamePattern = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+// ValidateInventoryEnv Checks project inventory environment: NAME=value lines, comments start with #, values may be secret references.
+// Invalid lines are reported by number only, they could contain secret values
+func (r *Runner) ValidateInventoryEnv(env string) error {
+	for number, line := range strings.Split(env, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || !envNamePattern.MatchString(parts[0]) {
+			return fmt.Errorf("inventory environment line %d should be NAME=value", number+1)
+		}
+		if err := r.secrets.Validate(parts[1]); err != nil {
+			return fmt.Errorf("inventory environment variable %s: %w", parts[0], err)
+		}
+	}
+	return nil
+}
+
+// inventoryHosts Hosts resolved from project inventory with ansible-inventory
+func (r *Runner) inventoryHosts(project *structures.Project, inventories []string, env []string, vaultPasswordFile *os.File) ([]string, error) {
+	command := strings.Builder{}
+	command.WriteString("ansible-inventory --list")
+	for _, inventory := range inventories {
+		command.WriteString(fmt.Sprintf(" --inventory %s", shellescape.Quote(inventory)))
+	}
+	if vaultPasswordFile != nil {
+		command.WriteString(fmt.Sprintf(" --vault-password-file %s", shellescape.Quote(vaultPasswordFile.Name())))
+	}
+
+	cmd := exec.Command("/bin/bash", "-c", command.String())
+	cmd.Dir = fmt.Sprintf("%s/%s", r.config.Path, project.Id)
+	cmd.Env = append(cmd.Env, env...)
+	r.sshAuthSock(cmd)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var inventory map[string]json.RawMessage
+	if err := json.Unmarshal(stdout.Bytes(), &inventory); err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool)
+	for name, raw := range inventory {
+		if name == "_meta" {
+			var meta struct {
+				HostVars map[string]json.RawMessage `json:"hostvars"`
+			}
+			if err := json.Unmarshal(raw, &meta); err == nil {
+				for host := range meta.HostVars {
+					found[host] = true
+				}
+			}
+			continue
+		}
+		var group struct {
+			Hosts []string `json:"hosts"`
+		}
+		if err := json.Unmarshal(raw, &group); err == nil {
+			for _, host := range group.Hosts {
+				found[host] = true
+			}
+		}
+	}
+
+	var hosts []string
+	for host := range found {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	return hosts, nil
+}
+
+// inventoryEnv Project inventory environment with secret references resolved
+func (r *Runner) inventoryEnv(project *structures.Project) ([]string, error) {
+	var env []string
+	for _, variable := range project.InventoryEnvList() {
+		name, value, _ := strings.Cut(variable, "=")
+		resolved, err := r.secrets.ResolveBackground(value)
+		if err != nil {
+			return nil, fmt.Errorf("inventory environment variable %s: %w", name, err)
+		}
+		env = append(env, name+"="+resolved)
+	}
+	return env, nil
+}
+
+// inventoryEnvSecrets Values of resolved inventory environment which should not be stored
+func inventoryEnvSecrets(env []string) []string {
+	var secrets []string
+	for _, variable := range env {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) == 2 && len(parts[1]) != 0 {
+			secrets = append(secrets, parts[1])
+		}
+	}
+	return secrets
+}
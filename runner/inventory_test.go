@@ -0,0 +1,32 @@
+package runner
+
+import (
+	"ensemble/secrets"
+	"strings"
+	"testing"
+)
+
+func TestValidateInventoryEnv(t *testing.T) {
+	r := New(Configuration{}, nil, secrets.NewResolver(secrets.Configuration{}))
+
+	valid := "# cloud credentials\n\nAWS_ACCESS_KEY_ID=key\n  AWS_SECRET_ACCESS_KEY=a=b  \nTOKEN=ref+env://TOKEN\n"
+	if err := r.ValidateInventoryEnv(valid); err != nil {
+		t.Fatalf("valid environment rejected: %s", err)
+	}
+
+	//secret pasted without name is reported by line number only
+	err := r.ValidateInventoryEnv("# comment\nAWS_ACCESS_KEY_ID=key\n\nsuper-secret-value\n")
+	if err == nil {
+		t.Fatal("line without name accepted")
+	}
+	if err.Error() != "inventory environment line 4 should be NAME=value" {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if strings.Contains(err.Error(), "super-secret-value") {
+		t.Errorf("error contains line content: %s", err)
+	}
+
+	if err := r.ValidateInventoryEnv("1TOKEN=secret"); err == nil || err.Error() != "inventory environment line 1 should be NAME=value" {
+		t.Errorf("invalid name should be rejected by line number: %v", err)
+	}
+}
@@ -2,6 +2,8 @@ package runner
 
 import (
 	"bytes"
+	"encoding/json"
+	"ensemble/secrets"
 	"ensemble/storage"
 	"ensemble/storage/structures"
 	"errors"
@@ -10,6 +12,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
@@ -17,7 +20,8 @@ import (
 
 type Runner struct {
 	config    Configuration
-	store     *storage.Storage
+	store     storage.Store
+	secrets   *secrets.Resolver
 	processes map[string]*exec.Cmd
 }
 
@@ -26,51 +30,88 @@ type Configuration struct {
 	AuthSock string
 }
 
+// Options Per-run settings chosen on run form
+type Options struct {
+	Inventories []string
+	Variables   []string
+	ExtraVars   map[string]interface{}
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 
-func New(config Configuration, store *storage.Storage) *Runner {
+func New(config Configuration, store storage.Store, secrets *secrets.Resolver) *Runner {
 	return &Runner{
 		config:    config,
 		store:     store,
+		secrets:   secrets,
 		processes: make(map[string]*exec.Cmd),
 	}
 }
 
 ///////////////////////////////////////////////////////////////////////////////
 
-func (r *Runner) Run(project *structures.Project, playbook *structures.Playbook, mode int, userId string) (*structures.PlaybookRun, error) {
-	if err := r.installCollection("ansible.posix"); err != nil {
+func (r *Runner) Run(project *structures.Project, playbook *structures.Playbook, mode int, userId string, options *Options) (*structures.PlaybookRun, error) {
+	if len(options.Inventories) == 0 {
+		return nil, errors.New("inventory is required")
+	}
+
+	if err := r.installCollections(project); err != nil {
 		return nil, err
 	}
-	for _, collection := range project.CollectionsList() {
-		if len(strings.TrimSpace(collection)) == 0 {
-			continue
+
+	env, err := r.inventoryEnv(project)
+	if err != nil {
+		return nil, err
+	}
+
+	vaultPasswordFile, err := r.vaultPasswordFile(project)
+	if err != nil {
+		return nil, err
+	}
+
+	//extra vars file holds secret survey answers, it is removed here until run goroutine takes it over
+	var extraVarsFile *os.File
+	started := false
+	defer func() {
+		if extraVarsFile != nil && !started {
+			if err := os.Remove(extraVarsFile.Name()); err != nil {
+				log.Warnf("extra vars file remove error: %s", err)
+			}
 		}
-		if err := r.installCollection(collection); err != nil {
+	}()
+	if len(options.ExtraVars) != 0 {
+		encoded, err := json.Marshal(options.ExtraVars)
+		if err != nil {
 			return nil, err
 		}
-	}
-
-	var vaultPasswordFile *os.File
-	if project.VariablesVault {
-		var err error
-		vaultPasswordFile, err = os.CreateTemp("", storage.NewId())
+		extraVarsFile, err = os.CreateTemp("", storage.NewId())
 		if err != nil {
 			return nil, err
 		}
-		if err := os.WriteFile(vaultPasswordFile.Name(), []byte(project.VaultPassword), 0600); err != nil {
+		_, err = extraVarsFile.Write(encoded)
+		if closeErr := extraVarsFile.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
 			return nil, err
 		}
 	}
 
+	storedExtraVars, err := redactedExtraVars(playbook, options.ExtraVars)
+	if err != nil {
+		return nil, err
+	}
+	secrets := append(surveySecrets(playbook, options.ExtraVars), inventoryEnvSecrets(env)...)
+
 	run := structures.PlaybookRun{
 		PlaybookId:    playbook.Id,
 		UserId:        userId,
 		Mode:          mode,
 		StartTime:     time.Now(),
 		Result:        structures.PlaybookRunResultRunning,
-		InventoryFile: project.Inventory,
-		VariablesFile: project.Variables,
+		InventoryFile: strings.Join(options.Inventories, "|"),
+		VariablesFile: strings.Join(options.Variables, "|"),
+		ExtraVars:     storedExtraVars,
 	}
 	if err := r.store.PlaybookRunInsert(&run); err != nil {
 		return nil, err
@@ -79,6 +120,7 @@ func (r *Runner) Run(project *structures.Project, playbook *structures.Playbook,
 		return nil, err
 	}
 
+	started = true
 	go func() {
 		defer func() {
 			if err := r.store.PlaybookLock(playbook.Id, false); err != nil {
@@ -89,9 +131,24 @@ func (r *Runner) Run(project *structures.Project, playbook *structures.Playbook,
 					log.Warnf("vault password file remove error %s: %s", run.Id, err)
 				}
 			}
+			if extraVarsFile != nil {
+				if err := os.Remove(extraVarsFile.Name()); err != nil {
+					log.Warnf("extra vars file remove error %s: %s", run.Id, err)
+				}
+			}
 		}()
 
-		stdout, stderr, err := r.executePlaybook(run.Id, project, playbook, mode, vaultPasswordFile)
+		hosts, err := r.inventoryHosts(project, options.Inventories, env, vaultPasswordFile)
+		if err != nil {
+			log.Warnf("playbook run %s inventory hosts resolve failed: %s", run.Id, redactSecrets(err.Error(), secrets))
+		} else {
+			run.Hosts = strings.Join(hosts, "|")
+			if err := r.store.PlaybookRunUpdate(&run); err != nil {
+				log.Warnf("playbook run %s hosts update failed: %s", run.Id, err)
+			}
+		}
+
+		stdout, stderr, err := r.executePlaybook(run.Id, project, playbook, mode, options, env, vaultPasswordFile, extraVarsFile)
 		if err != nil {
 			log.Warnf("playbook run %s failed: %s", run.Id, err)
 			run.Result = structures.PlaybookRunResultFailure
@@ -108,11 +165,15 @@ func (r *Runner) Run(project *structures.Project, playbook *structures.Playbook,
 		runResult := structures.RunResult{
 			Id:     run.Id,
 			RunId:  run.Id,
-			Output: stdout,
-			Error:  stderr,
+			Output: redactSecrets(stdout, secrets),
+			Error:  redactSecrets(stderr, secrets),
 		}
 		if err := r.store.RunResultInsert(&runResult); err != nil {
 			log.Warnf("playbook run result %s insert failed: %s", runResult.Id, err)
+			return
+		}
+		if err := r.saveTasks(&run, runResult.Output); err != nil {
+			log.Warnf("playbook run %s tasks save failed: %s", run.Id, err)
 		}
 	}()
 
@@ -134,6 +195,54 @@ func (r *Runner) TerminatePlaybook(runId string) error {
 
 ///////////////////////////////////////////////////////////////////////////////
 
+func (r *Runner) installCollections(project *structures.Project) error {
+	if err := r.installCollection("ansible.posix"); err != nil {
+		return err
+	}
+	for _, collection := range project.CollectionsList() {
+		if len(strings.TrimSpace(collection)) == 0 {
+			continue
+		}
+		if err := r.installCollection(collection); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vaultPasswordFile Temporary file with resolved project vault password, nil when project has no vault
+func (r *Runner) vaultPasswordFile(project *structures.Project) (*os.File, error) {
+	if !project.VariablesVault {
+		return nil, nil
+	}
+	vaultPassword, err := r.secrets.ResolveBackground(project.VaultPassword)
+	if err != nil {
+		return nil, fmt.Errorf("vault password: %w", err)
+	}
+	vaultPasswordFile, err := os.CreateTemp("", storage.NewId())
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(vaultPasswordFile.Name(), []byte(vaultPassword), 0600); err != nil {
+		return nil, err
+	}
+	return vaultPasswordFile, nil
+}
+
+// CollectionsPath Directory where ansible-galaxy installs collections
+func (r *Runner) CollectionsPath() string {
+	for _, variable := range []string{"ANSIBLE_COLLECTIONS_PATH", "ANSIBLE_COLLECTIONS_PATHS"} {
+		if paths := os.Getenv(variable); len(paths) != 0 {
+			return strings.Split(paths, string(os.PathListSeparator))[0]
+		}
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ansible", "collections")
+}
+
 func (r *Runner) installCollection(name string) error {
 	command := fmt.Sprintf("ansible-galaxy collection install %s", shellescape.Quote(name))
 	cmd := exec.Command("/bin/bash", "-c", command)
@@ -142,7 +251,7 @@ func (r *Runner) installCollection(name string) error {
 	return err
 }
 
-func (r *Runner) executePlaybook(runId string, project *structures.Project, playbook *structures.Playbook, mode int, vaultPasswordFile *os.File) (string, string, error) {
+func (r *Runner) executePlaybook(runId string, project *structures.Project, playbook *structures.Playbook, mode int, options *Options, env []string, vaultPasswordFile, extraVarsFile *os.File) (string, string, error) {
 	command := strings.Builder{}
 	command.WriteString("ansible-playbook")
 
@@ -153,20 +262,27 @@ func (r *Runner) executePlaybook(runId string, project *structures.Project, play
 		command.WriteString(" --syntax-check")
 	}
 
-	inventory := fmt.Sprintf("inventories/%s", project.Inventory)
-	command.WriteString(fmt.Sprintf(" --inventory %s", shellescape.Quote(inventory)))
+	for _, inventory := range options.Inventories {
+		command.WriteString(fmt.Sprintf(" --inventory %s", shellescape.Quote(inventory)))
+	}
 
 	if project.VariablesVault {
-		command.WriteString(fmt.Sprintf(" --extra-vars %s", shellescape.Quote("@vars/vault.yml")))
+		vault := fmt.Sprintf("@%s", project.VariablesVaultFile)
+		command.WriteString(fmt.Sprintf(" --extra-vars %s", shellescape.Quote(vault)))
 		command.WriteString(fmt.Sprintf(" --vault-password-file %s", shellescape.Quote(vaultPasswordFile.Name())))
 	}
 	if project.VariablesMain {
-		command.WriteString(fmt.Sprintf(" --extra-vars %s", shellescape.Quote("@vars/main.yml")))
+		main := fmt.Sprintf("@%s", project.VariablesMainFile)
+		command.WriteString(fmt.Sprintf(" --extra-vars %s", shellescape.Quote(main)))
 	}
-	if len(project.Variables) != 0 {
-		variables := fmt.Sprintf("@vars/%s", project.Variables)
+	for _, variablesFile := range options.Variables {
+		variables := fmt.Sprintf("@%s", variablesFile)
 		command.WriteString(fmt.Sprintf(" --extra-vars %s", shellescape.Quote(variables)))
 	}
+	if extraVarsFile != nil {
+		extraVars := fmt.Sprintf("@%s", extraVarsFile.Name())
+		command.WriteString(fmt.Sprintf(" --extra-vars %s", shellescape.Quote(extraVars)))
+	}
 
 	command.WriteString(" ")
 	command.WriteString(shellescape.Quote(playbook.Filename))
@@ -174,6 +290,7 @@ func (r *Runner) executePlaybook(runId string, project *structures.Project, play
 	cmd := exec.Command("/bin/bash", "-c", command.String())
 	cmd.Dir = fmt.Sprintf("%s/%s", r.config.Path, project.Id)
 	cmd.Env = append(cmd.Env, "ANSIBLE_STDOUT_CALLBACK=ansible.posix.json")
+	cmd.Env = append(cmd.Env, env...)
 	r.sshAuthSock(cmd)
 
 	var stdout, stderr bytes.Buffer
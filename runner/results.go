@@ -0,0 +1,65 @@
+package runner
+
+import (
+	"database/sql"
+	"ensemble/storage/structures"
+	"errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const parseResultsBatch = 100
+
+// ParseStoredResults Parses results of runs finished before results were stored in tables
+func (r *Runner) ParseStoredResults() {
+	parsed := 0
+	for {
+		runs, err := r.store.PlaybookRunGetUnparsed(parseResultsBatch)
+		if err != nil {
+			log.Errorf("unable to get unparsed playbook runs: %s", err)
+			return
+		}
+		if len(runs) == 0 {
+			break
+		}
+
+		for _, run := range runs {
+			if err := r.ParseResults(run); err != nil {
+				log.Errorf("playbook run %s results parse error: %s", run.Id, err)
+				return
+			}
+			parsed++
+		}
+	}
+
+	if parsed != 0 {
+		log.Infof("results of %d playbook runs parsed", parsed)
+	}
+}
+
+// ParseResults Stores plays, tasks and host results of finished run from its stored result,
+// run without result is not marked parsed
+func (r *Runner) ParseResults(run *structures.PlaybookRun) error {
+	result, err := r.store.RunResultGet(run.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Warnf("playbook run %s has no result to parse", run.Id)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return r.saveTasks(run, result.Output)
+}
+
+// saveTasks Stores plays, tasks and host results from ansible output of finished run
+func (r *Runner) saveTasks(run *structures.PlaybookRun, output string) error {
+	var execution *structures.AnsibleExecution
+	if run.Mode != structures.PlaybookRunModeSyntax && len(output) != 0 {
+		parsed, err := structures.ParseAnsibleExecution(output)
+		if err != nil {
+			log.Warnf("playbook run %s output parse error: %s", run.Id, err)
+		} else {
+			execution = parsed
+		}
+	}
+	return r.store.RunTasksSave(run.Id, execution)
+}
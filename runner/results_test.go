@@ -0,0 +1,79 @@
+package runner
+
+import (
+	"ensemble/storage"
+	"ensemble/storage/structures"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseStoredResults(t *testing.T) {
+	store, err := storage.New(storage.Configuration{Url: "sqlite://" + filepath.Join(t.TempDir(), "ensemble.db")})
+	if err != nil {
+		t.Fatalf("unable to create storage: %s", err)
+	}
+	defer store.Close()
+
+	output := `{
+		"plays": [{
+			"play": {"name": "web"},
+			"tasks": [{
+				"task": {"name": "Restart nginx"},
+				"hosts": {"web1": {"action": "service", "changed": true}}
+			}]
+		}],
+		"stats": {"web1": {"ok": 2, "changed": 1}}
+	}`
+
+	var runs []*structures.PlaybookRun
+	for i := 0; i < 2; i++ {
+		run := &structures.PlaybookRun{
+			PlaybookId: "playbook",
+			UserId:     "user",
+			Mode:       structures.PlaybookRunModeExecute,
+			StartTime:  time.Now(),
+			Result:     structures.PlaybookRunResultSuccess,
+		}
+		if err := store.PlaybookRunInsert(run); err != nil {
+			t.Fatal(err)
+		}
+		runs = append(runs, run)
+	}
+	parsedRun, resultlessRun := runs[0], runs[1]
+	if err := store.RunResultInsert(&structures.RunResult{Id: parsedRun.Id, RunId: parsedRun.Id, Output: output}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := New(Configuration{}, store, nil)
+	r.ParseStoredResults()
+
+	parsed, err := store.PlaybookRunGet(parsedRun.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.ResultsParsed || parsed.StatsOk != 2 || parsed.StatsChanged != 1 {
+		t.Errorf("run with result should be parsed with counters: %+v", parsed)
+	}
+	found, total, err := store.PlaybookRunFind("playbook", storage.PlaybookRunFilter{Task: "nginx"})
+	if err != nil || total != 1 || found[0].Id != parsedRun.Id {
+		t.Errorf("run tasks should be stored: %d runs found, %v", total, err)
+	}
+
+	resultless, err := store.PlaybookRunGet(resultlessRun.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resultless.ResultsParsed {
+		t.Error("run without result should not be marked parsed")
+	}
+
+	//result saved later is parsed on the next pass
+	if err := store.RunResultInsert(&structures.RunResult{Id: resultlessRun.Id, RunId: resultlessRun.Id, Output: output}); err != nil {
+		t.Fatal(err)
+	}
+	r.ParseStoredResults()
+	if resultless, err = store.PlaybookRunGet(resultlessRun.Id); err != nil || !resultless.ResultsParsed {
+		t.Errorf("run with late result should be parsed: %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package runner
+
+import (
+	"encoding/json"
+	"ensemble/storage/structures"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const surveySecretRedacted = "*****"
+
+// SurveyAnswers Validates playbook survey answers and converts them to extra variables
+func SurveyAnswers(playbook *structures.Playbook, values map[string]string) (map[string]interface{}, error) {
+	answers := make(map[string]interface{})
+
+	for _, question := range playbook.SurveyQuestions() {
+		value := values[question.Variable]
+		if question.Type != structures.PlaybookSurveyMultiline && question.Type != structures.PlaybookSurveySecret {
+			value = strings.TrimSpace(value)
+		}
+
+		if question.Type == structures.PlaybookSurveyBoolean {
+			answers[question.Variable] = value == "on" || value == "true" || value == "1"
+			continue
+		}
+
+		if len(value) == 0 {
+			if question.Required {
+				return nil, fmt.Errorf("%s is required", question.Title())
+			}
+			continue
+		}
+
+		switch question.Type {
+		case structures.PlaybookSurveyInteger:
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s should be an integer", question.Title())
+			}
+			if question.Min != nil && number < *question.Min {
+				return nil, fmt.Errorf("%s should not be less than %d", question.Title(), *question.Min)
+			}
+			if question.Max != nil && number > *question.Max {
+				return nil, fmt.Errorf("%s should not be greater than %d", question.Title(), *question.Max)
+			}
+			answers[question.Variable] = number
+		case structures.PlaybookSurveyChoice:
+			found := false
+			for _, choice := range question.Choices {
+				if choice == value {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("%s should be one of the choices", question.Title())
+			}
+			answers[question.Variable] = value
+		default:
+			if question.Min != nil && len(value) < *question.Min {
+				return nil, fmt.Errorf("%s should be at least %d characters long", question.Title(), *question.Min)
+			}
+			if question.Max != nil && len(value) > *question.Max {
+				return nil, fmt.Errorf("%s should be at most %d characters long", question.Title(), *question.Max)
+			}
+			answers[question.Variable] = value
+		}
+	}
+
+	return answers, nil
+}
+
+// surveySecrets Secret answers which should not be stored
+func surveySecrets(playbook *structures.Playbook, extraVars map[string]interface{}) []string {
+	var secrets []string
+	for _, question := range playbook.SurveyQuestions() {
+		if question.Type != structures.PlaybookSurveySecret {
+			continue
+		}
+		if value, ok := extraVars[question.Variable].(string); ok && len(value) != 0 {
+			secrets = append(secrets, value)
+		}
+	}
+	return secrets
+}
+
+// redactedExtraVars Extra variables with secret answers replaced, encoded to store with playbook run
+func redactedExtraVars(playbook *structures.Playbook, extraVars map[string]interface{}) (string, error) {
+	if len(extraVars) == 0 {
+		return "", nil
+	}
+	redacted := make(map[string]interface{})
+	for variable, value := range extraVars {
+		redacted[variable] = value
+	}
+	for _, question := range playbook.SurveyQuestions() {
+		if _, ok := redacted[question.Variable]; ok && question.Type == structures.PlaybookSurveySecret {
+			redacted[question.Variable] = surveySecretRedacted
+		}
+	}
+	encoded, err := json.Marshal(redacted)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+func redactSecrets(text string, secrets []string) string {
+	for _, secret := range secrets {
+		text = strings.ReplaceAll(text, secret, surveySecretRedacted)
+	}
+	return text
+}
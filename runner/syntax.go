@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"bytes"
+	"ensemble/storage/structures"
+	"fmt"
+	"github.com/alessio/shellescape"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// SyntaxCheck Checks syntax of project playbooks against project default inventory.
+// Returns ansible error output by playbook id, playbooks with valid syntax are not included.
+func (r *Runner) SyntaxCheck(project *structures.Project, playbooks []*structures.Playbook) (map[string]string, error) {
+	if err := r.installCollections(project); err != nil {
+		return nil, err
+	}
+
+	env, err := r.inventoryEnv(project)
+	if err != nil {
+		return nil, err
+	}
+
+	vaultPasswordFile, err := r.vaultPasswordFile(project)
+	if err != nil {
+		return nil, err
+	}
+	if vaultPasswordFile != nil {
+		defer func() {
+			if err := os.Remove(vaultPasswordFile.Name()); err != nil {
+				log.Warnf("vault password file remove error %s: %s", project.Id, err)
+			}
+		}()
+	}
+
+	secrets := inventoryEnvSecrets(env)
+	syntaxErrors := make(map[string]string)
+
+	for _, playbook := range playbooks {
+		command := strings.Builder{}
+		command.WriteString("ansible-playbook --syntax-check")
+		command.WriteString(fmt.Sprintf(" --inventory %s", shellescape.Quote(project.InventoryDefault)))
+		if vaultPasswordFile != nil {
+			command.WriteString(fmt.Sprintf(" --vault-password-file %s", shellescape.Quote(vaultPasswordFile.Name())))
+		}
+		command.WriteString(" ")
+		command.WriteString(shellescape.Quote(playbook.Filename))
+
+		cmd := exec.Command("/bin/bash", "-c", command.String())
+		cmd.Dir = fmt.Sprintf("%s/%s", r.config.Path, project.Id)
+		cmd.Env = append(cmd.Env, "ANSIBLE_NOCOLOR=1")
+		cmd.Env = append(cmd.Env, env...)
+		r.sshAuthSock(cmd)
+
+		var output bytes.Buffer
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+
+		if err := cmd.Run(); err != nil {
+			if _, ok := err.(*exec.ExitError); !ok {
+				return nil, err
+			}
+			syntaxErrors[playbook.Id] = redactSecrets(strings.TrimSpace(output.String()), secrets)
+		}
+	}
+
+	return syntaxErrors, nil
+}
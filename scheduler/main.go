@@ -0,0 +1,156 @@
+package scheduler
+
+import (
+	"ensemble/repository"
+	"ensemble/storage"
+	"ensemble/storage/structures"
+	"errors"
+	"github.com/go-co-op/gocron"
+	"github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+	"hash/fnv"
+	"time"
+)
+
+const cleanupTag = "cleanup"
+
+type Configuration struct {
+	DefaultSchedule string
+	Spread          time.Duration
+	CleanupSchedule string
+}
+
+type Scheduler struct {
+	config  Configuration
+	store   storage.Store
+	manager *repository.Manager
+	cron    *gocron.Scheduler
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func New(config Configuration, store storage.Store, manager *repository.Manager) (*Scheduler, error) {
+	if err := ValidateSchedule(config.DefaultSchedule); err != nil {
+		return nil, err
+	}
+	if err := ValidateSchedule(config.CleanupSchedule); err != nil {
+		return nil, err
+	}
+	return &Scheduler{
+		config:  config,
+		store:   store,
+		manager: manager,
+		cron:    gocron.NewScheduler(time.Now().Location()),
+	}, nil
+}
+
+// ValidateSchedule Checks project update schedule: cron expression or "never"
+func ValidateSchedule(schedule string) error {
+	if len(schedule) == 0 || schedule == structures.ProjectUpdateScheduleNever {
+		return nil
+	}
+	if _, err := cron.ParseStandard(schedule); err != nil {
+		return errors.New("update schedule should be a cron expression or \"never\"")
+	}
+	return nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// Start Registers update jobs of all projects and starts scheduler
+func (s *Scheduler) Start() error {
+	projects, err := s.store.ProjectGetAll()
+	if err != nil {
+		return err
+	}
+
+	for _, project := range projects {
+		if err := s.Schedule(project); err != nil {
+			log.Errorf("unable to schedule project %s update: %s", project.Id, err)
+		}
+	}
+
+	if len(s.config.CleanupSchedule) != 0 && s.config.CleanupSchedule != structures.ProjectUpdateScheduleNever {
+		_, err := s.cron.Cron(s.config.CleanupSchedule).Tag(cleanupTag).SingletonMode().Do(s.cleanup)
+		if err != nil {
+			return err
+		}
+		log.Infof("deleted projects cleanup scheduled: %s", s.config.CleanupSchedule)
+	}
+
+	s.cron.StartAsync()
+
+	return nil
+}
+
+// Schedule Registers (or replaces) update job of a project
+func (s *Scheduler) Schedule(project *structures.Project) error {
+	s.Unschedule(project.Id)
+
+	schedule := project.UpdateSchedule
+	if len(schedule) == 0 {
+		schedule = s.config.DefaultSchedule
+	}
+	//default schedule may be disabled with "never" or empty value as well
+	if len(schedule) == 0 || schedule == structures.ProjectUpdateScheduleNever {
+		log.Infof("project %s updates are not scheduled", project.Id)
+		return nil
+	}
+
+	projectId := project.Id
+	offset := s.offset(projectId)
+
+	_, err := s.cron.Cron(schedule).Tag(projectId).SingletonMode().Do(func() {
+		time.Sleep(offset)
+		s.update(projectId)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("project %s update scheduled: %s (+%s)", projectId, schedule, offset)
+
+	return nil
+}
+
+// Unschedule Removes update job of a project
+func (s *Scheduler) Unschedule(projectId string) {
+	if err := s.cron.RemoveByTag(projectId); err != nil && !errors.Is(err, gocron.ErrJobNotFoundWithTag) {
+		log.Warnf("unable to remove project %s update job: %s", projectId, err)
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func (s *Scheduler) update(projectId string) {
+	project, err := s.store.ProjectGet(projectId)
+	if err != nil {
+		log.Warnf("unable to get scheduled project %s: %s", projectId, err)
+		return
+	}
+
+	log.Infof("updating project %s...", project.Id)
+	if err := s.manager.Update(project); err != nil {
+		log.Warnf("unable to update project %s: %s", project.Name, err)
+	}
+}
+
+// offset Stable per-project delay to spread updates with the same schedule
+func (s *Scheduler) offset(projectId string) time.Duration {
+	if s.config.Spread <= 0 {
+		return 0
+	}
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(projectId))
+	return time.Duration(hash.Sum32()) * time.Second % s.config.Spread
+}
+
+func (s *Scheduler) cleanup() {
+	log.Infof("removing files of deleted projects...")
+	cleaned, err := s.manager.CollectGarbage()
+	if err != nil {
+		log.Warnf("unable to remove files of deleted projects: %s", err)
+		return
+	}
+	log.Infof("files of %d deleted projects removed", cleaned)
+}
@@ -0,0 +1,32 @@
+package scheduler
+
+import (
+	"ensemble/storage/structures"
+	"testing"
+)
+
+func TestScheduleDefault(t *testing.T) {
+	for _, schedule := range []string{"", structures.ProjectUpdateScheduleNever} {
+		s, err := New(Configuration{DefaultSchedule: schedule}, nil, nil)
+		if err != nil {
+			t.Fatalf("default schedule %q rejected: %s", schedule, err)
+		}
+		if err := s.Schedule(&structures.Project{Id: "project"}); err != nil {
+			t.Fatalf("default schedule %q: %s", schedule, err)
+		}
+		if jobs := len(s.cron.Jobs()); jobs != 0 {
+			t.Fatalf("default schedule %q: expected no jobs, got %d", schedule, jobs)
+		}
+	}
+
+	s, err := New(Configuration{DefaultSchedule: structures.ProjectUpdateScheduleNever}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Schedule(&structures.Project{Id: "project", UpdateSchedule: "0 3 * * *"}); err != nil {
+		t.Fatalf("project schedule: %s", err)
+	}
+	if jobs := len(s.cron.Jobs()); jobs != 1 {
+		t.Fatalf("project schedule should be used, got %d jobs", jobs)
+	}
+}
@@ -0,0 +1,26 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// envProvider Secrets from service environment, variable name is prefixed so other service settings can not be referenced
+type envProvider struct {
+	prefix string
+}
+
+func (p *envProvider) Resolve(_ context.Context, path string) (string, error) {
+	if !envNamePattern.MatchString(path) {
+		return "", fmt.Errorf("invalid environment variable name %s", path)
+	}
+	value, ok := os.LookupEnv(p.prefix + path)
+	if !ok {
+		return "", fmt.Errorf("%w: environment variable %s%s", errNotFound, p.prefix, path)
+	}
+	return value, nil
+}
@@ -0,0 +1,25 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileProvider Secrets from files of mounted secrets volume, one secret per file
+type fileProvider struct {
+	path string
+}
+
+func (p *fileProvider) Resolve(_ context.Context, path string) (string, error) {
+	if !filepath.IsLocal(path) {
+		return "", fmt.Errorf("secret file %s is outside of secrets directory", path)
+	}
+	content, err := os.ReadFile(filepath.Join(p.path, path))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
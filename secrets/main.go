@@ -0,0 +1,133 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// ReferencePrefix Values starting with prefix are references to provider path: ref+<provider>://<path>
+	ReferencePrefix = "ref+"
+
+	ProviderDb    = "db"
+	ProviderEnv   = "env"
+	ProviderFile  = "file"
+	ProviderVault = "vault"
+
+	resolveTimeout = 30 * time.Second
+)
+
+type Configuration struct {
+	EnvPrefix      string
+	FilePath       string
+	VaultAddress   string
+	VaultToken     string
+	VaultNamespace string
+	VaultMount     string
+	VaultKvVersion int
+}
+
+var errNotFound = errors.New("secret not found")
+
+// Provider Source of secret values addressed by path
+type Provider interface {
+	Resolve(ctx context.Context, path string) (string, error)
+}
+
+// Resolver Resolves stored credentials, plain values are kept in database and references are read from providers when needed
+type Resolver struct {
+	providers map[string]Provider
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func NewResolver(config Configuration) *Resolver {
+	r := &Resolver{
+		providers: map[string]Provider{
+			ProviderDb:  &dbProvider{},
+			ProviderEnv: &envProvider{prefix: config.EnvPrefix},
+		},
+	}
+	if len(config.FilePath) != 0 {
+		r.providers[ProviderFile] = &fileProvider{path: config.FilePath}
+	}
+	if len(config.VaultAddress) != 0 {
+		r.providers[ProviderVault] = newVaultProvider(config)
+	}
+	return r
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// Resolve Secret value of plain value or reference
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	name, path, err := r.parse(value)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+
+	resolved, err := r.providers[name].Resolve(ctx, path)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve secret %s: %w", value, err)
+	}
+	return resolved, nil
+}
+
+// ResolveBackground Resolve for callers without request context
+func (r *Resolver) ResolveBackground(value string) (string, error) {
+	return r.Resolve(context.Background(), value)
+}
+
+// Validate Checks reference syntax and provider availability, value is not resolved
+func (r *Resolver) Validate(value string) error {
+	_, _, err := r.parse(value)
+	return err
+}
+
+// Providers Names of configured reference providers
+func (r *Resolver) Providers() []string {
+	var names []string
+	for name := range r.providers {
+		if name != ProviderDb {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *Resolver) parse(value string) (string, string, error) {
+	if !IsReference(value) {
+		return ProviderDb, value, nil
+	}
+
+	name, path, found := strings.Cut(strings.TrimPrefix(value, ReferencePrefix), "://")
+	if !found || len(path) == 0 {
+		return "", "", fmt.Errorf("invalid secret reference %s, expected %s<provider>://<path>", value, ReferencePrefix)
+	}
+	if _, ok := r.providers[name]; !ok || name == ProviderDb {
+		return "", "", fmt.Errorf("secret provider %s is not configured", name)
+	}
+	return name, path, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// IsReference Value is a reference to provider path, not a secret itself
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, ReferencePrefix)
+}
+
+// dbProvider Secrets stored in database, value is a secret itself
+type dbProvider struct{}
+
+func (p *dbProvider) Resolve(_ context.Context, path string) (string, error) {
+	return path, nil
+}
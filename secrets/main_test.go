@@ -0,0 +1,46 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolver(t *testing.T) {
+	directory := t.TempDir()
+	if err := os.WriteFile(filepath.Join(directory, "token"), []byte("file-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_SECRET_TOKEN", "env-secret")
+
+	resolver := NewResolver(Configuration{EnvPrefix: "TEST_SECRET_", FilePath: directory})
+	tests := map[string]string{
+		"plain password":   "plain password",
+		"ref+env://TOKEN":  "env-secret",
+		"ref+file://token": "file-secret",
+		"":                 "",
+	}
+	for value, expected := range tests {
+		resolved, err := resolver.Resolve(context.Background(), value)
+		if err != nil {
+			t.Fatalf("%s: %s", value, err)
+		}
+		if resolved != expected {
+			t.Fatalf("%s: expected %s, got %s", value, expected, resolved)
+		}
+	}
+
+	for _, value := range []string{"ref+file://../token", "ref+env://TOKEN-1", "ref+env://MISSING", "ref+vault://ci/git", "ref+env:TOKEN"} {
+		if _, err := resolver.Resolve(context.Background(), value); err == nil {
+			t.Fatalf("%s resolved", value)
+		}
+	}
+
+	if err := resolver.Validate("ref+vault://ci/git"); err == nil {
+		t.Fatal("reference to not configured provider is valid")
+	}
+	if err := resolver.Validate("ref+env://MISSING"); err != nil {
+		t.Fatalf("reference validation should not resolve value: %s", err)
+	}
+}
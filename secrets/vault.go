@@ -0,0 +1,139 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	vaultDefaultMount = "secret"
+	vaultDefaultKey   = "value"
+	vaultTimeout      = 10 * time.Second
+)
+
+// vaultProvider Secrets from HashiCorp Vault KV engine, path is <secret path>#<key>, key "value" is used by default
+type vaultProvider struct {
+	address   string
+	token     string
+	namespace string
+	mount     string
+	kvVersion int
+	client    *http.Client
+}
+
+type vaultResponse struct {
+	Data   map[string]any `json:"data"`
+	Errors []string       `json:"errors"`
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func newVaultProvider(config Configuration) *vaultProvider {
+	mount := strings.Trim(config.VaultMount, "/")
+	if len(mount) == 0 {
+		mount = vaultDefaultMount
+	}
+	kvVersion := config.VaultKvVersion
+	if kvVersion != 1 {
+		kvVersion = 2
+	}
+	return &vaultProvider{
+		address:   strings.TrimRight(config.VaultAddress, "/"),
+		token:     config.VaultToken,
+		namespace: config.VaultNamespace,
+		mount:     mount,
+		kvVersion: kvVersion,
+		client:    &http.Client{Timeout: vaultTimeout},
+	}
+}
+
+func (p *vaultProvider) Resolve(ctx context.Context, path string) (string, error) {
+	secretPath, key, _ := strings.Cut(path, "#")
+	secretPath = strings.Trim(secretPath, "/")
+	if len(secretPath) == 0 {
+		return "", fmt.Errorf("vault secret path required")
+	}
+	if len(key) == 0 {
+		key = vaultDefaultKey
+	}
+
+	data, err := p.read(ctx, secretPath)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("%w: vault secret %s has no key %s", errNotFound, secretPath, key)
+	}
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case nil:
+		return "", nil
+	default:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return string(encoded), nil
+	}
+}
+
+// read Key-value data of secret, KV version 2 wraps it into data with metadata
+func (p *vaultProvider) read(ctx context.Context, secretPath string) (map[string]any, error) {
+	escaped := url.PathEscape(secretPath)
+	escaped = strings.ReplaceAll(escaped, "%2F", "/")
+
+	endpoint := fmt.Sprintf("%s/v1/%s/%s", p.address, p.mount, escaped)
+	if p.kvVersion == 2 {
+		endpoint = fmt.Sprintf("%s/v1/%s/data/%s", p.address, p.mount, escaped)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("X-Vault-Token", p.token)
+	if len(p.namespace) != 0 {
+		request.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded vaultResponse
+	if err := json.Unmarshal(body, &decoded); err != nil && response.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("invalid vault response: %w", err)
+	}
+
+	switch {
+	case response.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%w: vault secret %s", errNotFound, secretPath)
+	case response.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("vault responded %s: %s", response.Status, strings.Join(decoded.Errors, ", "))
+	}
+
+	if p.kvVersion == 1 {
+		return decoded.Data, nil
+	}
+	data, ok := decoded.Data["data"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: vault secret %s has no data, it may be deleted", errNotFound, secretPath)
+	}
+	return data, nil
+}
@@ -0,0 +1,74 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// vaultStandIn Minimal Vault KV API serving secrets of both engine versions
+func vaultStandIn(t *testing.T, token string) *httptest.Server {
+	secrets := map[string]map[string]any{
+		"ci/git": {"password": "git-password", "value": "default", "port": 22},
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != token {
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(map[string]any{"errors": []string{"permission denied"}})
+			return
+		}
+		var data any
+		switch r.URL.Path {
+		case "/v1/secret/data/ci/git":
+			data = map[string]any{"data": secrets["ci/git"], "metadata": map[string]any{"version": 1}}
+		case "/v1/kv/ci/git":
+			data = secrets["ci/git"]
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]any{"errors": []string{}})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+}
+
+func TestVaultProvider(t *testing.T) {
+	server := vaultStandIn(t, "token")
+	defer server.Close()
+
+	resolver := NewResolver(Configuration{VaultAddress: server.URL, VaultToken: "token"})
+	tests := map[string]string{
+		"ref+vault://ci/git#password": "git-password",
+		"ref+vault://ci/git":          "default",
+		"ref+vault://ci/git#port":     "22",
+	}
+	for reference, expected := range tests {
+		value, err := resolver.Resolve(context.Background(), reference)
+		if err != nil {
+			t.Fatalf("%s: %s", reference, err)
+		}
+		if value != expected {
+			t.Fatalf("%s: expected %s, got %s", reference, expected, value)
+		}
+	}
+
+	if _, err := resolver.Resolve(context.Background(), "ref+vault://ci/missing"); !errors.Is(err, errNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if _, err := resolver.Resolve(context.Background(), "ref+vault://ci/git#missing"); !errors.Is(err, errNotFound) {
+		t.Fatalf("expected not found error for missing key, got %v", err)
+	}
+
+	kv1 := NewResolver(Configuration{VaultAddress: server.URL, VaultToken: "token", VaultMount: "kv", VaultKvVersion: 1})
+	if value, err := kv1.Resolve(context.Background(), "ref+vault://ci/git#password"); err != nil || value != "git-password" {
+		t.Fatalf("kv version 1: %s, %v", value, err)
+	}
+
+	denied := NewResolver(Configuration{VaultAddress: server.URL, VaultToken: "wrong"})
+	if _, err := denied.Resolve(context.Background(), "ref+vault://ci/git"); err == nil {
+		t.Fatal("secret resolved with wrong token")
+	}
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"encoding/json"
+	"ensemble/storage/structures"
+	"errors"
+	"reflect"
+	"time"
+)
+
+// AuditEventFilter Audit log conditions, zero values are not applied, From is inclusive and To is exclusive.
+// Target matches target id exactly or target name as substring
+type AuditEventFilter struct {
+	UserId     string
+	Action     string
+	TargetType string
+	Target     string
+	From       time.Time
+	To         time.Time
+	Page       Page
+}
+
+// auditSecretFields Fields which values are never written to audit log
+var auditSecretFields = map[string]bool{
+	"Password":           true,
+	"RepositoryPassword": true,
+	"VaultPassword":      true,
+	"InventoryEnv":       true,
+}
+
+// AuditEventInsert Appends event to audit log, events are never updated or deleted
+func (s *Storage) AuditEventInsert(event *structures.AuditEvent) error {
+	if event == nil {
+		return errors.New("audit event insert nil")
+	}
+	if len(event.Action) == 0 {
+		return errors.New("audit event insert empty action")
+	}
+	if len(event.Id) == 0 {
+		event.Id = NewId()
+	}
+	if event.Date.IsZero() {
+		event.Date = time.Now()
+	}
+
+	query := `insert into audit_events (id, date, user_id, user_login, action, target_type, target_id, target_name, value_before, value_after, ip)
+              values (:id, :date, :user_id, :user_login, :action, :target_type, :target_id, :target_name, :value_before, :value_after, :ip)`
+	_, err := s.db.NamedExec(query, event)
+	return err
+}
+
+// AuditEventFind Audit log page by filter, latest first
+func (s *Storage) AuditEventFind(filter AuditEventFilter) ([]*structures.AuditEvent, int, error) {
+	c := conditions{}
+	if len(filter.UserId) != 0 {
+		c.add("user_id = ?", filter.UserId)
+	}
+	if len(filter.Action) != 0 {
+		c.add("action = ?", filter.Action)
+	}
+	if len(filter.TargetType) != 0 {
+		c.add("target_type = ?", filter.TargetType)
+	}
+	if len(filter.Target) != 0 {
+		c.addAll(`(target_id = ? or lower(target_name) like ? escape '\')`, filter.Target, likeContains(filter.Target))
+	}
+	if !filter.From.IsZero() {
+		c.add("date >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		c.add("date < ?", filter.To)
+	}
+
+	total := 0
+	countQuery := `select count(*) from audit_events ` + c.where()
+	if err := s.db.Get(&total, countQuery, c.args...); err != nil {
+		return nil, 0, err
+	}
+
+	limit, args := c.page(filter.Page)
+	query := `select id, date, user_id, user_login, action, target_type, target_id, target_name, value_before, value_after, ip
+              from audit_events
+              ` + c.where() + `
+              order by date desc, id desc
+              ` + limit
+
+	var events []*structures.AuditEvent
+	if err := s.db.Select(&events, query, args...); err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// AuditValues Encoded before and after values of changed entity. When both values are set only changed
+// fields are kept, created and deleted entities keep non-empty fields. Secret fields are masked, so log
+// shows that secret was set or changed without its value. Empty string is returned for nil value
+func AuditValues(before, after any) (string, string, error) {
+	beforeFields, err := auditFields(before)
+	if err != nil {
+		return "", "", err
+	}
+	afterFields, err := auditFields(after)
+	if err != nil {
+		return "", "", err
+	}
+
+	if beforeFields != nil && afterFields != nil {
+		for name, value := range beforeFields {
+			if reflect.DeepEqual(value, afterFields[name]) {
+				delete(beforeFields, name)
+				delete(afterFields, name)
+			}
+		}
+	}
+	for _, fields := range []map[string]any{beforeFields, afterFields} {
+		for name, value := range fields {
+			if auditSecretFields[name] && !auditEmpty(value) {
+				fields[name] = structures.AuditMask
+			}
+			if (beforeFields == nil || afterFields == nil) && auditEmpty(value) {
+				delete(fields, name)
+			}
+		}
+	}
+
+	encodedBefore, err := auditEncode(beforeFields)
+	if err != nil {
+		return "", "", err
+	}
+	encodedAfter, err := auditEncode(afterFields)
+	if err != nil {
+		return "", "", err
+	}
+	return encodedBefore, encodedAfter, nil
+}
+
+// auditFields Exported fields of value by name, nil for nil value
+func auditFields(value any) (map[string]any, error) {
+	if value == nil || (reflect.ValueOf(value).Kind() == reflect.Pointer && reflect.ValueOf(value).IsNil()) {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]any{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func auditEmpty(value any) bool {
+	return value == nil || reflect.ValueOf(value).IsZero()
+}
+
+func auditEncode(fields map[string]any) (string, error) {
+	if len(fields) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
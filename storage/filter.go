@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	PageSizeDefault = 50
+	PageSizeMax     = 500
+
+	ProjectUpdateResultSuccess  = 1
+	ProjectUpdateResultFailure  = 2
+	ProjectUpdateResultDeferred = 3
+)
+
+// Page Part of history list, Number starts from 1
+type Page struct {
+	Number int
+	Size   int
+}
+
+// Sort Column key from list of allowed columns and direction
+type Sort struct {
+	Column string
+	Desc   bool
+}
+
+// PlaybookRunFilter Playbook runs history conditions, zero values are not applied, From is inclusive and To is exclusive.
+// Task conditions select runs with at least one parsed host result matching all of them
+type PlaybookRunFilter struct {
+	UserId      string
+	Mode        int
+	Result      int
+	From        time.Time
+	To          time.Time
+	Task        string
+	Host        string
+	TaskStatus  int
+	TaskChanged bool
+	Sort        Sort
+	Page        Page
+}
+
+// ProjectUpdateFilter Project updates history conditions, zero values are not applied, From is inclusive and To is exclusive
+type ProjectUpdateFilter struct {
+	Result int
+	From   time.Time
+	To     time.Time
+	Sort   Sort
+	Page   Page
+}
+
+var PlaybookRunSortColumns = map[string]string{
+	"date":   "playbook_runs.start_time",
+	"user":   "users.login",
+	"mode":   "playbook_runs.mode",
+	"result": "playbook_runs.result",
+}
+
+var ProjectUpdateSortColumns = map[string]string{
+	"date":     "project_updates.date",
+	"result":   "project_updates.success",
+	"revision": "project_updates.revision",
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func (p Page) limit() int {
+	if p.Size <= 0 {
+		return PageSizeDefault
+	}
+	if p.Size > PageSizeMax {
+		return PageSizeMax
+	}
+	return p.Size
+}
+
+func (p Page) offset() int {
+	if p.Number <= 1 {
+		return 0
+	}
+	return (p.Number - 1) * p.limit()
+}
+
+// orderBy Order clause from allowed columns, date descending is used for unknown columns
+func (s Sort) orderBy(columns map[string]string, defaultColumn string) string {
+	column, ok := columns[s.Column]
+	desc := s.Desc
+	if !ok {
+		column = columns[defaultColumn]
+		desc = true
+	}
+	direction := "asc"
+	if desc {
+		direction = "desc"
+	}
+	//stable order between pages for equal values
+	return fmt.Sprintf("order by %s %s, %s desc", column, direction, columns[defaultColumn])
+}
+
+// likeContains Pattern for like condition matching text anywhere, wildcards in text are escaped
+func likeContains(text string) string {
+	return "%" + likeEscaper.Replace(strings.ToLower(text)) + "%"
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+///////////////////////////////////////////////////////////////////////////////
+
+// conditions Builds where clause with numbered placeholders
+type conditions struct {
+	clauses []string
+	args    []any
+}
+
+func (c *conditions) add(clause string, arg any) {
+	c.args = append(c.args, arg)
+	c.clauses = append(c.clauses, strings.ReplaceAll(clause, "?", fmt.Sprintf("$%d", len(c.args))))
+}
+
+// addAll Clause with several placeholders, arguments are in order of placeholders
+func (c *conditions) addAll(clause string, args ...any) {
+	for _, arg := range args {
+		c.args = append(c.args, arg)
+		clause = strings.Replace(clause, "?", fmt.Sprintf("$%d", len(c.args)), 1)
+	}
+	c.clauses = append(c.clauses, clause)
+}
+
+func (c *conditions) addRaw(clause string) {
+	c.clauses = append(c.clauses, clause)
+}
+
+func (c *conditions) where() string {
+	if len(c.clauses) == 0 {
+		return ""
+	}
+	return "where " + strings.Join(c.clauses, " and ")
+}
+
+// page Placeholders for limit and offset, appends page values to arguments
+func (c *conditions) page(page Page) (string, []any) {
+	args := append(append([]any{}, c.args...), page.limit(), page.offset())
+	return fmt.Sprintf("limit $%d offset $%d", len(args)-1, len(args)), args
+}
@@ -1,22 +1,43 @@
 package storage
 
 import (
+	"database/sql"
 	"ensemble/storage/structures"
 	"errors"
+	"fmt"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
+	"strings"
 	"time"
 )
 
+type Dialect int
+
+const (
+	DialectPostgres Dialect = 1
+	DialectSqlite   Dialect = 2
+)
+
 type Configuration struct {
 	Url    string
 	Secret string
 }
 
+// Storage Store implementation on top of SQL database, queries are shared by all dialects
 type Storage struct {
-	config Configuration
-	db     *sqlx.DB
+	config  Configuration
+	dialect Dialect
+	conn    *sqlx.DB
+	db      database
+}
+
+// database Queries of connection and transaction, so entity methods work inside transaction as is
+type database interface {
+	Get(dest any, query string, args ...any) error
+	Select(dest any, query string, args ...any) error
+	Exec(query string, args ...any) (sql.Result, error)
+	NamedExec(query string, arg any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
 }
 
 type Scanner interface {
@@ -25,13 +46,25 @@ type Scanner interface {
 
 ///////////////////////////////////////////////////////////////////////////////
 
+// New Opens database chosen by url scheme and applies migrations
 func New(configuration Configuration) (*Storage, error) {
-	db, err := sqlx.Open("postgres", configuration.Url)
+	dialect, err := urlDialect(configuration.Url)
 	if err != nil {
 		return nil, err
 	}
 
-	migrator, err := NewMigrator(db)
+	var db *sqlx.DB
+	switch dialect {
+	case DialectSqlite:
+		db, err = openSqlite(configuration.Url)
+	default:
+		db, err = openPostgres(configuration.Url)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := NewMigrator(db, dialect)
 	if err != nil {
 		return nil, err
 	}
@@ -39,14 +72,64 @@ func New(configuration Configuration) (*Storage, error) {
 		return nil, err
 	}
 
-	return &Storage{
-		config: configuration,
-		db:     db,
-	}, nil
+	s := &Storage{
+		config:  configuration,
+		dialect: dialect,
+		conn:    db,
+		db:      db,
+	}
+	if err := s.secretPrepare(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// urlDialect PostgreSQL is used for postgres:// urls and key=value connection strings
+func urlDialect(url string) (Dialect, error) {
+	scheme, _, found := strings.Cut(url, "://")
+	if !found {
+		return DialectPostgres, nil
+	}
+	switch scheme {
+	case "postgres", "postgresql":
+		return DialectPostgres, nil
+	case "sqlite":
+		return DialectSqlite, nil
+	default:
+		return 0, fmt.Errorf("unsupported database url scheme %s", scheme)
+	}
 }
 
 func (s *Storage) Close() error {
-	return s.db.Close()
+	if s.conn == nil {
+		return errors.New("storage bound to transaction can not be closed")
+	}
+	return s.conn.Close()
+}
+
+// Transaction Runs f with store bound to one transaction, changes are committed when f succeeds
+func (s *Storage) Transaction(f func(store Store) error) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Warnf("rollback error: %s", err)
+		}
+	}()
+
+	if err := f(&Storage{config: s.config, dialect: s.dialect, db: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Storage) begin() (*sqlx.Tx, error) {
+	if s.conn == nil {
+		return nil, errors.New("nested transactions are not supported")
+	}
+	return s.conn.Beginx()
 }
 
 func (s *Storage) queryExists(query string, args ...any) bool {
@@ -147,6 +230,24 @@ func (s *Storage) UserGetAll() ([]*structures.User, error) {
 	return users, nil
 }
 
+// UserGetByPlaybookRuns Users who started runs of playbook
+func (s *Storage) UserGetByPlaybookRuns(playbookId string) ([]*structures.User, error) {
+	query := `select id, login, password, role 
+              from users 
+              where not coalesce(deleted, false) 
+                and exists (select 1
+                            from playbook_runs
+                            where playbook_runs.user_id = users.id
+                              and playbook_runs.playbook_id = $1
+                              and not coalesce(playbook_runs.deleted, false))
+              order by login`
+	var users []*structures.User
+	if err := s.db.Select(&users, query, playbookId); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 func (s *Storage) UserInsert(user *structures.User) error {
 	if user == nil {
 		return errors.New("insert nil user")
@@ -251,8 +352,17 @@ func (s *Storage) projectDecrypt(p *structures.Project) (*structures.Project, er
 		return nil, err
 	}
 
+	inventoryEnvDecrypted := ""
+	if len(p.InventoryEnv) != 0 {
+		inventoryEnvDecrypted, err = DecryptString(s.config.Secret, p.InventoryEnv)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	p.RepositoryPassword = repositoryPasswordDecrypted
 	p.VaultPassword = vaultPasswordDecrypted
+	p.InventoryEnv = inventoryEnvDecrypted
 	return p, nil
 }
 
@@ -262,7 +372,7 @@ func (s *Storage) projectDecryptAll(projects []*structures.Project) []*structure
 	for _, project := range projects {
 		decrypted, err := s.projectDecrypt(project)
 		if err != nil {
-			log.Warnf("unable to decrypt project: %s", err)
+			log.Errorf("unable to decrypt project %s: %s", project.Id, err)
 			continue
 		}
 		decryptedProjects = append(decryptedProjects, decrypted)
@@ -282,8 +392,17 @@ func (s *Storage) projectEncrypt(p *structures.Project) (*structures.Project, er
 		return nil, err
 	}
 
+	inventoryEnvEncrypted := ""
+	if len(p.InventoryEnv) != 0 {
+		inventoryEnvEncrypted, err = EncryptString(s.config.Secret, p.InventoryEnv)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	p.RepositoryPassword = repositoryPasswordEncrypted
 	p.VaultPassword = vaultPasswordEncrypted
+	p.InventoryEnv = inventoryEnvEncrypted
 
 	return p, nil
 }
@@ -304,13 +423,21 @@ func (s *Storage) ProjectExistsByName(name string) bool {
 	return s.queryExists(query, name)
 }
 
+func (s *Storage) ProjectExistsByKey(keyId string) bool {
+	query := `select count(1) 
+              from projects 
+              where repo_key_id = $1 
+                and not coalesce(deleted, false)`
+	return s.queryExists(query, keyId)
+}
+
 func (s *Storage) ProjectGet(id string) (*structures.Project, error) {
-	query := `select id, name, description, 
-                     repo_url, repo_login, repo_password, repo_branch, 
-                     inventory, inventory_list, 
+	query := `select id, name, description, source_type, source_path,
+                     repo_url, repo_login, repo_password, repo_branch, repo_revision_type, repo_revision, repo_key_id, repo_host_keys, repo_submodules, repo_lfs,
+                     inventory, inventory_list, inventory_default, inventory_script_list, inventory_plugin_list, inventory_env, inventory_protected_list,
                      collections_list,
-                     variables, variables_list, variables_main, variables_vault,
-                     vault_password
+                     variables, variables_list, variables_main, variables_vault, variables_main_file, variables_vault_file,
+                     vault_password, update_schedule, update_policy
               from projects
               where id = $1 
                 and not coalesce(deleted, false)`
@@ -323,12 +450,12 @@ func (s *Storage) ProjectGet(id string) (*structures.Project, error) {
 }
 
 func (s *Storage) ProjectGetAll() ([]*structures.Project, error) {
-	query := `select id, name, description, 
-                     repo_url, repo_login, repo_password, repo_branch, 
-                     inventory, inventory_list, 
+	query := `select id, name, description, source_type, source_path,
+                     repo_url, repo_login, repo_password, repo_branch, repo_revision_type, repo_revision, repo_key_id, repo_host_keys, repo_submodules, repo_lfs,
+                     inventory, inventory_list, inventory_default, inventory_script_list, inventory_plugin_list, inventory_env, inventory_protected_list,
                      collections_list,
-                     variables, variables_list, variables_main, variables_vault,
-                     vault_password
+                     variables, variables_list, variables_main, variables_vault, variables_main_file, variables_vault_file,
+                     vault_password, update_schedule, update_policy
               from projects
               where not coalesce(deleted, false)
               order by name`
@@ -341,12 +468,12 @@ func (s *Storage) ProjectGetAll() ([]*structures.Project, error) {
 }
 
 func (s *Storage) ProjectGetByUser(userId string) ([]*structures.Project, error) {
-	query := `select id, name, description, 
-                     repo_url, repo_login, repo_password, repo_branch, 
-                     inventory, inventory_list, 
+	query := `select id, name, description, source_type, source_path,
+                     repo_url, repo_login, repo_password, repo_branch, repo_revision_type, repo_revision, repo_key_id, repo_host_keys, repo_submodules, repo_lfs,
+                     inventory, inventory_list, inventory_default, inventory_script_list, inventory_plugin_list, inventory_env, inventory_protected_list,
                      collections_list,
-                     variables, variables_list, variables_main, variables_vault,
-                     vault_password
+                     variables, variables_list, variables_main, variables_vault, variables_main_file, variables_vault_file,
+                     vault_password, update_schedule, update_policy
               from projects 
                 left join projects_users_access on (projects_users_access.project_id = projects.id) 
               where not coalesce(deleted, false) 
@@ -367,9 +494,15 @@ func (s *Storage) ProjectInsert(project *structures.Project) error {
 	if len(project.Name) == 0 {
 		return errors.New("project insert empty name")
 	}
-	if len(project.RepositoryUrl) == 0 {
+	if project.SourceType == 0 {
+		project.SourceType = structures.ProjectSourceGit
+	}
+	if project.IsGit() && len(project.RepositoryUrl) == 0 {
 		return errors.New("project insert empty repository url")
 	}
+	if project.SourceType == structures.ProjectSourceLocal && len(project.SourcePath) == 0 {
+		return errors.New("project insert empty source path")
+	}
 	if s.ProjectExistsByName(project.Name) {
 		return errors.New("project insert name exists")
 	}
@@ -379,19 +512,25 @@ func (s *Storage) ProjectInsert(project *structures.Project) error {
 	if len(project.RepositoryBranch) == 0 {
 		project.RepositoryBranch = structures.ProjectDefaultBranchName
 	}
+	if project.RevisionType == 0 {
+		project.RevisionType = structures.ProjectRevisionBranch
+	}
+	if project.UpdatePolicy == 0 {
+		project.UpdatePolicy = structures.ProjectUpdatePolicySkip
+	}
 
-	query := `insert into projects (id, name, description, 
-							  repo_url, repo_login, repo_password, repo_branch, 
-							  inventory,  inventory_list, 
+	query := `insert into projects (id, name, description, source_type, source_path,
+							  repo_url, repo_login, repo_password, repo_branch, repo_revision_type, repo_revision, repo_key_id, repo_host_keys, repo_submodules, repo_lfs,
+							  inventory, inventory_list, inventory_default, inventory_script_list, inventory_plugin_list, inventory_env, inventory_protected_list,
 							  collections_list,
-							  variables, variables_list, variables_main, variables_vault,
-							  vault_password) 
-			   values (:id, :name, :description, 
-					   :repo_url, :repo_login, :repo_password, :repo_branch, 
-					   :inventory, :inventory_list, 
+							  variables, variables_list, variables_main, variables_vault, variables_main_file, variables_vault_file,
+							  vault_password, update_schedule, update_policy) 
+			   values (:id, :name, :description, :source_type, :source_path,
+					   :repo_url, :repo_login, :repo_password, :repo_branch, :repo_revision_type, :repo_revision, :repo_key_id, :repo_host_keys, :repo_submodules, :repo_lfs,
+					   :inventory, :inventory_list, :inventory_default, :inventory_script_list, :inventory_plugin_list, :inventory_env, :inventory_protected_list,
 					   :collections_list,
-					   :variables, :variables_list, :variables_main, :variables_vault,
-					   :vault_password)`
+					   :variables, :variables_list, :variables_main, :variables_vault, :variables_main_file, :variables_vault_file,
+					   :vault_password, :update_schedule, :update_policy)`
 
 	projectToSave := *project
 	if _, err := s.projectEncrypt(&projectToSave); err != nil {
@@ -413,9 +552,12 @@ func (s *Storage) ProjectUpdate(project *structures.Project) error {
 	if len(project.Name) == 0 {
 		return errors.New("project update empty name")
 	}
-	if len(project.RepositoryUrl) == 0 {
+	if project.IsGit() && len(project.RepositoryUrl) == 0 {
 		return errors.New("project update empty repository url")
 	}
+	if project.SourceType == structures.ProjectSourceLocal && len(project.SourcePath) == 0 {
+		return errors.New("project update empty source path")
+	}
 
 	existingProject, err := s.ProjectGet(project.Id)
 	if err != nil {
@@ -430,12 +572,19 @@ func (s *Storage) ProjectUpdate(project *structures.Project) error {
 
 	query := `
 		update projects set 
-			name = :name, description = :description, 
+			name = :name, description = :description, source_type = :source_type, source_path = :source_path,
 			repo_url = :repo_url, repo_login = :repo_login, repo_password = :repo_password, repo_branch = :repo_branch,
-			inventory = :inventory, inventory_list = :inventory_list,
+			repo_revision_type = :repo_revision_type, repo_revision = :repo_revision,
+			repo_key_id = :repo_key_id, repo_host_keys = :repo_host_keys,
+			repo_submodules = :repo_submodules, repo_lfs = :repo_lfs,
+			inventory = :inventory, inventory_list = :inventory_list, inventory_default = :inventory_default,
+			inventory_script_list = :inventory_script_list, inventory_plugin_list = :inventory_plugin_list, inventory_env = :inventory_env,
+			inventory_protected_list = :inventory_protected_list,
 			collections_list = :collections_list,
 			variables = :variables, variables_list = :variables_list, variables_main = :variables_main, variables_vault = :variables_vault,
+			variables_main_file = :variables_main_file, variables_vault_file = :variables_vault_file,
 			vault_password = :vault_password, 
+			update_schedule = :update_schedule, update_policy = :update_policy,
 			deleted = false
 		where id = :id`
 
@@ -455,6 +604,36 @@ func (s *Storage) ProjectDelete(id string) error {
 	return err
 }
 
+// ProjectGetDeletedIds Identifiers of deleted projects, their files can be removed
+func (s *Storage) ProjectGetDeletedIds() ([]string, error) {
+	query := `select id from projects where coalesce(deleted, false)`
+
+	var ids []string
+	if err := s.db.Select(&ids, query); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// ProjectGetDeleted Deleted projects with settings, their files and update logs could still keep credentials
+func (s *Storage) ProjectGetDeleted() ([]*structures.Project, error) {
+	query := `select id, name, description, source_type, source_path,
+                     repo_url, repo_login, repo_password, repo_branch, repo_revision_type, repo_revision, repo_key_id, repo_host_keys, repo_submodules, repo_lfs,
+                     inventory, inventory_list, inventory_default, inventory_script_list, inventory_plugin_list, inventory_env, inventory_protected_list,
+                     collections_list,
+                     variables, variables_list, variables_main, variables_vault, variables_main_file, variables_vault_file,
+                     vault_password, update_schedule, update_policy
+              from projects
+              where coalesce(deleted, false)
+              order by name`
+
+	var projects []*structures.Project
+	if err := s.db.Select(&projects, query); err != nil {
+		return nil, err
+	}
+	return s.projectDecryptAll(projects), nil
+}
+
 func (s *Storage) ProjectHasLockedPlaybooks(id string) bool {
 	query := `
 		select count(1)
@@ -501,7 +680,7 @@ func (s *Storage) ProjectUserAccessDelete(projectId, userId string) error {
 ///////////////////////////////////////////////////////////////////////////////
 
 func (s *Storage) ProjectUpdateGet(id string) (*structures.ProjectUpdate, error) {
-	query := `select id, project_id, date, success, revision, log 
+	query := `select id, project_id, date, success, deferred, revision, revision_from, revision_to, changes, log 
               from project_updates 
               where id = $1 
                 and not coalesce(deleted, false)`
@@ -514,7 +693,7 @@ func (s *Storage) ProjectUpdateGet(id string) (*structures.ProjectUpdate, error)
 }
 
 func (s *Storage) ProjectUpdateGetByProject(projectId string) ([]*structures.ProjectUpdate, error) {
-	query := `select id, project_id, date, success, revision,  log 
+	query := `select id, project_id, date, success, deferred, revision, revision_from, revision_to, changes, log 
               from project_updates 
               where project_id = $1 
                 and not coalesce(deleted, false)
@@ -527,8 +706,48 @@ func (s *Storage) ProjectUpdateGetByProject(projectId string) ([]*structures.Pro
 	return updates, nil
 }
 
+// ProjectUpdateFind Page of project updates matching filter and total number of matching updates
+func (s *Storage) ProjectUpdateFind(projectId string, filter ProjectUpdateFilter) ([]*structures.ProjectUpdate, int, error) {
+	c := conditions{}
+	c.add("project_id = ?", projectId)
+	c.addRaw("not coalesce(deleted, false)")
+	switch filter.Result {
+	case ProjectUpdateResultSuccess:
+		c.addRaw("coalesce(success, false)")
+	case ProjectUpdateResultFailure:
+		c.addRaw("not coalesce(success, false) and not deferred")
+	case ProjectUpdateResultDeferred:
+		c.addRaw("deferred")
+	}
+	if !filter.From.IsZero() {
+		c.add("date >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		c.add("date < ?", filter.To)
+	}
+
+	total := 0
+	countQuery := `select count(*) from project_updates ` + c.where()
+	if err := s.db.Get(&total, countQuery, c.args...); err != nil {
+		return nil, 0, err
+	}
+
+	limit, args := c.page(filter.Page)
+	query := `select id, project_id, date, success, deferred, revision, revision_from, revision_to, changes, log 
+              from project_updates 
+              ` + c.where() + `
+              ` + filter.Sort.orderBy(ProjectUpdateSortColumns, "date") + `
+              ` + limit
+
+	var updates []*structures.ProjectUpdate
+	if err := s.db.Select(&updates, query, args...); err != nil {
+		return nil, 0, err
+	}
+	return updates, total, nil
+}
+
 func (s *Storage) ProjectUpdateGetProjectLatest(projectId string) (*structures.ProjectUpdate, error) {
-	query := `select id, project_id, date, success, revision, log 
+	query := `select id, project_id, date, success, deferred, revision, revision_from, revision_to, changes, log 
               from project_updates 
               where project_id = $1 
                 and not coalesce(deleted, false)
@@ -553,24 +772,96 @@ func (s *Storage) ProjectUpdateInsert(update *structures.ProjectUpdate) error {
 		update.Id = NewId()
 	}
 
-	query := `insert into project_updates (id, project_id, date, success, revision, log) 
-              values (:id, :project_id, :date, :success, :revision, :log)`
+	query := `insert into project_updates (id, project_id, date, success, deferred, revision, revision_from, revision_to, changes, log) 
+              values (:id, :project_id, :date, :success, :deferred, :revision, :revision_from, :revision_to, :changes, :log)`
 	_, err := s.db.NamedExec(query, update)
 	return err
 }
 
+func (s *Storage) ProjectUpdateSaveLog(id, revision, log string) error {
+	query := `update project_updates set revision = $1, log = $2 where id = $3`
+	_, err := s.db.Exec(query, revision, log, id)
+	return err
+}
+
 func (s *Storage) ProjectUpdateDelete(id string) error {
 	query := `update project_updates set deleted = true where id = $1`
 	_, err := s.db.Exec(query, id)
 	return err
 }
 
+///////////////////////////////////////////////////////////////////////////////
+//Project Archives
+///////////////////////////////////////////////////////////////////////////////
+
+func (s *Storage) ProjectArchiveGet(id string) (*structures.ProjectArchive, error) {
+	query := `select id, project_id, user_id, date, filename, checksum, size 
+              from project_archives 
+              where id = $1 
+                and not coalesce(deleted, false)`
+
+	var archive structures.ProjectArchive
+	if err := s.db.Get(&archive, query, id); err != nil {
+		return nil, err
+	}
+	return &archive, nil
+}
+
+func (s *Storage) ProjectArchiveGetByProject(projectId string) ([]*structures.ProjectArchive, error) {
+	query := `select id, project_id, user_id, date, filename, checksum, size 
+              from project_archives 
+              where project_id = $1 
+                and not coalesce(deleted, false)
+		      order by date desc`
+
+	var archives []*structures.ProjectArchive
+	if err := s.db.Select(&archives, query, projectId); err != nil {
+		return nil, err
+	}
+	return archives, nil
+}
+
+func (s *Storage) ProjectArchiveGetProjectLatest(projectId string) (*structures.ProjectArchive, error) {
+	query := `select id, project_id, user_id, date, filename, checksum, size 
+              from project_archives 
+              where project_id = $1 
+                and not coalesce(deleted, false)
+		      order by date desc
+			  limit 1`
+
+	var archive structures.ProjectArchive
+	if err := s.db.Get(&archive, query, projectId); err != nil {
+		return nil, err
+	}
+	return &archive, nil
+}
+
+func (s *Storage) ProjectArchiveInsert(archive *structures.ProjectArchive) error {
+	if archive == nil {
+		return errors.New("project archive insert nil")
+	}
+	if len(archive.ProjectId) == 0 {
+		return errors.New("project archive insert empty project id")
+	}
+	if len(archive.Checksum) == 0 {
+		return errors.New("project archive insert empty checksum")
+	}
+	if len(archive.Id) == 0 {
+		archive.Id = NewId()
+	}
+
+	query := `insert into project_archives (id, project_id, user_id, date, filename, checksum, size) 
+              values (:id, :project_id, :user_id, :date, :filename, :checksum, :size)`
+	_, err := s.db.NamedExec(query, archive)
+	return err
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 //Playbooks
 ///////////////////////////////////////////////////////////////////////////////
 
 func (s *Storage) PlaybookGet(id string) (*structures.Playbook, error) {
-	query := `select id, project_id, filename, name, description, locked 
+	query := `select id, project_id, filename, name, description, category, tags, dangerous, survey, locked, syntax_valid, syntax_error, metadata_error 
               from playbooks 
               where id = $1 
                 and not coalesce(deleted, false)`
@@ -583,7 +874,7 @@ func (s *Storage) PlaybookGet(id string) (*structures.Playbook, error) {
 }
 
 func (s *Storage) PlaybookGetByProject(projectId string) ([]*structures.Playbook, error) {
-	query := `select id, project_id, filename, name, description, locked 
+	query := `select id, project_id, filename, name, description, category, tags, dangerous, survey, locked, syntax_valid, syntax_error, metadata_error 
               from playbooks 
               where project_id = $1 
                 and not coalesce(deleted, false)
@@ -610,8 +901,8 @@ func (s *Storage) PlaybookInsert(playbook *structures.Playbook) error {
 		playbook.Id = NewId()
 	}
 
-	query := `insert into playbooks (id, project_id, filename, name, description, locked) 
-              values (:id, :project_id, :filename, :name, :description, :locked)`
+	query := `insert into playbooks (id, project_id, filename, name, description, category, tags, dangerous, survey, locked, metadata_error) 
+              values (:id, :project_id, :filename, :name, :description, :category, :tags, :dangerous, :survey, :locked, :metadata_error)`
 	_, err := s.db.NamedExec(query, playbook)
 	return err
 }
@@ -642,7 +933,9 @@ func (s *Storage) PlaybookUpdate(playbook *structures.Playbook) error {
 	}
 
 	query := `update playbooks 
-              set filename = :filename, name = :name, description = :description, locked = :locked, deleted = false 
+              set filename = :filename, name = :name, description = :description, 
+                  category = :category, tags = :tags, dangerous = :dangerous, survey = :survey, 
+                  locked = :locked, metadata_error = :metadata_error, deleted = false 
               where id = :id`
 	_, err = s.db.NamedExec(query, playbook)
 	return err
@@ -654,6 +947,13 @@ func (s *Storage) PlaybookDelete(id string) error {
 	return err
 }
 
+// PlaybookSaveSyntax Saves result of playbook syntax check
+func (s *Storage) PlaybookSaveSyntax(id string, valid bool, syntaxError string) error {
+	query := `update playbooks set syntax_valid = $1, syntax_error = $2 where id = $3`
+	_, err := s.db.Exec(query, valid, syntaxError, id)
+	return err
+}
+
 func (s *Storage) PlaybookLock(id string, value bool) error {
 	query := `update playbooks set locked = $1 where id = $2`
 	_, err := s.db.Exec(query, value, id)
@@ -665,7 +965,8 @@ func (s *Storage) PlaybookLock(id string, value bool) error {
 ///////////////////////////////////////////////////////////////////////////////
 
 func (s *Storage) PlaybookRunGet(id string) (*structures.PlaybookRun, error) {
-	query := `select id, playbook_id, user_id, mode, start_time, finish_time, result, inventory_file, variables_file
+	query := `select id, playbook_id, user_id, mode, start_time, finish_time, result, inventory_file, variables_file, extra_vars, hosts,
+                     stats_ok, stats_changed, stats_failures, stats_skipped, stats_unreachable, stats_ignored, results_parsed
               from playbook_runs 
               where id = $1 
                 and not coalesce(deleted, false)`
@@ -678,7 +979,8 @@ func (s *Storage) PlaybookRunGet(id string) (*structures.PlaybookRun, error) {
 }
 
 func (s *Storage) PlaybookRunGetLatest(playbookId string) (*structures.PlaybookRun, error) {
-	query := `select id, playbook_id, user_id, mode, start_time, finish_time, result, inventory_file, variables_file
+	query := `select id, playbook_id, user_id, mode, start_time, finish_time, result, inventory_file, variables_file, extra_vars, hosts,
+                     stats_ok, stats_changed, stats_failures, stats_skipped, stats_unreachable, stats_ignored, results_parsed
               from playbook_runs 
               where playbook_id = $1 
                 and not coalesce(deleted, false)
@@ -693,7 +995,8 @@ func (s *Storage) PlaybookRunGetLatest(playbookId string) (*structures.PlaybookR
 }
 
 func (s *Storage) PlaybookRunGetByPlaybook(playbookId string) ([]*structures.PlaybookRun, error) {
-	query := `select id, playbook_id, user_id, mode, start_time, finish_time, result, inventory_file, variables_file
+	query := `select id, playbook_id, user_id, mode, start_time, finish_time, result, inventory_file, variables_file, extra_vars, hosts,
+                     stats_ok, stats_changed, stats_failures, stats_skipped, stats_unreachable, stats_ignored, results_parsed
               from playbook_runs 
               where playbook_id = $1 
                 and not coalesce(deleted, false)
@@ -706,6 +1009,76 @@ func (s *Storage) PlaybookRunGetByPlaybook(playbookId string) ([]*structures.Pla
 	return runs, nil
 }
 
+// PlaybookRunFind Page of playbook runs matching filter and total number of matching runs
+func (s *Storage) PlaybookRunFind(playbookId string, filter PlaybookRunFilter) ([]*structures.PlaybookRun, int, error) {
+	c := conditions{}
+	c.add("playbook_runs.playbook_id = ?", playbookId)
+	c.addRaw("not coalesce(playbook_runs.deleted, false)")
+	if len(filter.UserId) != 0 {
+		c.add("playbook_runs.user_id = ?", filter.UserId)
+	}
+	if filter.Mode != 0 {
+		c.add("playbook_runs.mode = ?", filter.Mode)
+	}
+	if filter.Result != 0 {
+		c.add("playbook_runs.result = ?", filter.Result)
+	}
+	if !filter.From.IsZero() {
+		c.add("playbook_runs.start_time >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		c.add("playbook_runs.start_time < ?", filter.To)
+	}
+	if len(filter.Task) != 0 || len(filter.Host) != 0 || filter.TaskStatus != 0 || filter.TaskChanged {
+		var clauses []string
+		var args []any
+		if len(filter.Task) != 0 {
+			clauses = append(clauses, `lower(run_tasks.name) like ? escape '\'`)
+			args = append(args, likeContains(filter.Task))
+		}
+		if len(filter.Host) != 0 {
+			clauses = append(clauses, "run_task_results.host = ?")
+			args = append(args, filter.Host)
+		}
+		if filter.TaskStatus != 0 {
+			clauses = append(clauses, "run_task_results.status = ?")
+			args = append(args, filter.TaskStatus)
+		}
+		if filter.TaskChanged {
+			clauses = append(clauses, "run_task_results.changed")
+		}
+		c.addAll(`exists (select 1 
+                          from run_task_results 
+                            join run_tasks on (run_tasks.id = run_task_results.task_id) 
+                          where run_task_results.run_id = playbook_runs.id 
+                            and `+strings.Join(clauses, " and ")+`)`, args...)
+	}
+
+	total := 0
+	countQuery := `select count(*) from playbook_runs ` + c.where()
+	if err := s.db.Get(&total, countQuery, c.args...); err != nil {
+		return nil, 0, err
+	}
+
+	limit, args := c.page(filter.Page)
+	query := `select playbook_runs.id, playbook_runs.playbook_id, playbook_runs.user_id, playbook_runs.mode, 
+                     playbook_runs.start_time, playbook_runs.finish_time, playbook_runs.result, 
+                     playbook_runs.inventory_file, playbook_runs.variables_file, playbook_runs.extra_vars, playbook_runs.hosts,
+                     playbook_runs.stats_ok, playbook_runs.stats_changed, playbook_runs.stats_failures, playbook_runs.stats_skipped, 
+                     playbook_runs.stats_unreachable, playbook_runs.stats_ignored, playbook_runs.results_parsed
+              from playbook_runs
+                left join users on (users.id = playbook_runs.user_id) 
+              ` + c.where() + `
+              ` + filter.Sort.orderBy(PlaybookRunSortColumns, "date") + `
+              ` + limit
+
+	var runs []*structures.PlaybookRun
+	if err := s.db.Select(&runs, query, args...); err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
+
 func (s *Storage) PlaybookRunInsert(run *structures.PlaybookRun) error {
 	if run == nil {
 		return errors.New("playbook run insert nil")
@@ -720,8 +1093,8 @@ func (s *Storage) PlaybookRunInsert(run *structures.PlaybookRun) error {
 		run.Id = NewId()
 	}
 
-	query := `insert into playbook_runs (id, playbook_id, user_id, mode, start_time, finish_time, result, inventory_file, variables_file)
-              values (:id, :playbook_id, :user_id, :mode, :start_time, :finish_time, :result, :inventory_file, :variables_file)`
+	query := `insert into playbook_runs (id, playbook_id, user_id, mode, start_time, finish_time, result, inventory_file, variables_file, extra_vars, hosts)
+              values (:id, :playbook_id, :user_id, :mode, :start_time, :finish_time, :result, :inventory_file, :variables_file, :extra_vars, :hosts)`
 	_, err := s.db.NamedExec(query, run)
 	return err
 }
@@ -756,7 +1129,7 @@ func (s *Storage) PlaybookRunUpdate(run *structures.PlaybookRun) error {
 
 	query := `update playbook_runs 
               set mode = :mode, start_time = :start_time, finish_time = :finish_time, result = :result, 
-                  inventory_file = :inventory_file, variables_file = :variables_file, deleted = false
+                  inventory_file = :inventory_file, variables_file = :variables_file, extra_vars = :extra_vars, hosts = :hosts, deleted = false
               where id = :id`
 	_, err = s.db.NamedExec(query, run)
 	return err
@@ -772,6 +1145,20 @@ func (s *Storage) PlaybookRunDelete(id string) error {
 //Run Results
 ///////////////////////////////////////////////////////////////////////////////
 
+// RunResultGetError Error output of run without ansible output, which is parsed into run tasks
+func (s *Storage) RunResultGetError(id string) (string, error) {
+	query := `select coalesce(error, '')
+              from run_results 
+              where id = $1 
+                and not coalesce(deleted, false)`
+
+	var runError string
+	if err := s.db.Get(&runError, query, id); err != nil {
+		return "", err
+	}
+	return runError, nil
+}
+
 func (s *Storage) RunResultGet(id string) (*structures.RunResult, error) {
 	query := `select id, run_id, output, error
               from run_results 
@@ -785,6 +1172,34 @@ func (s *Storage) RunResultGet(id string) (*structures.RunResult, error) {
 	return &result, nil
 }
 
+// RunResultSizeByProject Length of stored run output of each project
+func (s *Storage) RunResultSizeByProject() (map[string]int64, error) {
+	query := `select playbooks.project_id, 
+                     sum(length(coalesce(run_results.output, '')) + length(coalesce(run_results.error, ''))) as size
+              from run_results
+                join playbook_runs on (playbook_runs.id = run_results.run_id)
+                join playbooks on (playbooks.id = playbook_runs.playbook_id)
+              where not coalesce(run_results.deleted, false)
+              group by playbooks.project_id`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sizes := make(map[string]int64)
+	for rows.Next() {
+		var projectId string
+		var size int64
+		if err := rows.Scan(&projectId, &size); err != nil {
+			return nil, err
+		}
+		sizes[projectId] = size
+	}
+	return sizes, rows.Err()
+}
+
 func (s *Storage) RunResultInsert(result *structures.RunResult) error {
 	if result == nil {
 		return errors.New("run result insert nil")
@@ -855,7 +1270,7 @@ func (s *Storage) keyDecryptAll(keys []*structures.Key) []*structures.Key {
 	for _, key := range keys {
 		decrypted, err := s.keyDecrypt(key)
 		if err != nil {
-			log.Warnf("unable to decrypt key: %s", err)
+			log.Errorf("unable to decrypt key %s: %s", key.Id, err)
 			continue
 		}
 		decryptedKeys = append(decryptedKeys, decrypted)
@@ -922,6 +1337,28 @@ func (s *Storage) KeyInsert(key *structures.Key) error {
 	return nil
 }
 
+func (s *Storage) KeyUpdate(key *structures.Key) error {
+	if key == nil {
+		return errors.New("key update nil")
+	}
+	if len(key.Id) == 0 {
+		return errors.New("key update empty id")
+	}
+	if len(key.Name) == 0 {
+		return errors.New("key update empty name")
+	}
+
+	query := `update keys set name = :name, password = :password where id = :id`
+	keyToSave := *key
+	if _, err := s.keyEncrypt(&keyToSave); err != nil {
+		return err
+	}
+	if _, err := s.db.NamedExec(query, keyToSave); err != nil {
+		return err
+	}
+	return nil
+}
+
 func (s *Storage) KeyDelete(id string) error {
 	query := `update keys set deleted = true where id = $1`
 	_, err := s.db.Exec(query, id)
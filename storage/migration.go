@@ -10,25 +10,35 @@ type Migration struct {
 	version int
 	name    string
 	query   string
+	sqlite  string //replaces query on SQLite when syntax differs
 }
 
 type Migrator struct {
 	db         *sqlx.DB
+	dialect    Dialect
 	migrations []Migration
 }
 
 ///////////////////////////////////////////////////////////////////////////////
 
-func NewMigrator(db *sqlx.DB) (*Migrator, error) {
+func NewMigrator(db *sqlx.DB, dialect Dialect) (*Migrator, error) {
 	if db == nil {
 		return nil, errors.New("nil database")
 	}
 	return &Migrator{
 		db:         db,
+		dialect:    dialect,
 		migrations: migrations,
 	}, nil
 }
 
+func (m Migration) dialectQuery(dialect Dialect) string {
+	if dialect == DialectSqlite && len(m.sqlite) != 0 {
+		return m.sqlite
+	}
+	return m.query
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 
 var migrations = []Migration{
@@ -206,6 +216,7 @@ var migrations = []Migration{
 		version: 26,
 		name:    "store projects.repo_password as text",
 		query:   `alter table projects alter column repo_password type text`,
+		sqlite:  `select 1`,
 	}, {
 		version: 27,
 		name:    "playbook_runs.inventory_file field",
@@ -231,6 +242,375 @@ var migrations = []Migration{
 		version: 31,
 		name:    "playbook_runs.variables_file null",
 		query:   `update playbook_runs set variables_file='' where variables_file is null`,
+	}, {
+		version: 32,
+		name:    "projects.update_schedule field",
+		query:   `alter table projects add column update_schedule varchar(250) not null default ''`,
+	}, {
+		version: 33,
+		name:    "projects.repo_key_id field",
+		query:   `alter table projects add column repo_key_id varchar(64) not null default ''`,
+	}, {
+		version: 34,
+		name:    "projects.repo_host_keys field",
+		query:   `alter table projects add column repo_host_keys text not null default ''`,
+	}, {
+		version: 35,
+		name:    "projects.repo_revision_type field",
+		query:   `alter table projects add column repo_revision_type int not null default 1`,
+	}, {
+		version: 36,
+		name:    "projects.repo_revision field",
+		query:   `alter table projects add column repo_revision varchar(250) not null default ''`,
+	}, {
+		version: 37,
+		name:    "project_updates.revision_from field",
+		query:   `alter table project_updates add column revision_from varchar(64) not null default ''`,
+	}, {
+		version: 38,
+		name:    "project_updates.revision_to field",
+		query:   `alter table project_updates add column revision_to varchar(64) not null default ''`,
+	}, {
+		version: 39,
+		name:    "project_updates.changes field",
+		query:   `alter table project_updates add column changes text not null default ''`,
+	}, {
+		version: 40,
+		name:    "projects.inventory_default field",
+		query:   `alter table projects add column inventory_default varchar(250) not null default 'inventories/main.yml'`,
+	}, {
+		version: 41,
+		name:    "projects.variables_main_file field",
+		query:   `alter table projects add column variables_main_file varchar(250) not null default ''`,
+	}, {
+		version: 42,
+		name:    "projects.variables_vault_file field",
+		query:   `alter table projects add column variables_vault_file varchar(250) not null default ''`,
+	}, {
+		version: 43,
+		name:    "projects.variables_main_file and variables_vault_file values",
+		query: `
+			update projects set 
+				variables_main_file = case when variables_main then 'vars/main.yml' else '' end,
+				variables_vault_file = case when variables_vault then 'vars/vault.yml' else '' end
+		`,
+	}, {
+		version: 44,
+		name:    "projects inventory paths relative to repository root",
+		query: `
+			update projects set 
+				inventory = case when coalesce(inventory, '') = '' then inventory else 'inventories/' || inventory end,
+				inventory_list = case when coalesce(inventory_list, '') = '' then inventory_list else 'inventories/' || replace(inventory_list, '|', '|inventories/') end
+		`,
+	}, {
+		version: 45,
+		name:    "projects variables paths relative to repository root",
+		query: `
+			update projects set 
+				variables = case when coalesce(variables, '') = '' then variables else 'vars/' || variables end,
+				variables_list = case when coalesce(variables_list, '') = '' then variables_list else 'vars/' || replace(variables_list, '|', '|vars/') end
+		`,
+	}, {
+		version: 46,
+		name:    "playbook_runs inventory and variables paths relative to repository root",
+		query: `
+			update playbook_runs set 
+				inventory_file = case when inventory_file = '' then inventory_file else 'inventories/' || inventory_file end,
+				variables_file = case when variables_file = '' then variables_file else 'vars/' || variables_file end
+		`,
+	}, {
+		version: 47,
+		name:    "playbooks.category field",
+		query:   `alter table playbooks add column category varchar(250) not null default ''`,
+	}, {
+		version: 48,
+		name:    "playbooks.tags field",
+		query:   `alter table playbooks add column tags text not null default ''`,
+	}, {
+		version: 49,
+		name:    "playbooks.dangerous field",
+		query:   `alter table playbooks add column dangerous boolean not null default false`,
+	}, {
+		version: 50,
+		name:    "playbooks.survey field",
+		query:   `alter table playbooks add column survey text not null default ''`,
+	}, {
+		version: 51,
+		name:    "playbook_runs.extra_vars field",
+		query:   `alter table playbook_runs add column extra_vars text not null default ''`,
+	}, {
+		version: 52,
+		name:    "projects.inventory_script_list field",
+		query:   `alter table projects add column inventory_script_list text not null default ''`,
+	}, {
+		version: 53,
+		name:    "projects.inventory_plugin_list field",
+		query:   `alter table projects add column inventory_plugin_list text not null default ''`,
+	}, {
+		version: 54,
+		name:    "projects.inventory_env field",
+		query:   `alter table projects add column inventory_env text not null default ''`,
+	}, {
+		version: 55,
+		name:    "playbook_runs.hosts field",
+		query:   `alter table playbook_runs add column hosts text not null default ''`,
+	}, {
+		version: 56,
+		name:    "projects.inventory_protected_list field",
+		query:   `alter table projects add column inventory_protected_list text not null default ''`,
+	}, {
+		version: 57,
+		name:    "playbooks.syntax_valid field",
+		query:   `alter table playbooks add column syntax_valid boolean not null default true`,
+	}, {
+		version: 58,
+		name:    "playbooks.syntax_error field",
+		query:   `alter table playbooks add column syntax_error text not null default ''`,
+	}, {
+		version: 59,
+		name:    "projects.update_policy field",
+		query:   `alter table projects add column update_policy integer not null default 1`,
+	}, {
+		version: 60,
+		name:    "project_updates.deferred field",
+		query:   `alter table project_updates add column deferred boolean not null default false`,
+	}, {
+		version: 61,
+		name:    "projects.source_type field",
+		query:   `alter table projects add column source_type integer not null default 1`,
+	}, {
+		version: 62,
+		name:    "projects.source_path field",
+		query:   `alter table projects add column source_path text not null default ''`,
+	}, {
+		version: 63,
+		name:    "project_archives table",
+		query: `
+			create table project_archives (
+				id          varchar(64)     primary key,
+				project_id  varchar(64)     not null,
+				user_id     varchar(64)     not null,
+				deleted     boolean,
+				date        timestamp       not null,
+				filename    text            not null,
+				checksum    text            not null,
+				size        bigint          not null
+			)
+		`,
+	}, {
+		version: 64,
+		name:    "project_archives.project_id index",
+		query:   `create index if not exists project_archives_project_id on project_archives (project_id)`,
+	}, {
+		version: 65,
+		name:    "projects.repo_submodules field",
+		query:   `alter table projects add column repo_submodules boolean not null default false`,
+	}, {
+		version: 66,
+		name:    "projects.repo_lfs field",
+		query:   `alter table projects add column repo_lfs boolean not null default false`,
+	}, {
+		version: 67,
+		name:    "settings table",
+		query: `
+			create table settings (
+				name    varchar(250)    primary key,
+				value   text            not null
+			)
+		`,
+	}, {
+		version: 68,
+		name:    "run_plays table",
+		query: `
+			create table run_plays (
+				id          varchar(64)     primary key,
+				run_id      varchar(64)     not null,
+				position    integer         not null,
+				name        text            not null,
+				start_time  timestamp,
+				finish_time timestamp
+			)
+		`,
+	}, {
+		version: 69,
+		name:    "run_plays.run_id index",
+		query:   `create index if not exists run_plays_run_id on run_plays (run_id)`,
+	}, {
+		version: 70,
+		name:    "run_tasks table",
+		query: `
+			create table run_tasks (
+				id          varchar(64)     primary key,
+				run_id      varchar(64)     not null,
+				play_id     varchar(64)     not null,
+				position    integer         not null,
+				name        text            not null,
+				start_time  timestamp,
+				finish_time timestamp
+			)
+		`,
+	}, {
+		version: 71,
+		name:    "run_tasks.run_id index",
+		query:   `create index if not exists run_tasks_run_id on run_tasks (run_id)`,
+	}, {
+		version: 72,
+		name:    "run_tasks.name index",
+		query:   `create index if not exists run_tasks_name on run_tasks (name)`,
+	}, {
+		version: 73,
+		name:    "run_task_results table",
+		query: `
+			create table run_task_results (
+				id          varchar(64)     primary key,
+				run_id      varchar(64)     not null,
+				task_id     varchar(64)     not null,
+				host        varchar(250)    not null,
+				action      varchar(250)    not null,
+				status      integer         not null,
+				changed     boolean         not null,
+				return_code integer         not null,
+				message     text            not null
+			)
+		`,
+	}, {
+		version: 74,
+		name:    "run_task_results.run_id index",
+		query:   `create index if not exists run_task_results_run_id on run_task_results (run_id)`,
+	}, {
+		version: 75,
+		name:    "run_task_results.task_id index",
+		query:   `create index if not exists run_task_results_task_id on run_task_results (task_id)`,
+	}, {
+		version: 76,
+		name:    "run_task_results.host index",
+		query:   `create index if not exists run_task_results_host on run_task_results (host)`,
+	}, {
+		version: 77,
+		name:    "playbook_runs.stats_ok field",
+		query:   `alter table playbook_runs add column stats_ok integer not null default 0`,
+	}, {
+		version: 78,
+		name:    "playbook_runs.stats_changed field",
+		query:   `alter table playbook_runs add column stats_changed integer not null default 0`,
+	}, {
+		version: 79,
+		name:    "playbook_runs.stats_failures field",
+		query:   `alter table playbook_runs add column stats_failures integer not null default 0`,
+	}, {
+		version: 80,
+		name:    "playbook_runs.stats_skipped field",
+		query:   `alter table playbook_runs add column stats_skipped integer not null default 0`,
+	}, {
+		version: 81,
+		name:    "playbook_runs.stats_unreachable field",
+		query:   `alter table playbook_runs add column stats_unreachable integer not null default 0`,
+	}, {
+		version: 82,
+		name:    "playbook_runs.stats_ignored field",
+		query:   `alter table playbook_runs add column stats_ignored integer not null default 0`,
+	}, {
+		version: 83,
+		name:    "playbook_runs.results_parsed field",
+		query:   `alter table playbook_runs add column results_parsed boolean not null default false`,
+	}, {
+		version: 84,
+		name:    "run_results.output full-text index",
+		query:   `create index if not exists run_results_output_fts on run_results using gin (to_tsvector('simple', left(coalesce(output, ''), 250000)))`,
+		sqlite:  `select 1`,
+	}, {
+		version: 85,
+		name:    "run_results.error full-text index",
+		query:   `create index if not exists run_results_error_fts on run_results using gin (to_tsvector('simple', left(coalesce(error, ''), 250000)))`,
+		sqlite:  `select 1`,
+	}, {
+		version: 86,
+		name:    "run_task_results.message full-text index",
+		query:   `create index if not exists run_task_results_message_fts on run_task_results using gin (to_tsvector('simple', left(coalesce(message, ''), 250000)))`,
+		sqlite:  `select 1`,
+	}, {
+		version: 87,
+		name:    "project_updates.log full-text index",
+		query:   `create index if not exists project_updates_log_fts on project_updates using gin (to_tsvector('simple', left(coalesce(log, ''), 250000)))`,
+		sqlite:  `select 1`,
+	}, {
+		version: 88,
+		name:    "audit_events table",
+		query: `
+			create table audit_events (
+				id           varchar(64)     primary key,
+				date         timestamp       not null,
+				user_id      varchar(64)     not null default '',
+				user_login   varchar(250)    not null default '',
+				action       varchar(100)    not null,
+				target_type  varchar(100)    not null default '',
+				target_id    varchar(64)     not null default '',
+				target_name  text            not null default '',
+				value_before text            not null default '',
+				value_after  text            not null default '',
+				ip           varchar(100)    not null default ''
+			)
+		`,
+	}, {
+		version: 89,
+		name:    "audit_events.date index",
+		query:   `create index if not exists audit_events_date on audit_events (date)`,
+	}, {
+		version: 90,
+		name:    "audit_events.user_id index",
+		query:   `create index if not exists audit_events_user_id on audit_events (user_id)`,
+	}, {
+		version: 91,
+		name:    "audit_events.action index",
+		query:   `create index if not exists audit_events_action on audit_events (action)`,
+	}, {
+		version: 92,
+		name:    "audit_events append-only function, update trigger on SQLite",
+		query: `
+			create or replace function audit_events_append_only() returns trigger as $$
+			begin
+				raise exception 'audit events are append-only';
+			end;
+			$$ language plpgsql
+		`,
+		sqlite: `
+			create trigger audit_events_no_update before update on audit_events
+			begin
+				select raise(abort, 'audit events are append-only');
+			end
+		`,
+	}, {
+		version: 93,
+		name:    "audit_events append-only trigger, delete trigger on SQLite",
+		query: `
+			create trigger audit_events_append_only before update or delete on audit_events
+			for each row execute procedure audit_events_append_only()
+		`,
+		sqlite: `
+			create trigger audit_events_no_delete before delete on audit_events
+			begin
+				select raise(abort, 'audit events are append-only');
+			end
+		`,
+	}, {
+		version: 94,
+		name:    "playbooks.metadata_error field",
+		query:   `alter table playbooks add column metadata_error text not null default ''`,
+	}, {
+		version: 95,
+		name:    "store projects.inventory and projects.variables selections as text",
+		query:   `alter table projects alter column inventory type text, alter column variables type text`,
+		sqlite:  `select 1`,
+	}, {
+		version: 96,
+		name:    "project_updates revisions full-text index",
+		query:   `create index if not exists project_updates_revision_fts on project_updates using gin (to_tsvector('simple', coalesce(revision, '') || ' ' || coalesce(revision_from, '') || ' ' || coalesce(revision_to, '')))`,
+		sqlite:  `select 1`,
+	}, {
+		version: 97,
+		name:    "project_updates.changes full-text index",
+		query:   `create index if not exists project_updates_changes_fts on project_updates using gin (to_tsvector('simple', left(coalesce(changes, ''), 250000)))`,
+		sqlite:  `select 1`,
 	},
 }
 
@@ -287,7 +667,7 @@ func (m *Migrator) apply(migration Migration) error {
 		return err
 	}
 
-	if _, err := tx.Exec(migration.query); err != nil {
+	if _, err := tx.Exec(migration.dialectQuery(m.dialect)); err != nil {
 		if err := tx.Rollback(); err != nil {
 			log.Warnf("rollback error: %s", err)
 		}
@@ -0,0 +1,11 @@
+package storage
+
+import (
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// openPostgres Connects to PostgreSQL, url is passed to lib/pq as is, so key=value connection strings work too
+func openPostgres(url string) (*sqlx.DB, error) {
+	return sqlx.Open("postgres", url)
+}
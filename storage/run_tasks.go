@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"database/sql"
+	"ensemble/storage/structures"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+	"sort"
+)
+
+// RunTasksSave Stores plays, tasks and host results of finished run with summary counters, results saved before are replaced.
+// Nil execution only marks run as parsed, so output which is not ansible json is not parsed again
+func (s *Storage) RunTasksSave(runId string, execution *structures.AnsibleExecution) error {
+	if len(runId) == 0 {
+		return errors.New("run tasks save empty run id")
+	}
+
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Warnf("rollback error: %s", err)
+		}
+	}()
+
+	for _, table := range []string{"run_task_results", "run_tasks", "run_plays"} {
+		if _, err := tx.Exec(`delete from `+table+` where run_id = $1`, runId); err != nil {
+			return err
+		}
+	}
+
+	run := structures.PlaybookRun{Id: runId, ResultsParsed: true}
+	if execution != nil {
+		if err := s.runTasksInsert(tx, runId, execution); err != nil {
+			return err
+		}
+		for _, stats := range execution.Stats {
+			run.StatsOk += stats.Ok
+			run.StatsChanged += stats.Changed
+			run.StatsFailures += stats.Failures
+			run.StatsSkipped += stats.Skipped
+			run.StatsUnreachable += stats.Unreachable
+			run.StatsIgnored += stats.Ignored
+		}
+	}
+
+	query := `update playbook_runs
+              set stats_ok = :stats_ok, stats_changed = :stats_changed, stats_failures = :stats_failures, stats_skipped = :stats_skipped,
+                  stats_unreachable = :stats_unreachable, stats_ignored = :stats_ignored, results_parsed = :results_parsed
+              where id = :id`
+	if _, err := tx.NamedExec(query, run); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PlaybookRunGetUnparsed Finished runs with stored result which is not parsed yet, oldest first.
+// Runs without result are left unparsed, result of just finished run could be not saved yet
+func (s *Storage) PlaybookRunGetUnparsed(limit int) ([]*structures.PlaybookRun, error) {
+	query := `select id, playbook_id, user_id, mode, start_time, finish_time, result, inventory_file, variables_file, extra_vars, hosts
+              from playbook_runs
+              where not results_parsed
+                and result <> $1
+                and not coalesce(deleted, false)
+                and exists (select 1 
+                            from run_results 
+                            where run_results.id = playbook_runs.id 
+                              and not coalesce(run_results.deleted, false))
+              order by start_time
+              limit $2`
+
+	var runs []*structures.PlaybookRun
+	if err := s.db.Select(&runs, query, structures.PlaybookRunResultRunning, limit); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// RunPlayGetByRun Plays of run in execution order
+func (s *Storage) RunPlayGetByRun(runId string) ([]*structures.RunPlay, error) {
+	query := `select id, run_id, position, name, start_time, finish_time
+              from run_plays
+              where run_id = $1
+              order by position`
+
+	var plays []*structures.RunPlay
+	if err := s.db.Select(&plays, query, runId); err != nil {
+		return nil, err
+	}
+	return plays, nil
+}
+
+// RunTaskGetByRun Tasks of all run plays in execution order
+func (s *Storage) RunTaskGetByRun(runId string) ([]*structures.RunTask, error) {
+	query := `select id, run_id, play_id, position, name, start_time, finish_time
+              from run_tasks
+              where run_id = $1
+              order by position`
+
+	var tasks []*structures.RunTask
+	if err := s.db.Select(&tasks, query, runId); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func (s *Storage) RunTaskGet(id string) (*structures.RunTask, error) {
+	query := `select id, run_id, play_id, position, name, start_time, finish_time
+              from run_tasks
+              where id = $1`
+
+	var task structures.RunTask
+	if err := s.db.Get(&task, query, id); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// RunTaskResultGetByRun Host results of all run tasks ordered by host
+func (s *Storage) RunTaskResultGetByRun(runId string) ([]*structures.RunTaskResult, error) {
+	query := `select id, run_id, task_id, host, action, status, changed, return_code, message
+              from run_task_results
+              where run_id = $1
+              order by host`
+
+	var results []*structures.RunTaskResult
+	if err := s.db.Select(&results, query, runId); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *Storage) RunTaskResultGet(id string) (*structures.RunTaskResult, error) {
+	query := `select id, run_id, task_id, host, action, status, changed, return_code, message
+              from run_task_results
+              where id = $1`
+
+	var result structures.RunTaskResult
+	if err := s.db.Get(&result, query, id); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func (s *Storage) runTasksInsert(tx *sqlx.Tx, runId string, execution *structures.AnsibleExecution) error {
+	playQuery := `insert into run_plays (id, run_id, position, name, start_time, finish_time)
+                  values (:id, :run_id, :position, :name, :start_time, :finish_time)`
+	taskQuery := `insert into run_tasks (id, run_id, play_id, position, name, start_time, finish_time)
+                  values (:id, :run_id, :play_id, :position, :name, :start_time, :finish_time)`
+	resultQuery := `insert into run_task_results (id, run_id, task_id, host, action, status, changed, return_code, message)
+                    values (:id, :run_id, :task_id, :host, :action, :status, :changed, :return_code, :message)`
+
+	//task positions are numbered through the whole run, so tasks are ordered without joining plays
+	taskPosition := 0
+	for playPosition, ansiblePlay := range execution.Plays {
+		play := structures.RunPlay{
+			Id:         NewId(),
+			RunId:      runId,
+			Position:   playPosition,
+			Name:       ansiblePlay.PlayInfo.Name,
+			StartTime:  ansiblePlay.PlayInfo.Duration.StartTime(),
+			FinishTime: ansiblePlay.PlayInfo.Duration.EndTime(),
+		}
+		if _, err := tx.NamedExec(playQuery, play); err != nil {
+			return err
+		}
+
+		for _, ansibleTask := range ansiblePlay.Tasks {
+			task := structures.RunTask{
+				Id:         NewId(),
+				RunId:      runId,
+				PlayId:     play.Id,
+				Position:   taskPosition,
+				Name:       ansibleTask.TaskInfo.Name,
+				StartTime:  ansibleTask.TaskInfo.Duration.StartTime(),
+				FinishTime: ansibleTask.TaskInfo.Duration.EndTime(),
+			}
+			taskPosition++
+			if _, err := tx.NamedExec(taskQuery, task); err != nil {
+				return err
+			}
+
+			hosts := make([]string, 0, len(ansibleTask.TaskResults))
+			for host := range ansibleTask.TaskResults {
+				hosts = append(hosts, host)
+			}
+			sort.Strings(hosts)
+
+			for _, host := range hosts {
+				ansibleResult := ansibleTask.TaskResults[host]
+				result := structures.RunTaskResult{
+					Id:         NewId(),
+					RunId:      runId,
+					TaskId:     task.Id,
+					Host:       host,
+					Action:     ansibleResult.Action,
+					Status:     ansibleResult.Status(),
+					Changed:    ansibleResult.Changed,
+					ReturnCode: ansibleResult.ReturnCode,
+					Message:    ansibleResult.Message,
+				}
+				if _, err := tx.NamedExec(resultQuery, result); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"ensemble/storage/structures"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	SearchKindAll = ""
+
+	searchSnippetBefore = 80
+	searchSnippetLength = 240
+
+	// searchTextLength Characters of each text indexed for full-text search on PostgreSQL. tsvector is limited
+	// to 1 MB and output of long runs exceeds it, so only the beginning of text is searched. Value is part
+	// of full-text index expressions created by migrations, indexes should be recreated when it is changed
+	searchTextLength = 250000
+)
+
+// Full-text vectors of project update revisions and changes, should match expressions of full-text indexes
+var (
+	searchRevisionVector = `to_tsvector('simple', coalesce(project_updates.revision, '') || ' ' ||
+                                          coalesce(project_updates.revision_from, '') || ' ' ||
+                                          coalesce(project_updates.revision_to, ''))`
+	searchChangesVector = fmt.Sprintf("to_tsvector('simple', left(coalesce(project_updates.changes, ''), %d))", searchTextLength)
+
+	searchPrefixTerm = regexp.MustCompile(`^[0-9a-z]+$`)
+)
+
+// SearchFilter Search conditions, hits are limited to projects available to UserId when it is set
+type SearchFilter struct {
+	Query     string
+	Kind      string
+	ProjectId string
+	UserId    string
+	Page      Page
+}
+
+// searchSource Text column which is searched, query selects hit fields and should join projects
+type searchSource struct {
+	kind   string
+	source string
+	table  string
+	column string
+	query  string
+}
+
+var searchSources = []searchSource{
+	{
+		kind:   structures.SearchKindRun,
+		source: structures.SearchSourceRunOutput,
+		table:  "run_results",
+		column: "output",
+		query: `select 'run' as kind, 'run_output' as source, run_results.id as source_id,
+                       projects.id as project_id, projects.name as project_name, playbooks.id as playbook_id, playbook_runs.id as target_id,
+                       playbook_runs.start_time as date, coalesce(nullif(playbooks.name, ''), playbooks.filename) as title, '' as detail
+                from run_results
+                  join playbook_runs on (playbook_runs.id = run_results.run_id)
+                  join playbooks on (playbooks.id = playbook_runs.playbook_id)
+                  join projects on (projects.id = playbooks.project_id)
+                where not coalesce(run_results.deleted, false)
+                  and not coalesce(playbook_runs.deleted, false)
+                  and not coalesce(playbooks.deleted, false)`,
+	}, {
+		kind:   structures.SearchKindRun,
+		source: structures.SearchSourceRunError,
+		table:  "run_results",
+		column: "error",
+		query: `select 'run' as kind, 'run_error' as source, run_results.id as source_id,
+                       projects.id as project_id, projects.name as project_name, playbooks.id as playbook_id, playbook_runs.id as target_id,
+                       playbook_runs.start_time as date, coalesce(nullif(playbooks.name, ''), playbooks.filename) as title, '' as detail
+                from run_results
+                  join playbook_runs on (playbook_runs.id = run_results.run_id)
+                  join playbooks on (playbooks.id = playbook_runs.playbook_id)
+                  join projects on (projects.id = playbooks.project_id)
+                where not coalesce(run_results.deleted, false)
+                  and not coalesce(playbook_runs.deleted, false)
+                  and not coalesce(playbooks.deleted, false)`,
+	}, {
+		kind:   structures.SearchKindRun,
+		source: structures.SearchSourceTask,
+		table:  "run_task_results",
+		column: "message",
+		query: `select 'run' as kind, 'task' as source, run_task_results.id as source_id,
+                       projects.id as project_id, projects.name as project_name, playbooks.id as playbook_id, playbook_runs.id as target_id,
+                       playbook_runs.start_time as date, coalesce(nullif(playbooks.name, ''), playbooks.filename) as title,
+                       run_tasks.name || ' on ' || run_task_results.host as detail
+                from run_task_results
+                  join run_tasks on (run_tasks.id = run_task_results.task_id)
+                  join playbook_runs on (playbook_runs.id = run_task_results.run_id)
+                  join playbooks on (playbooks.id = playbook_runs.playbook_id)
+                  join projects on (projects.id = playbooks.project_id)
+                where not coalesce(playbook_runs.deleted, false)
+                  and not coalesce(playbooks.deleted, false)`,
+	}, {
+		kind:   structures.SearchKindUpdate,
+		source: structures.SearchSourceUpdateLog,
+		table:  "project_updates",
+		column: "log",
+		query: `select 'update' as kind, 'update_log' as source, project_updates.id as source_id,
+                       projects.id as project_id, projects.name as project_name, '' as playbook_id, project_updates.id as target_id,
+                       project_updates.date as date, coalesce(project_updates.revision, '') as title, '' as detail
+                from project_updates
+                  join projects on (projects.id = project_updates.project_id)
+                where not coalesce(project_updates.deleted, false)`,
+	}, {
+		kind:   structures.SearchKindUpdate,
+		source: structures.SearchSourceRevision,
+		query: `select 'update' as kind, 'revision' as source, project_updates.id as source_id,
+                       projects.id as project_id, projects.name as project_name, '' as playbook_id, project_updates.id as target_id,
+                       project_updates.date as date, coalesce(project_updates.revision, '') as title,
+                       case when project_updates.revision_from <> ''
+                            then project_updates.revision_from || ' - ' || project_updates.revision_to
+                            else project_updates.revision_to end as detail
+                from project_updates
+                  join projects on (projects.id = project_updates.project_id)
+                where not coalesce(project_updates.deleted, false)`,
+	},
+}
+
+// Search Runs and project updates which output, task messages, logs or revisions match query, latest first.
+// PostgreSQL matches words with full-text indexes, SQLite matches query as substring
+func (s *Storage) Search(filter SearchFilter) ([]*structures.SearchHit, int, error) {
+	countQuery, countArgs, query, args := s.searchQuery(filter)
+	if len(query) == 0 {
+		return nil, 0, nil
+	}
+
+	total := 0
+	if err := s.db.Get(&total, countQuery, countArgs...); err != nil {
+		return nil, 0, err
+	}
+
+	var result []*structures.SearchHit
+	if err := s.db.Select(&result, query, args...); err != nil {
+		return nil, 0, err
+	}
+	return result, total, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// searchQuery Count query of all hits and query of hits page with snippets, empty when nothing is searched
+func (s *Storage) searchQuery(filter SearchFilter) (string, []any, string, []any) {
+	term := SearchTerm(filter.Query)
+	if len(term) == 0 {
+		return "", nil, "", nil
+	}
+
+	var args []any
+	param := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	var scope []string
+	scope = append(scope, "not coalesce(projects.deleted, false)")
+	if len(filter.UserId) != 0 {
+		scope = append(scope, `exists (select 1
+                                       from projects_users_access
+                                       where projects_users_access.project_id = projects.id
+                                         and projects_users_access.user_id = `+param(filter.UserId)+`)`)
+	}
+	if len(filter.ProjectId) != 0 {
+		scope = append(scope, "projects.id = "+param(filter.ProjectId))
+	}
+
+	//parameters are added only when used, PostgreSQL can not infer type of unused parameter
+	shared := map[string]string{}
+	sharedParam := func(name string, value any) string {
+		if placeholder, ok := shared[name]; ok {
+			return placeholder
+		}
+		shared[name] = param(value)
+		return shared[name]
+	}
+
+	var queries []string
+	for _, source := range searchSources {
+		if filter.Kind != SearchKindAll && filter.Kind != source.kind {
+			continue
+		}
+		var match string
+		switch {
+		case source.source == structures.SearchSourceRevision && s.dialect == DialectPostgres:
+			tsQuery := fmt.Sprintf("websearch_to_tsquery('simple', %s)", sharedParam("query", filter.Query))
+			if searchPrefixTerm.MatchString(term) {
+				//abbreviated commit hash matches full one
+				tsQuery += fmt.Sprintf(" || to_tsquery('simple', %s)", sharedParam("prefix", term+":*"))
+			}
+			match = fmt.Sprintf(`(%[1]s @@ (%[3]s)
+                                  or %[2]s @@ (%[3]s))`, searchRevisionVector, searchChangesVector, tsQuery)
+		case source.source == structures.SearchSourceRevision:
+			match = fmt.Sprintf(`(lower(project_updates.revision) like %[1]s escape '\'
+                                  or lower(project_updates.revision_from) like %[1]s escape '\'
+                                  or lower(project_updates.revision_to) like %[1]s escape '\'
+                                  or lower(project_updates.changes) like %[2]s escape '\')`,
+				sharedParam("prefix", likeEscaper.Replace(term)+"%"), sharedParam("contains", likeContains(filter.Query)))
+		case s.dialect == DialectPostgres:
+			match = fmt.Sprintf("%s @@ websearch_to_tsquery('simple', %s)", searchVector(source.table, source.column), sharedParam("query", filter.Query))
+		default:
+			match = fmt.Sprintf(`lower(%s.%s) like %s escape '\'`, source.table, source.column, sharedParam("contains", likeContains(filter.Query)))
+		}
+		queries = append(queries, source.query+`
+                  and `+strings.Join(append(scope, match), `
+                  and `))
+	}
+	if len(queries) == 0 {
+		return "", nil, "", nil
+	}
+	hits := "(" + strings.Join(queries, "\nunion all\n") + ") hits"
+
+	countQuery := `select count(*) from ` + hits
+	countArgs := append([]any(nil), args...)
+
+	//snippets are cut only for hits of the page
+	limit := fmt.Sprintf("limit %s offset %s", param(filter.Page.limit()), param(filter.Page.offset()))
+	query := `select page.*, ` + s.searchSnippet(param(term)) + ` as snippet
+              from (select kind, source, source_id, project_id, project_name, playbook_id, target_id, date, title, detail
+                    from ` + hits + `
+                    order by date desc, source_id
+                    ` + limit + `) page
+              order by page.date desc, page.source_id`
+
+	return countQuery, countArgs, query, args
+}
+
+// searchSnippet Expression of matched text part around the first occurrence of term, text beginning when
+// term is not found as is, empty for revisions
+func (s *Storage) searchSnippet(term string) string {
+	position := "strpos"
+	maximum := "greatest"
+	if s.dialect == DialectSqlite {
+		position = "instr"
+		maximum = "max"
+	}
+
+	var snippet strings.Builder
+	snippet.WriteString("case page.source")
+	for _, source := range searchSources {
+		if len(source.table) == 0 {
+			continue
+		}
+		text := fmt.Sprintf("coalesce(%s.%s, '')", source.table, source.column)
+		snippet.WriteString(fmt.Sprintf(`
+                  when '%[7]s' then (select substr(%[1]s, %[2]s(%[3]s(lower(%[1]s), %[4]s) - %[5]d, 1), %[6]d)
+                                     from %[8]s
+                                     where %[8]s.id = page.source_id)`,
+			text, maximum, position, term, searchSnippetBefore, searchSnippetLength, source.source, source.table))
+	}
+	snippet.WriteString(`
+                  else '' end`)
+	return snippet.String()
+}
+
+// searchVector Full-text vector expression, should match expression of full-text index
+func searchVector(table, column string) string {
+	return fmt.Sprintf("to_tsvector('simple', left(coalesce(%s.%s, ''), %d))", table, column, searchTextLength)
+}
+
+// SearchTerm First word of query without search operators, used for revision prefix and snippets
+func SearchTerm(query string) string {
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		word = strings.Trim(word, `"-`)
+		if len(word) != 0 && word != "or" {
+			return word
+		}
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"ensemble/storage/structures"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSearchQueryPostgres(t *testing.T) {
+	s := &Storage{dialect: DialectPostgres}
+
+	countQuery, countArgs, query, args := s.searchQuery(SearchFilter{
+		Query:  `4F2A9C "connection refused"`,
+		UserId: "user",
+		Page:   Page{Number: 2, Size: 10},
+	})
+
+	for _, expected := range []string{
+		"to_tsvector('simple', left(coalesce(run_results.output, ''), 250000)) @@ websearch_to_tsquery('simple', $2)",
+		"to_tsvector('simple', left(coalesce(run_results.error, ''), 250000)) @@ websearch_to_tsquery('simple', $2)",
+		"to_tsvector('simple', left(coalesce(run_task_results.message, ''), 250000)) @@ websearch_to_tsquery('simple', $2)",
+		"to_tsvector('simple', left(coalesce(project_updates.log, ''), 250000)) @@ websearch_to_tsquery('simple', $2)",
+		searchRevisionVector + " @@ (websearch_to_tsquery('simple', $2) || to_tsquery('simple', $3))",
+		searchChangesVector + " @@ (websearch_to_tsquery('simple', $2) || to_tsquery('simple', $3))",
+		"projects_users_access.user_id = $1",
+	} {
+		if !strings.Contains(countQuery, expected) {
+			t.Errorf("count query does not contain %s:\n%s", expected, countQuery)
+		}
+		if !strings.Contains(query, expected) {
+			t.Errorf("query does not contain %s:\n%s", expected, query)
+		}
+	}
+	if strings.Contains(query, " like ") {
+		t.Errorf("query should not use like:\n%s", query)
+	}
+	if !reflect.DeepEqual(countArgs, []any{"user", `4F2A9C "connection refused"`, "4f2a9c:*"}) {
+		t.Errorf("unexpected count arguments: %v", countArgs)
+	}
+
+	//snippets are selected for page hits only
+	if !strings.Contains(query, "limit $4 offset $5) page") {
+		t.Errorf("query is not limited before snippets:\n%s", query)
+	}
+	for _, source := range []string{structures.SearchSourceRunOutput, structures.SearchSourceRunError, structures.SearchSourceTask, structures.SearchSourceUpdateLog} {
+		if !strings.Contains(query, "when '"+source+"' then (select substr(") {
+			t.Errorf("query does not select %s snippet:\n%s", source, query)
+		}
+	}
+	if !strings.Contains(query, "greatest(strpos(lower(coalesce(run_results.output, '')), $6) - 80, 1)") {
+		t.Errorf("snippet does not look for term:\n%s", query)
+	}
+	if !reflect.DeepEqual(args, append(countArgs, 10, 10, "4f2a9c")) {
+		t.Errorf("unexpected arguments: %v", args)
+	}
+}
+
+func TestSearchQueryPostgresWords(t *testing.T) {
+	s := &Storage{dialect: DialectPostgres}
+
+	//prefix query is built only for plain words, tsquery syntax in term would fail
+	countQuery, countArgs, _, _ := s.searchQuery(SearchFilter{Query: "v1.2:* release", Kind: structures.SearchKindUpdate})
+	if strings.Contains(countQuery, "|| to_tsquery(") || len(countArgs) != 1 {
+		t.Errorf("unexpected prefix query %v:\n%s", countArgs, countQuery)
+	}
+	if strings.Contains(countQuery, "run_results") {
+		t.Errorf("query should search updates only:\n%s", countQuery)
+	}
+
+	if countQuery, _, query, _ := s.searchQuery(SearchFilter{Query: ` "- or `}); len(countQuery) != 0 || len(query) != 0 {
+		t.Errorf("query without words should not be built: %s", query)
+	}
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	settingSecretCheck = "secret_check"
+	secretCheckValue   = "ensemble secret check"
+)
+
+var ErrSecretMismatch = errors.New("ENSEMBLE_DB_SECRET does not match the secret stored values are encrypted with")
+
+// secretColumn Column encrypted with EncryptString
+type secretColumn struct {
+	table  string
+	column string
+}
+
+var secretColumns = []secretColumn{
+	{table: "projects", column: "repo_password"},
+	{table: "projects", column: "vault_password"},
+	{table: "projects", column: "inventory_env"},
+	{table: "keys", column: "password"},
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+// SecretRotate Re-encrypts all stored secrets with new secret in one transaction, returns number of changed values
+func (s *Storage) SecretRotate(newSecret string) (int, error) {
+	if len(newSecret) == 0 {
+		return 0, errors.New("new secret required")
+	}
+	if newSecret == s.config.Secret {
+		return 0, errors.New("new secret is the same as current secret")
+	}
+
+	oldSecret := s.config.Secret
+	count, err := s.reencrypt(func(value string) (string, error) {
+		return RecoverString(oldSecret, value)
+	}, newSecret)
+	if err != nil {
+		return 0, err
+	}
+
+	s.config.Secret = newSecret
+	return count, nil
+}
+
+// secretPrepare Verifies configured secret with stored check value, encrypts plaintext values when secret is configured for the first time
+func (s *Storage) secretPrepare() error {
+	secret := s.config.Secret
+
+	check, found, err := s.settingGet(settingSecretCheck)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !found:
+		//values stored before check value existed, may be plaintext or unversioned ciphertext
+		count, err := s.reencrypt(func(value string) (string, error) {
+			plaintext, err := RecoverString(secret, value)
+			if errors.Is(err, ErrLegacyCiphertext) {
+				//secret is not verified yet, so plaintext hex (API token, vault password) can not be told from
+				//ciphertext of another secret, value is kept as plaintext
+				log.Warnf("stored secret looks like unversioned ciphertext but can not be decrypted with configured secret, it is kept as plaintext")
+				return value, nil
+			}
+			return plaintext, err
+		}, secret)
+		if err != nil {
+			return fmt.Errorf("unable to convert stored secrets: %w", err)
+		}
+		if count != 0 {
+			log.Infof("%d stored secrets converted to current format", count)
+		}
+		return nil
+
+	case !IsCiphertext(check):
+		if len(secret) == 0 {
+			return nil
+		}
+		count, err := s.reencrypt(func(value string) (string, error) {
+			return RecoverString("", value)
+		}, secret)
+		if err != nil {
+			return fmt.Errorf("unable to encrypt stored secrets: %w", err)
+		}
+		log.Infof("secret configured, %d stored secrets encrypted", count)
+		return nil
+
+	default:
+		plaintext, err := DecryptString(secret, check)
+		if err != nil || plaintext != secretCheckValue {
+			return ErrSecretMismatch
+		}
+		return nil
+	}
+}
+
+// reencrypt Converts every secret column value to plaintext with decrypt and encrypts it with new secret in one transaction
+func (s *Storage) reencrypt(decrypt func(value string) (string, error), newSecret string) (int, error) {
+	tx, err := s.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Warnf("rollback error: %s", err)
+		}
+	}()
+
+	count := 0
+	for _, column := range secretColumns {
+		var rows []struct {
+			Id    string         `db:"id"`
+			Value sql.NullString `db:"value"`
+		}
+		query := fmt.Sprintf(`select id, %s as value from %s`, column.column, column.table)
+		if err := tx.Select(&rows, query); err != nil {
+			return 0, err
+		}
+
+		update := fmt.Sprintf(`update %s set %s = $1 where id = $2`, column.table, column.column)
+		for _, row := range rows {
+			if len(row.Value.String) == 0 {
+				continue
+			}
+			plaintext, err := decrypt(row.Value.String)
+			if err != nil {
+				return 0, fmt.Errorf("%s.%s of %s: %w", column.table, column.column, row.Id, err)
+			}
+			encrypted, err := EncryptString(newSecret, plaintext)
+			if err != nil {
+				return 0, err
+			}
+			if encrypted == row.Value.String {
+				continue
+			}
+			if _, err := tx.Exec(update, encrypted, row.Id); err != nil {
+				return 0, err
+			}
+			count++
+		}
+	}
+
+	check, err := EncryptString(newSecret, secretCheckValue)
+	if err != nil {
+		return 0, err
+	}
+	if err := settingSet(tx, settingSecretCheck, check); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
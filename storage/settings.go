@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+)
+
+const (
+	// SettingCredentialsRemoved Marks that credentials were removed from checkouts and update logs of all projects
+	SettingCredentialsRemoved = "credentials_removed"
+)
+
+// SettingGet Stored value of setting, false when setting is not set
+func (s *Storage) SettingGet(name string) (string, bool, error) {
+	return s.settingGet(name)
+}
+
+func (s *Storage) SettingSet(name, value string) error {
+	if len(name) == 0 {
+		return errors.New("setting set empty name")
+	}
+	return settingSet(s.db, name, value)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func (s *Storage) settingGet(name string) (string, bool, error) {
+	query := `select value from settings where name = $1`
+
+	var value string
+	if err := s.db.Get(&value, query, name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func settingSet(db database, name, value string) error {
+	query := `insert into settings (name, value) values ($1, $2)
+              on conflict (name) do update set value = excluded.value`
+	_, err := db.Exec(query, name, value)
+	return err
+}
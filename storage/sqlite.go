@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"errors"
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+	"net/url"
+	"strings"
+)
+
+const sqliteScheme = "sqlite://"
+
+// sqliteDefaultPragmas Concurrent runs and updates write at the same time, so writers wait for lock instead of failing
+var sqliteDefaultPragmas = []string{
+	"busy_timeout(10000)",
+	"journal_mode(WAL)",
+	"synchronous(NORMAL)",
+}
+
+// openSqlite Opens database file from sqlite:///absolute/path.db or sqlite://relative/path.db,
+// query parameters are passed to the driver, default pragmas are used when none are given
+func openSqlite(databaseUrl string) (*sqlx.DB, error) {
+	path, rawQuery, _ := strings.Cut(strings.TrimPrefix(databaseUrl, sqliteScheme), "?")
+	if len(path) == 0 {
+		return nil, errors.New("sqlite database path required")
+	}
+
+	params, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	if !params.Has("_pragma") {
+		for _, pragma := range sqliteDefaultPragmas {
+			params.Add("_pragma", pragma)
+		}
+	}
+	if !params.Has("_txlock") {
+		params.Set("_txlock", "immediate")
+	}
+
+	db, err := sqlx.Open("sqlite", path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
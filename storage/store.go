@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"ensemble/storage/structures"
+)
+
+// Store All entity stores of one database backend
+type Store interface {
+	SessionStore
+	UserStore
+	ProjectStore
+	ProjectUpdateStore
+	ProjectArchiveStore
+	PlaybookStore
+	PlaybookRunStore
+	RunResultStore
+	KeyStore
+	SearchStore
+	AuditStore
+	SettingStore
+
+	Transaction(f func(store Store) error) error
+	Close() error
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+type SessionStore interface {
+	SessionCreate(userId string) (*structures.Session, error)
+	SessionGet(id string) (*structures.Session, error)
+}
+
+type UserStore interface {
+	UserAnyExists() bool
+	UserExists(id string) bool
+	UserExistsByLogin(login string) bool
+	UserGet(id string) (*structures.User, error)
+	UserGetByLogin(login string) (*structures.User, error)
+	UserGetAll() ([]*structures.User, error)
+	UserGetByPlaybookRuns(playbookId string) ([]*structures.User, error)
+	UserInsert(user *structures.User) error
+	UserUpdate(user *structures.User) error
+	UserDelete(id string) error
+	UserEnsureAdminExists() error
+}
+
+type ProjectStore interface {
+	ProjectExists(id string) bool
+	ProjectExistsByName(name string) bool
+	ProjectExistsByKey(keyId string) bool
+	ProjectGet(id string) (*structures.Project, error)
+	ProjectGetAll() ([]*structures.Project, error)
+	ProjectGetByUser(userId string) ([]*structures.Project, error)
+	ProjectInsert(project *structures.Project) error
+	ProjectUpdate(project *structures.Project) error
+	ProjectDelete(id string) error
+	ProjectGetDeletedIds() ([]string, error)
+	ProjectGetDeleted() ([]*structures.Project, error)
+	ProjectHasLockedPlaybooks(id string) bool
+	ProjectUserAccessExists(projectId, userId string) bool
+	ProjectUserAccessCreate(projectId, userId string) error
+	ProjectUserAccessDelete(projectId, userId string) error
+}
+
+type ProjectUpdateStore interface {
+	ProjectUpdateGet(id string) (*structures.ProjectUpdate, error)
+	ProjectUpdateGetByProject(projectId string) ([]*structures.ProjectUpdate, error)
+	ProjectUpdateFind(projectId string, filter ProjectUpdateFilter) ([]*structures.ProjectUpdate, int, error)
+	ProjectUpdateGetProjectLatest(projectId string) (*structures.ProjectUpdate, error)
+	ProjectUpdateInsert(update *structures.ProjectUpdate) error
+	ProjectUpdateSaveLog(id, revision, log string) error
+	ProjectUpdateDelete(id string) error
+}
+
+type ProjectArchiveStore interface {
+	ProjectArchiveGet(id string) (*structures.ProjectArchive, error)
+	ProjectArchiveGetByProject(projectId string) ([]*structures.ProjectArchive, error)
+	ProjectArchiveGetProjectLatest(projectId string) (*structures.ProjectArchive, error)
+	ProjectArchiveInsert(archive *structures.ProjectArchive) error
+}
+
+type PlaybookStore interface {
+	PlaybookGet(id string) (*structures.Playbook, error)
+	PlaybookGetByProject(projectId string) ([]*structures.Playbook, error)
+	PlaybookInsert(playbook *structures.Playbook) error
+	PlaybookUpdate(playbook *structures.Playbook) error
+	PlaybookDelete(id string) error
+	PlaybookSaveSyntax(id string, valid bool, syntaxError string) error
+	PlaybookLock(id string, value bool) error
+}
+
+type PlaybookRunStore interface {
+	PlaybookRunGet(id string) (*structures.PlaybookRun, error)
+	PlaybookRunGetLatest(playbookId string) (*structures.PlaybookRun, error)
+	PlaybookRunGetByPlaybook(playbookId string) ([]*structures.PlaybookRun, error)
+	PlaybookRunFind(playbookId string, filter PlaybookRunFilter) ([]*structures.PlaybookRun, int, error)
+	PlaybookRunInsert(run *structures.PlaybookRun) error
+	PlaybookRunUpdate(run *structures.PlaybookRun) error
+	PlaybookRunDelete(id string) error
+	PlaybookRunGetUnparsed(limit int) ([]*structures.PlaybookRun, error)
+}
+
+type RunResultStore interface {
+	RunResultGet(id string) (*structures.RunResult, error)
+	RunResultSizeByProject() (map[string]int64, error)
+	RunResultInsert(result *structures.RunResult) error
+	RunResultUpdate(result *structures.RunResult) error
+	RunResultDelete(id string) error
+	RunResultGetError(id string) (string, error)
+	RunTasksSave(runId string, execution *structures.AnsibleExecution) error
+	RunPlayGetByRun(runId string) ([]*structures.RunPlay, error)
+	RunTaskGetByRun(runId string) ([]*structures.RunTask, error)
+	RunTaskResultGetByRun(runId string) ([]*structures.RunTaskResult, error)
+	RunTaskResultGet(id string) (*structures.RunTaskResult, error)
+	RunTaskGet(id string) (*structures.RunTask, error)
+}
+
+type KeyStore interface {
+	KeyGetAll() ([]*structures.Key, error)
+	KeyGet(id string) (*structures.Key, error)
+	KeyInsert(key *structures.Key) error
+	KeyUpdate(key *structures.Key) error
+	KeyDelete(id string) error
+}
+
+type SearchStore interface {
+	Search(filter SearchFilter) ([]*structures.SearchHit, int, error)
+}
+
+type AuditStore interface {
+	AuditEventInsert(event *structures.AuditEvent) error
+	AuditEventFind(filter AuditEventFilter) ([]*structures.AuditEvent, int, error)
+}
+
+type SettingStore interface {
+	SettingGet(name string) (string, bool, error)
+	SettingSet(name, value string) error
+}
+
+var _ Store = (*Storage)(nil)
@@ -5,6 +5,15 @@ import (
 	"time"
 )
 
+// ParseAnsibleExecution Parses output of ansible json callback
+func ParseAnsibleExecution(output string) (*AnsibleExecution, error) {
+	var execution AnsibleExecution
+	if err := json.Unmarshal([]byte(output), &execution); err != nil {
+		return nil, err
+	}
+	return &execution, nil
+}
+
 type AnsibleExecution struct {
 	Stats map[string]AnsibleStats `json:"stats"`
 	Plays []AnsiblePlay           `json:"plays"`
@@ -42,6 +51,7 @@ type AnsibleTaskResult struct {
 	Changed     bool                `json:"changed"`
 	Failed      bool                `json:"failed"`
 	Skipped     bool                `json:"skipped"`
+	Unreachable bool                `json:"unreachable"`
 	Destination string              `json:"dest"`
 	Diff        AnsibleResultDiff   `json:"diff"`
 	Facts       AnsibleFacts        `json:"ansible_facts"`
@@ -157,6 +167,20 @@ func (d AnsibleDuration) RunTime() time.Duration {
 	return end.Sub(start)
 }
 
+// Status Task status on host, unreachable takes precedence over failed
+func (r AnsibleTaskResult) Status() int {
+	switch {
+	case r.Unreachable:
+		return RunTaskStatusUnreachable
+	case r.Failed:
+		return RunTaskStatusFailed
+	case r.Skipped:
+		return RunTaskStatusSkipped
+	default:
+		return RunTaskStatusOk
+	}
+}
+
 func (d *AnsibleResultDiff) UnmarshalJSON(data []byte) error {
 	var diff []AnsibleCheckDiff
 	err := json.Unmarshal(data, &diff)
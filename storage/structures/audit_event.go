@@ -0,0 +1,102 @@
+package structures
+
+import (
+	"time"
+)
+
+const (
+	AuditTargetUser          = "user"
+	AuditTargetProject       = "project"
+	AuditTargetProjectUpdate = "project_update"
+	AuditTargetPlaybook      = "playbook"
+	AuditTargetPlaybookRun   = "playbook_run"
+	AuditTargetKey           = "key"
+	AuditTargetStorage       = "storage"
+
+	AuditActionLogin               = "user.login"
+	AuditActionLoginFailed         = "user.login_failed"
+	AuditActionPasswordChange      = "user.password_change"
+	AuditActionUserCreate          = "user.create"
+	AuditActionUserUpdate          = "user.update"
+	AuditActionUserDelete          = "user.delete"
+	AuditActionUserProjects        = "user.projects"
+	AuditActionProjectCreate       = "project.create"
+	AuditActionProjectUpdate       = "project.update"
+	AuditActionProjectDelete       = "project.delete"
+	AuditActionProjectRefresh      = "project.refresh"
+	AuditActionProjectRevision     = "project.revision"
+	AuditActionProjectArchive      = "project.archive_upload"
+	AuditActionProjectDeploy       = "project.archive_deploy"
+	AuditActionProjectUpdateCancel = "project_update.cancel"
+	AuditActionProjectUpdateDelete = "project_update.delete"
+	AuditActionPlaybookRun         = "playbook.run"
+	AuditActionPlaybookLock        = "playbook.lock"
+	AuditActionPlaybookUnlock      = "playbook.unlock"
+	AuditActionPlaybookRunDelete   = "playbook_run.delete"
+	AuditActionPlaybookRunStop     = "playbook_run.terminate"
+	AuditActionKeyCreate           = "key.create"
+	AuditActionKeyDelete           = "key.delete"
+	AuditActionStorageCleanup      = "storage.cleanup"
+	AuditActionStorageGitGc        = "storage.git_gc"
+	AuditActionStorageReclone      = "storage.reclone"
+
+	// AuditMask Replaces values of secret fields in recorded before and after values
+	AuditMask = "***"
+)
+
+// AuditActions All recorded actions in display order
+var AuditActions = []string{
+	AuditActionLogin,
+	AuditActionLoginFailed,
+	AuditActionPasswordChange,
+	AuditActionUserCreate,
+	AuditActionUserUpdate,
+	AuditActionUserDelete,
+	AuditActionUserProjects,
+	AuditActionProjectCreate,
+	AuditActionProjectUpdate,
+	AuditActionProjectDelete,
+	AuditActionProjectRefresh,
+	AuditActionProjectRevision,
+	AuditActionProjectArchive,
+	AuditActionProjectDeploy,
+	AuditActionProjectUpdateCancel,
+	AuditActionProjectUpdateDelete,
+	AuditActionPlaybookRun,
+	AuditActionPlaybookLock,
+	AuditActionPlaybookUnlock,
+	AuditActionPlaybookRunDelete,
+	AuditActionPlaybookRunStop,
+	AuditActionKeyCreate,
+	AuditActionKeyDelete,
+	AuditActionStorageCleanup,
+	AuditActionStorageGitGc,
+	AuditActionStorageReclone,
+}
+
+// AuditTargets All target types in display order
+var AuditTargets = []string{
+	AuditTargetUser,
+	AuditTargetProject,
+	AuditTargetProjectUpdate,
+	AuditTargetPlaybook,
+	AuditTargetPlaybookRun,
+	AuditTargetKey,
+	AuditTargetStorage,
+}
+
+// AuditEvent Recorded change made by user, actor is empty for failed logins.
+// Before and after are JSON objects with changed fields only, secret values are masked
+type AuditEvent struct {
+	Id         string    `db:"id"`
+	Date       time.Time `db:"date"`
+	UserId     string    `db:"user_id"`
+	UserLogin  string    `db:"user_login"`
+	Action     string    `db:"action"`
+	TargetType string    `db:"target_type"`
+	TargetId   string    `db:"target_id"`
+	TargetName string    `db:"target_name"`
+	Before     string    `db:"value_before"`
+	After      string    `db:"value_after"`
+	Ip         string    `db:"ip"`
+}
@@ -1,10 +1,70 @@
 package structures
 
+import (
+	"encoding/json"
+	"strings"
+)
+
+const (
+	PlaybookSurveyString    = "string"
+	PlaybookSurveyInteger   = "integer"
+	PlaybookSurveyChoice    = "choice"
+	PlaybookSurveyBoolean   = "boolean"
+	PlaybookSurveyMultiline = "multiline"
+	PlaybookSurveySecret    = "secret"
+)
+
 type Playbook struct {
-	Id          string `db:"id"`
-	ProjectId   string `db:"project_id"`
-	Filename    string `db:"filename"`
-	Name        string `db:"name"`
-	Description string `db:"description"`
-	Locked      bool   `db:"locked"`
+	Id            string `db:"id"`
+	ProjectId     string `db:"project_id"`
+	Filename      string `db:"filename"`
+	Name          string `db:"name"`
+	Description   string `db:"description"`
+	Category      string `db:"category"`
+	Tags          string `db:"tags"`
+	Dangerous     bool   `db:"dangerous"`
+	Survey        string `db:"survey"`
+	Locked        bool   `db:"locked"`
+	SyntaxValid   bool   `db:"syntax_valid"`
+	SyntaxError   string `db:"syntax_error"`
+	MetadataError string `db:"metadata_error"`
+}
+
+type PlaybookSurveyQuestion struct {
+	Variable    string   `json:"variable" yaml:"variable"`
+	Label       string   `json:"label" yaml:"label"`
+	Description string   `json:"description" yaml:"description"`
+	Type        string   `json:"type" yaml:"type"`
+	Required    bool     `json:"required" yaml:"required"`
+	Default     string   `json:"default" yaml:"default"`
+	Choices     []string `json:"choices" yaml:"choices"`
+	Min         *int     `json:"min" yaml:"min"`
+	Max         *int     `json:"max" yaml:"max"`
+}
+
+func (p *Playbook) TagsList() []string {
+	if len(p.Tags) != 0 {
+		return strings.Split(p.Tags, "|")
+	} else {
+		return []string{}
+	}
+}
+
+// SurveyQuestions Questions asked before playbook run
+func (p *Playbook) SurveyQuestions() []*PlaybookSurveyQuestion {
+	if len(p.Survey) == 0 {
+		return nil
+	}
+	var questions []*PlaybookSurveyQuestion
+	if err := json.Unmarshal([]byte(p.Survey), &questions); err != nil {
+		return nil
+	}
+	return questions
+}
+
+func (q *PlaybookSurveyQuestion) Title() string {
+	if len(q.Label) != 0 {
+		return q.Label
+	}
+	return q.Variable
 }
@@ -1,6 +1,11 @@
 package structures
 
-import "time"
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
 
 const (
 	PlaybookRunModeCheck   = 1
@@ -22,6 +27,17 @@ type PlaybookRun struct {
 	Result        int       `db:"result"`
 	InventoryFile string    `db:"inventory_file"`
 	VariablesFile string    `db:"variables_file"`
+	ExtraVars     string    `db:"extra_vars"`
+	Hosts         string    `db:"hosts"`
+
+	//summary of parsed ansible stats, summed over hosts
+	StatsOk          int  `db:"stats_ok"`
+	StatsChanged     int  `db:"stats_changed"`
+	StatsFailures    int  `db:"stats_failures"`
+	StatsSkipped     int  `db:"stats_skipped"`
+	StatsUnreachable int  `db:"stats_unreachable"`
+	StatsIgnored     int  `db:"stats_ignored"`
+	ResultsParsed    bool `db:"results_parsed"`
 }
 
 func (r *PlaybookRun) RunTime() time.Duration {
@@ -30,3 +46,53 @@ func (r *PlaybookRun) RunTime() time.Duration {
 	}
 	return r.FinishTime.Sub(r.StartTime)
 }
+
+// HasStats Run has parsed task counters
+func (r *PlaybookRun) HasStats() bool {
+	return r.StatsOk+r.StatsChanged+r.StatsFailures+r.StatsSkipped+r.StatsUnreachable+r.StatsIgnored != 0
+}
+
+func (r *PlaybookRun) InventoryFileList() []string {
+	if len(r.InventoryFile) != 0 {
+		return strings.Split(r.InventoryFile, "|")
+	} else {
+		return []string{}
+	}
+}
+
+func (r *PlaybookRun) VariablesFileList() []string {
+	if len(r.VariablesFile) != 0 {
+		return strings.Split(r.VariablesFile, "|")
+	} else {
+		return []string{}
+	}
+}
+
+// HostsList Hosts resolved from run inventory
+func (r *PlaybookRun) HostsList() []string {
+	if len(r.Hosts) != 0 {
+		return strings.Split(r.Hosts, "|")
+	} else {
+		return []string{}
+	}
+}
+
+// ExtraVarsList Survey answers of run sorted by variable, secrets are redacted
+func (r *PlaybookRun) ExtraVarsList() [][]string {
+	if len(r.ExtraVars) == 0 {
+		return nil
+	}
+	var extraVars map[string]interface{}
+	if err := json.Unmarshal([]byte(r.ExtraVars), &extraVars); err != nil {
+		return nil
+	}
+	var list [][]string
+	for variable, value := range extraVars {
+		encoded, _ := json.Marshal(value)
+		list = append(list, []string{variable, string(encoded)})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i][0] < list[j][0]
+	})
+	return list
+}
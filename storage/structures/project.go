@@ -1,44 +1,126 @@
 package structures
 
 import (
-	"net/url"
+	"fmt"
 	"strings"
 )
 
 const (
-	ProjectDefaultBranchName    = "master"
-	ProjectDefaultInventoryName = "main.yml"
+	ProjectDefaultBranchName = "master"
+
+	ProjectUpdateScheduleNever = "never"
+
+	ProjectRevisionBranch     = 1
+	ProjectRevisionTag        = 2
+	ProjectRevisionCommit     = 3
+	ProjectRevisionTagPattern = 4
+
+	ProjectSourceGit     = 1
+	ProjectSourceArchive = 2
+	ProjectSourceLocal   = 3
+
+	ProjectUpdatePolicySkip  = 1
+	ProjectUpdatePolicyWait  = 2
+	ProjectUpdatePolicyRetry = 3
 )
 
 type Project struct {
-	Id                 string `db:"id"`
-	Name               string `db:"name"`
-	Description        string `db:"description"`
-	RepositoryUrl      string `db:"repo_url"`
-	RepositoryLogin    string `db:"repo_login"`
-	RepositoryPassword string `db:"repo_password"`
-	RepositoryBranch   string `db:"repo_branch"`
-	Inventory          string `db:"inventory"`
-	Inventories        string `db:"inventory_list"`
-	Collections        string `db:"collections_list"`
-	Variables          string `db:"variables"`
-	VariablesAvailable string `db:"variables_list"`
-	VariablesMain      bool   `db:"variables_main"`
-	VariablesVault     bool   `db:"variables_vault"`
-	VaultPassword      string `db:"vault_password"`
-}
-
-func (p *Project) RepositoryUrlFull() string {
-	u, err := url.Parse(p.RepositoryUrl)
-	if err != nil {
+	Id                   string `db:"id"`
+	Name                 string `db:"name"`
+	Description          string `db:"description"`
+	SourceType           int    `db:"source_type"`
+	SourcePath           string `db:"source_path"`
+	RepositoryUrl        string `db:"repo_url"`
+	RepositoryLogin      string `db:"repo_login"`
+	RepositoryPassword   string `db:"repo_password"`
+	RepositoryBranch     string `db:"repo_branch"`
+	RevisionType         int    `db:"repo_revision_type"`
+	Revision             string `db:"repo_revision"`
+	RepositoryKeyId      string `db:"repo_key_id"`
+	RepositoryHostKeys   string `db:"repo_host_keys"`
+	RepositorySubmodules bool   `db:"repo_submodules"`
+	RepositoryLfs        bool   `db:"repo_lfs"`
+	Inventory            string `db:"inventory"`
+	Inventories          string `db:"inventory_list"`
+	InventoryDefault     string `db:"inventory_default"`
+	InventoryScripts     string `db:"inventory_script_list"`
+	InventoryPlugins     string `db:"inventory_plugin_list"`
+	InventoryEnv         string `db:"inventory_env"`
+	InventoryProtected   string `db:"inventory_protected_list"`
+	Collections          string `db:"collections_list"`
+	Variables            string `db:"variables"`
+	VariablesAvailable   string `db:"variables_list"`
+	VariablesMain        bool   `db:"variables_main"`
+	VariablesVault       bool   `db:"variables_vault"`
+	VariablesMainFile    string `db:"variables_main_file"`
+	VariablesVaultFile   string `db:"variables_vault_file"`
+	VaultPassword        string `db:"vault_password"`
+	UpdateSchedule       string `db:"update_schedule"`
+	UpdatePolicy         int    `db:"update_policy"`
+}
+
+// IsGit Project content is cloned from git repository
+func (p *Project) IsGit() bool {
+	return p.SourceType != ProjectSourceArchive && p.SourceType != ProjectSourceLocal
+}
+
+// SourceTitle Human-readable description of project content source
+func (p *Project) SourceTitle() string {
+	switch p.SourceType {
+	case ProjectSourceArchive:
+		return "uploaded archive"
+	case ProjectSourceLocal:
+		return p.SourcePath
+	default:
 		return p.RepositoryUrl
 	}
+}
 
-	if len(p.RepositoryLogin) != 0 {
-		u.User = url.UserPassword(p.RepositoryLogin, p.RepositoryPassword)
+// RevisionTitle Human-readable description of deployed revision
+func (p *Project) RevisionTitle() string {
+	switch p.SourceType {
+	case ProjectSourceArchive:
+		if len(p.Revision) != 0 {
+			return "pinned archive"
+		}
+		return "latest archive"
+	case ProjectSourceLocal:
+		return "directory"
+	}
+	switch p.RevisionType {
+	case ProjectRevisionTag:
+		return fmt.Sprintf("tag %s", p.Revision)
+	case ProjectRevisionCommit:
+		return fmt.Sprintf("commit %s", p.Revision)
+	case ProjectRevisionTagPattern:
+		return fmt.Sprintf("latest tag %s", p.Revision)
+	default:
+		return fmt.Sprintf("branch %s", p.RepositoryBranch)
 	}
+}
 
-	return u.String()
+// UpdatePolicyTitle Human-readable description of update behaviour while playbooks are locked
+func (p *Project) UpdatePolicyTitle() string {
+	switch p.UpdatePolicy {
+	case ProjectUpdatePolicyWait:
+		return "wait for runs"
+	case ProjectUpdatePolicyRetry:
+		return "retry later"
+	default:
+		return "skip"
+	}
+}
+
+func (p *Project) UpdateScheduleNever() bool {
+	return p.UpdateSchedule == ProjectUpdateScheduleNever
+}
+
+// ProjectOption Selectable inventory or variables file
+type ProjectOption struct {
+	Value    string
+	Title    string
+	Selected bool
+	Warning  bool
 }
 
 func (p *Project) InventoryList() []string {
@@ -49,6 +131,63 @@ func (p *Project) InventoryList() []string {
 	}
 }
 
+// InventoryTitle Inventory name with its kind
+func (p *Project) InventoryTitle(inventory string) string {
+	if strings.HasSuffix(inventory, "/") {
+		return fmt.Sprintf("%s (directory)", strings.TrimSuffix(inventory, "/"))
+	}
+	if listContains(p.InventoryScriptList(), inventory) {
+		return fmt.Sprintf("%s (script)", inventory)
+	}
+	if listContains(p.InventoryPluginList(), inventory) {
+		return fmt.Sprintf("%s (plugin)", inventory)
+	}
+	return inventory
+}
+
+// InventoryDynamic Inventory is a script or an inventory plugin configuration
+func (p *Project) InventoryDynamic(inventory string) bool {
+	return listContains(p.InventoryScriptList(), inventory) || listContains(p.InventoryPluginList(), inventory)
+}
+
+func (p *Project) InventoryScriptList() []string {
+	if len(p.InventoryScripts) != 0 {
+		return strings.Split(p.InventoryScripts, "|")
+	} else {
+		return []string{}
+	}
+}
+
+func (p *Project) InventoryPluginList() []string {
+	if len(p.InventoryPlugins) != 0 {
+		return strings.Split(p.InventoryPlugins, "|")
+	} else {
+		return []string{}
+	}
+}
+
+// InventoryEnvList Environment variables (NAME=value) passed to dynamic inventories and playbook runs
+func (p *Project) InventoryEnvList() []string {
+	var env []string
+	for _, line := range strings.Split(p.InventoryEnv, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		env = append(env, line)
+	}
+	return env
+}
+
+// InventoryEnvNames Names of inventory environment variables, values are secret
+func (p *Project) InventoryEnvNames() []string {
+	var names []string
+	for _, variable := range p.InventoryEnvList() {
+		names = append(names, strings.SplitN(variable, "=", 2)[0])
+	}
+	return names
+}
+
 func (p *Project) CollectionsList() []string {
 	if len(p.Collections) != 0 {
 		return strings.Split(p.Collections, "|")
@@ -64,3 +203,95 @@ func (p *Project) VariablesList() []string {
 		return []string{}
 	}
 }
+
+// InventorySelectedList Inventories used in playbook runs, in order of --inventory options
+func (p *Project) InventorySelectedList() []string {
+	if len(p.Inventory) != 0 {
+		return strings.Split(p.Inventory, "|")
+	} else {
+		return []string{}
+	}
+}
+
+// VariablesSelectedList Additional variable files used in playbook runs, later files override earlier ones
+func (p *Project) VariablesSelectedList() []string {
+	if len(p.Variables) != 0 {
+		return strings.Split(p.Variables, "|")
+	} else {
+		return []string{}
+	}
+}
+
+func (p *Project) InventorySelected(inventory string) bool {
+	return listContains(p.InventorySelectedList(), inventory)
+}
+
+func (p *Project) VariablesSelected(variables string) bool {
+	return listContains(p.VariablesSelectedList(), variables)
+}
+
+// InventoryProtectedList Inventories which require typed confirmation before playbook run
+func (p *Project) InventoryProtectedList() []string {
+	if len(p.InventoryProtected) != 0 {
+		return strings.Split(p.InventoryProtected, "|")
+	} else {
+		return []string{}
+	}
+}
+
+func (p *Project) InventoryIsProtected(inventory string) bool {
+	return listContains(p.InventoryProtectedList(), inventory)
+}
+
+// InventoryOptions Selected inventories in their order followed by other available inventories
+func (p *Project) InventoryOptions() []*ProjectOption {
+	var options []*ProjectOption
+	for _, inventory := range selectedFirst(p.InventorySelectedList(), p.InventoryList()) {
+		options = append(options, &ProjectOption{
+			Value:    inventory,
+			Title:    p.InventoryTitle(inventory),
+			Selected: p.InventorySelected(inventory),
+			Warning:  p.InventoryIsProtected(inventory),
+		})
+	}
+	return options
+}
+
+// VariablesOptions Selected variable files in their order followed by other available variable files
+func (p *Project) VariablesOptions() []*ProjectOption {
+	var options []*ProjectOption
+	for _, variables := range selectedFirst(p.VariablesSelectedList(), p.VariablesList()) {
+		options = append(options, &ProjectOption{
+			Value:    variables,
+			Title:    variables,
+			Selected: p.VariablesSelected(variables),
+		})
+	}
+	return options
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func listContains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func selectedFirst(selected, available []string) []string {
+	var options []string
+	for _, v := range selected {
+		if listContains(available, v) {
+			options = append(options, v)
+		}
+	}
+	for _, v := range available {
+		if !listContains(selected, v) {
+			options = append(options, v)
+		}
+	}
+	return options
+}
@@ -0,0 +1,23 @@
+package structures
+
+import (
+	"time"
+)
+
+// ProjectArchive Uploaded archive version of archive project
+type ProjectArchive struct {
+	Id        string    `db:"id"`
+	ProjectId string    `db:"project_id"`
+	UserId    string    `db:"user_id"`
+	Date      time.Time `db:"date"`
+	Filename  string    `db:"filename"`
+	Checksum  string    `db:"checksum"`
+	Size      int64     `db:"size"`
+}
+
+func (a *ProjectArchive) ChecksumShort() string {
+	if len(a.Checksum) > 12 {
+		return a.Checksum[:12]
+	}
+	return a.Checksum
+}
@@ -1,16 +1,79 @@
 package structures
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 const (
 	ProjectUpdateRevisionMaxLength = 200
 )
 
 type ProjectUpdate struct {
-	Id        string    `db:"id"`
-	ProjectId string    `db:"project_id"`
-	Date      time.Time `db:"date"`
-	Success   bool      `db:"success"`
-	Revision  string    `db:"revision"`
-	Log       string    `db:"log"`
+	Id           string    `db:"id"`
+	ProjectId    string    `db:"project_id"`
+	Date         time.Time `db:"date"`
+	Success      bool      `db:"success"`
+	Deferred     bool      `db:"deferred"`
+	Revision     string    `db:"revision"`
+	RevisionFrom string    `db:"revision_from"`
+	RevisionTo   string    `db:"revision_to"`
+	Changes      string    `db:"changes"`
+	Log          string    `db:"log"`
+}
+
+// ProjectUpdateChanges Changes pulled in by project update
+type ProjectUpdateChanges struct {
+	Commits            []ProjectUpdateCommit    `json:"commits"`
+	CommitsRemoved     []ProjectUpdateCommit    `json:"commits_removed"`
+	Files              []ProjectUpdateFile      `json:"files"`
+	PlaybooksAdded     []string                 `json:"playbooks_added"`
+	PlaybooksRemoved   []string                 `json:"playbooks_removed"`
+	InventoriesAdded   []string                 `json:"inventories_added"`
+	InventoriesRemoved []string                 `json:"inventories_removed"`
+	VariablesAdded     []string                 `json:"variables_added"`
+	VariablesRemoved   []string                 `json:"variables_removed"`
+	Submodules         []ProjectUpdateSubmodule `json:"submodules"`
+}
+
+type ProjectUpdateCommit struct {
+	Hash    string `json:"hash"`
+	Author  string `json:"author"`
+	Subject string `json:"subject"`
+}
+
+// ProjectUpdateSubmodule Checked out commit of git submodule
+type ProjectUpdateSubmodule struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+}
+
+type ProjectUpdateFile struct {
+	Status string `json:"status"`
+	Path   string `json:"path"`
+}
+
+func (u *ProjectUpdate) RevisionChanged() bool {
+	return len(u.RevisionFrom) != 0 && len(u.RevisionTo) != 0 && u.RevisionFrom != u.RevisionTo
+}
+
+func (u *ProjectUpdate) ChangesInfo() *ProjectUpdateChanges {
+	if len(u.Changes) == 0 {
+		return nil
+	}
+	var changes ProjectUpdateChanges
+	if err := json.Unmarshal([]byte(u.Changes), &changes); err != nil {
+		return nil
+	}
+	return &changes
+}
+
+func (c *ProjectUpdateChanges) Empty() bool {
+	return len(c.Commits) == 0 && len(c.CommitsRemoved) == 0 && len(c.Files) == 0 && !c.DiscoveryChanged()
+}
+
+func (c *ProjectUpdateChanges) DiscoveryChanged() bool {
+	return len(c.PlaybooksAdded) != 0 || len(c.PlaybooksRemoved) != 0 ||
+		len(c.InventoriesAdded) != 0 || len(c.InventoriesRemoved) != 0 ||
+		len(c.VariablesAdded) != 0 || len(c.VariablesRemoved) != 0
 }
@@ -0,0 +1,72 @@
+package structures
+
+import (
+	"time"
+)
+
+const (
+	RunTaskStatusOk          = 1
+	RunTaskStatusFailed      = 2
+	RunTaskStatusSkipped     = 3
+	RunTaskStatusUnreachable = 4
+)
+
+// RunPlay Play of finished run parsed from ansible output
+type RunPlay struct {
+	Id         string    `db:"id"`
+	RunId      string    `db:"run_id"`
+	Position   int       `db:"position"`
+	Name       string    `db:"name"`
+	StartTime  time.Time `db:"start_time"`
+	FinishTime time.Time `db:"finish_time"`
+}
+
+// RunTask Task of run play
+type RunTask struct {
+	Id         string    `db:"id"`
+	RunId      string    `db:"run_id"`
+	PlayId     string    `db:"play_id"`
+	Position   int       `db:"position"`
+	Name       string    `db:"name"`
+	StartTime  time.Time `db:"start_time"`
+	FinishTime time.Time `db:"finish_time"`
+}
+
+// RunTaskResult Result of task on one host
+type RunTaskResult struct {
+	Id         string `db:"id"`
+	RunId      string `db:"run_id"`
+	TaskId     string `db:"task_id"`
+	Host       string `db:"host"`
+	Action     string `db:"action"`
+	Status     int    `db:"status"`
+	Changed    bool   `db:"changed"`
+	ReturnCode int    `db:"return_code"`
+	Message    string `db:"message"`
+}
+
+func (p *RunPlay) RunTime() time.Duration {
+	if p.StartTime.IsZero() || p.FinishTime.IsZero() {
+		return 0
+	}
+	return p.FinishTime.Sub(p.StartTime)
+}
+
+func (t *RunTask) RunTime() time.Duration {
+	if t.StartTime.IsZero() || t.FinishTime.IsZero() {
+		return 0
+	}
+	return t.FinishTime.Sub(t.StartTime)
+}
+
+func (r *RunTaskResult) Failed() bool {
+	return r.Status == RunTaskStatusFailed
+}
+
+func (r *RunTaskResult) Skipped() bool {
+	return r.Status == RunTaskStatusSkipped
+}
+
+func (r *RunTaskResult) Unreachable() bool {
+	return r.Status == RunTaskStatusUnreachable
+}
@@ -0,0 +1,49 @@
+package structures
+
+import (
+	"time"
+)
+
+const (
+	SearchKindRun    = "run"
+	SearchKindUpdate = "update"
+
+	SearchSourceRunOutput = "run_output"
+	SearchSourceRunError  = "run_error"
+	SearchSourceTask      = "task"
+	SearchSourceUpdateLog = "update_log"
+	SearchSourceRevision  = "revision"
+)
+
+// SearchHit Playbook run or project update which text matches search query
+type SearchHit struct {
+	Kind        string    `db:"kind"`
+	Source      string    `db:"source"`
+	SourceId    string    `db:"source_id"`
+	ProjectId   string    `db:"project_id"`
+	ProjectName string    `db:"project_name"`
+	PlaybookId  string    `db:"playbook_id"`
+	TargetId    string    `db:"target_id"`
+	Date        time.Time `db:"date"`
+	Title       string    `db:"title"`
+	Detail      string    `db:"detail"`
+	Snippet     string    `db:"snippet"`
+}
+
+// SourceTitle Human-readable name of matched text
+func (h *SearchHit) SourceTitle() string {
+	switch h.Source {
+	case SearchSourceRunOutput:
+		return "output"
+	case SearchSourceRunError:
+		return "error output"
+	case SearchSourceTask:
+		return "task message"
+	case SearchSourceUpdateLog:
+		return "update log"
+	case SearchSourceRevision:
+		return "revision"
+	default:
+		return h.Source
+	}
+}
@@ -39,3 +39,11 @@ func (u *User) CanControlUsers() bool {
 func (u *User) CanControlKeys() bool {
 	return u.Role == UserRoleAdmin
 }
+
+func (u *User) CanControlStorage() bool {
+	return u.Role == UserRoleAdmin
+}
+
+func (u *User) CanViewAudit() bool {
+	return u.Role == UserRoleAdmin
+}
@@ -15,7 +15,15 @@ import (
 	"strings"
 )
 
-const PasswordEncryptionCost = 15
+const (
+	PasswordEncryptionCost = 15
+
+	// CiphertextPrefixV1 AES-256-GCM with SHA-256 of secret as key, hex encoded nonce and sealed text
+	CiphertextPrefixV1 = "enc:v1:"
+
+	gcmNonceSize = 12
+	gcmTagSize   = 16
+)
 
 ///////////////////////////////////////////////////////////////////////////////
 
@@ -58,19 +66,13 @@ func CheckPassword(password, hash string) bool {
 
 ///////////////////////////////////////////////////////////////////////////////
 
+// EncryptString Encrypts text with AES-GCM to versioned ciphertext, text is returned as is when key is empty
 func EncryptString(key, text string) (string, error) {
 	if len(key) == 0 {
 		return text, nil
 	}
 
-	plaintext := []byte(text)
-
-	block, err := aes.NewCipher(Sha256(key))
-	if err != nil {
-		return "", err
-	}
-
-	aesGCM, err := cipher.NewGCM(block)
+	aesGCM, err := newCipher(key)
 	if err != nil {
 		return "", err
 	}
@@ -80,24 +82,69 @@ func EncryptString(key, text string) (string, error) {
 		return "", err
 	}
 
-	ciphertext := aesGCM.Seal(nonce, nonce, plaintext, nil)
+	ciphertext := aesGCM.Seal(nonce, nonce, []byte(text), nil)
 
-	return fmt.Sprintf("%x", ciphertext), nil
+	return CiphertextPrefixV1 + hex.EncodeToString(ciphertext), nil
 }
 
+// DecryptString Decrypts versioned or legacy unversioned ciphertext, text is returned as is when key is empty
 func DecryptString(key, text string) (string, error) {
+	if len(text) == 0 {
+		return text, nil
+	}
+	if IsCiphertext(text) {
+		if len(key) == 0 {
+			return "", errors.New("encrypted text requires secret")
+		}
+		return decryptHex(key, strings.TrimPrefix(text, CiphertextPrefixV1))
+	}
+
 	if len(key) == 0 {
 		return text, nil
 	}
+	return decryptHex(key, text)
+}
+
+// IsCiphertext Text is versioned ciphertext produced by EncryptString
+func IsCiphertext(text string) bool {
+	return strings.HasPrefix(text, CiphertextPrefixV1)
+}
+
+// ErrLegacyCiphertext Unversioned hex value can not be decrypted, it is either ciphertext of another secret or plaintext hex
+var ErrLegacyCiphertext = errors.New("unable to decrypt legacy ciphertext")
 
-	enc, _ := hex.DecodeString(text)
+// RecoverString Decrypts ciphertext, values which were stored before secret was configured are returned as plaintext.
+// Unversioned hex which can not be decrypted is ErrLegacyCiphertext, it is most likely encrypted with another secret
+func RecoverString(key, text string) (string, error) {
+	if IsCiphertext(text) || len(key) == 0 {
+		return DecryptString(key, text)
+	}
+
+	plaintext, err := decryptHex(key, text)
+	if err == nil {
+		return plaintext, nil
+	}
+	if _, hexErr := hex.DecodeString(text); hexErr == nil && len(text) >= 2*(gcmNonceSize+gcmTagSize) {
+		return "", fmt.Errorf("%w: %w", ErrLegacyCiphertext, err)
+	}
+	return text, nil
+}
 
+func newCipher(key string) (cipher.AEAD, error) {
 	block, err := aes.NewCipher(Sha256(key))
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func decryptHex(key, text string) (string, error) {
+	enc, err := hex.DecodeString(text)
+	if err != nil {
+		return "", fmt.Errorf("encrypted text is not hex: %w", err)
 	}
 
-	aesGCM, err := cipher.NewGCM(block)
+	aesGCM, err := newCipher(key)
 	if err != nil {
 		return "", err
 	}
@@ -114,7 +161,7 @@ func DecryptString(key, text string) (string, error) {
 		return "", err
 	}
 
-	return fmt.Sprintf("%s", plaintext), nil
+	return string(plaintext), nil
 }
 
 func Sha256(text string) []byte {
@@ -3,6 +3,7 @@ package storage
 import (
 	"encoding/hex"
 	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -100,3 +101,34 @@ func TestDecryptString(t *testing.T) {
 		t.Fatalf("decrypt with empty key should return input string '%s', returned: %s", testString, emptyKeyResult)
 	}
 }
+
+func TestRecoverString(t *testing.T) {
+	testString := "helloworld"
+	testKey := "testing"
+
+	encrypted, err := EncryptString(testKey, testString)
+	if err != nil {
+		t.Fatalf("encrypt error: %s", err)
+	}
+	if !IsCiphertext(encrypted) {
+		t.Fatalf("encrypted text is not versioned: %s", encrypted)
+	}
+	legacy := strings.TrimPrefix(encrypted, CiphertextPrefixV1)
+
+	for _, text := range []string{encrypted, legacy, testString} {
+		recovered, err := RecoverString(testKey, text)
+		if err != nil {
+			t.Fatalf("recover %s error: %s", text, err)
+		}
+		if recovered != testString {
+			t.Fatalf("recover %s expected '%s', returned: %s", text, testString, recovered)
+		}
+	}
+
+	if _, err := RecoverString("another", legacy); err == nil {
+		t.Fatal("legacy ciphertext with wrong key recovered as plaintext")
+	}
+	if _, err := DecryptString("", encrypted); err == nil {
+		t.Fatal("ciphertext decrypted without key")
+	}
+}
@@ -0,0 +1,147 @@
+package web
+
+import (
+	"ensemble/storage"
+	"ensemble/storage/structures"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+const (
+	auditFailedLoginsMax    = 10
+	auditFailedLoginsWindow = 10 * time.Minute
+	auditFailedLoginsIps    = 10000
+	auditLoginLengthMax     = 100
+)
+
+//auditLimiter Limits failed login events per IP address, anonymous requests can not fill append-only log.
+//Events over the limit are counted and the count is recorded with the first event of the next window
+type auditLimiter struct {
+	mutex   sync.Mutex
+	windows map[string]*auditWindow
+}
+
+type auditWindow struct {
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+//auditSuppressed After value of failed login recorded after suppressed ones
+type auditSuppressed struct {
+	Suppressed int
+}
+
+//audit Records action of current user with before and after values of target, nil value means target
+//did not exist before or after action. Failure to record is logged and does not fail the action
+func (s *Server) audit(c echo.Context, action, targetType, targetId, targetName string, before, after any) {
+	context := c.(*EnsembleContext)
+
+	event := &structures.AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   targetId,
+		TargetName: targetName,
+	}
+	if context.user != nil {
+		event.UserId = context.user.Id
+		event.UserLogin = context.user.Login
+	}
+	s.auditSave(c, event, before, after)
+}
+
+//auditLogin Records login attempt, user is nil when login is not found
+func (s *Server) auditLogin(c echo.Context, action, login string, user *structures.User) {
+	var after any
+	if action == structures.AuditActionLoginFailed {
+		allowed, suppressed := s.failedLogins.allow(c.RealIP(), time.Now())
+		if !allowed {
+			return
+		}
+		if suppressed != 0 {
+			after = &auditSuppressed{Suppressed: suppressed}
+		}
+	}
+	if runes := []rune(login); len(runes) > auditLoginLengthMax {
+		login = string(runes[:auditLoginLengthMax]) + "..."
+	}
+
+	event := &structures.AuditEvent{
+		Action:     action,
+		TargetType: structures.AuditTargetUser,
+		TargetName: login,
+	}
+	if user != nil {
+		event.TargetId = user.Id
+		if action == structures.AuditActionLogin {
+			event.UserId = user.Id
+			event.UserLogin = user.Login
+		}
+	}
+	s.auditSave(c, event, nil, after)
+}
+
+func (s *Server) auditSave(c echo.Context, event *structures.AuditEvent, before, after any) {
+	var err error
+	event.Before, event.After, err = storage.AuditValues(before, after)
+	if err != nil {
+		log.Errorf("audit %s %s values encoding error: %s", event.Action, event.TargetId, err)
+	}
+	event.Ip = c.RealIP()
+
+	if err := s.store.AuditEventInsert(event); err != nil {
+		log.Errorf("audit %s %s insert error: %s", event.Action, event.TargetId, err)
+	}
+}
+
+func newAuditLimiter() *auditLimiter {
+	return &auditLimiter{windows: make(map[string]*auditWindow)}
+}
+
+//allow Checks whether event from the IP address is recorded, returns count of events suppressed in previous window
+func (l *auditLimiter) allow(ip string, now time.Time) (bool, int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	window, ok := l.windows[ip]
+	if ok && now.Sub(window.start) < auditFailedLoginsWindow {
+		if window.count < auditFailedLoginsMax {
+			window.count++
+			return true, 0
+		}
+		if window.suppressed == 0 {
+			log.Warnf("too many failed logins from %s, audit events are suppressed", ip)
+		}
+		window.suppressed++
+		return false, 0
+	}
+
+	suppressed := 0
+	if ok {
+		suppressed = window.suppressed
+	} else if len(l.windows) >= auditFailedLoginsIps {
+		l.prune(now)
+	}
+	l.windows[ip] = &auditWindow{start: now, count: 1}
+	return true, suppressed
+}
+
+//prune Removes expired windows, their suppressed counts are only logged
+func (l *auditLimiter) prune(now time.Time) {
+	for ip, window := range l.windows {
+		if now.Sub(window.start) < auditFailedLoginsWindow {
+			continue
+		}
+		if window.suppressed != 0 {
+			log.Warnf("%d failed logins from %s were not recorded in audit log", window.suppressed, ip)
+		}
+		delete(l.windows, ip)
+	}
+}
+
+//playbookAuditName Playbook target name with project, playbooks of different projects often share file names
+func playbookAuditName(project *structures.Project, playbook *structures.Playbook) string {
+	return project.Name + " / " + playbook.Filename
+}
@@ -0,0 +1,92 @@
+package web
+
+import (
+	"ensemble/storage/structures"
+	"github.com/labstack/echo/v4"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAuditLimiter(t *testing.T) {
+	limiter := newAuditLimiter()
+	now := time.Now()
+
+	for i := 0; i < auditFailedLoginsMax; i++ {
+		if allowed, _ := limiter.allow("203.0.113.7", now); !allowed {
+			t.Fatalf("event %d should be recorded", i+1)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if allowed, _ := limiter.allow("203.0.113.7", now); allowed {
+			t.Fatal("events over limit should be suppressed")
+		}
+	}
+	if allowed, _ := limiter.allow("198.51.100.1", now); !allowed {
+		t.Error("other addresses should not be limited")
+	}
+
+	allowed, suppressed := limiter.allow("203.0.113.7", now.Add(auditFailedLoginsWindow))
+	if !allowed || suppressed != 3 {
+		t.Errorf("next window should record event with suppressed count, got %v %d", allowed, suppressed)
+	}
+}
+
+func TestAuditLimiterPrune(t *testing.T) {
+	limiter := newAuditLimiter()
+	now := time.Now()
+
+	limiter.allow("203.0.113.7", now)
+	limiter.allow("198.51.100.1", now.Add(auditFailedLoginsWindow))
+	limiter.prune(now.Add(auditFailedLoginsWindow))
+
+	if _, ok := limiter.windows["203.0.113.7"]; ok {
+		t.Error("expired window should be removed")
+	}
+	if _, ok := limiter.windows["198.51.100.1"]; !ok {
+		t.Error("current window should be kept")
+	}
+}
+
+func TestCsvSafeRecord(t *testing.T) {
+	record := csvSafeRecord([]string{"=HYPERLINK(\"http://x\")", "+1", "-cmd", "@SUM(A1)", "\tname", "\rname", "web", "", "a=b"})
+	expected := []string{"'=HYPERLINK(\"http://x\")", "'+1", "'-cmd", "'@SUM(A1)", "'\tname", "'\rname", "web", "", "a=b"}
+	if !reflect.DeepEqual(record, expected) {
+		t.Errorf("unexpected record: %q", record)
+	}
+}
+
+func TestAuditAccessRequiredMiddleware(t *testing.T) {
+	s := &Server{}
+	called := false
+	handler := s.auditAccessRequiredMiddleware(func(c echo.Context) error {
+		called = true
+		return nil
+	})
+
+	users := []*structures.User{
+		nil,
+		{Login: "operator", Role: structures.UserRoleOperator},
+	}
+	for _, user := range users {
+		context := &EnsembleContext{
+			Context: echo.New().NewContext(httptest.NewRequest("GET", "/audit", nil), httptest.NewRecorder()),
+			user:    user,
+		}
+		if err := handler(context); err == nil {
+			t.Errorf("audit access should be denied for %+v", user)
+		}
+	}
+	if called {
+		t.Fatal("handler called without audit access")
+	}
+
+	context := &EnsembleContext{
+		Context: echo.New().NewContext(httptest.NewRequest("GET", "/audit", nil), httptest.NewRecorder()),
+		user:    &structures.User{Login: "admin", Role: structures.UserRoleAdmin},
+	}
+	if err := handler(context); err != nil || !called {
+		t.Fatalf("admin should have audit access: %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package web
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"ensemble/storage"
+	"ensemble/storage/structures"
+	"fmt"
+	"github.com/flosch/pongo2/v4"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const auditDateFormat = "2006-01-02 15:04:05"
+
+//auditEventRow Audit event with changed fields for display
+type auditEventRow struct {
+	*structures.AuditEvent
+	Changes []*auditChange
+}
+
+type auditChange struct {
+	Field  string
+	Before string
+	After  string
+}
+
+//auditEvents Audit log page with filters by user, action, target and date
+func (s *Server) auditEvents(c echo.Context) error {
+	context := c.(*EnsembleContext)
+
+	users, err := s.store.UserGetAll()
+	if err != nil {
+		log.Errorf("auditEvents users get error: %s", err)
+		return err
+	}
+
+	list := newListQuery(c)
+	filter := auditFilter(list)
+	filter.Page = list.Page()
+
+	events, total, err := s.store.AuditEventFind(filter)
+	if err != nil {
+		log.Errorf("auditEvents find error: %s", err)
+		return err
+	}
+	list.Total = total
+	if len(events) == 0 && filter.Page.Number > list.Pages() {
+		return c.Redirect(http.StatusFound, list.PageUrl(list.Pages()))
+	}
+
+	var rows []*auditEventRow
+	for _, event := range events {
+		rows = append(rows, &auditEventRow{
+			AuditEvent: event,
+			Changes:    auditChanges(event),
+		})
+	}
+
+	exportUrl := "/audit/export"
+	if query := c.QueryString(); len(query) != 0 {
+		exportUrl += "?" + query
+	}
+
+	return c.Render(http.StatusOK, "templates/audit.twig", pongo2.Context{
+		"_csrf_token": c.Get("csrf"),
+		"user":        context.user,
+		"users":       users,
+		"actions":     structures.AuditActions,
+		"targets":     structures.AuditTargets,
+		"events":      rows,
+		"list":        list,
+		"export_url":  exportUrl,
+	})
+}
+
+//auditExport Audit log filtered as on audit page in CSV, all pages latest first
+func (s *Server) auditExport(c echo.Context) error {
+	list := newListQuery(c)
+	filter := auditFilter(list)
+	filter.Page = storage.Page{Number: 1, Size: storage.PageSizeMax}
+	if filter.To.IsZero() {
+		//events recorded during export do not shift pages
+		filter.To = time.Now()
+	}
+
+	log.Infof("auditExport")
+
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	response.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="audit-%s.csv"`, time.Now().Format("20060102-150405")))
+	response.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(response)
+	if err := writer.Write([]string{"date", "user", "action", "target type", "target id", "target", "before", "after", "ip"}); err != nil {
+		return err
+	}
+	for {
+		events, _, err := s.store.AuditEventFind(filter)
+		if err != nil {
+			//headers are already sent, error page can not be rendered
+			log.Errorf("auditExport find error: %s", err)
+			return nil
+		}
+		for _, event := range events {
+			record := []string{
+				event.Date.Format(auditDateFormat),
+				event.UserLogin,
+				event.Action,
+				event.TargetType,
+				event.TargetId,
+				event.TargetName,
+				event.Before,
+				event.After,
+				event.Ip,
+			}
+			if err := writer.Write(csvSafeRecord(record)); err != nil {
+				log.Errorf("auditExport write error: %s", err)
+				return nil
+			}
+		}
+		if len(events) < filter.Page.Size {
+			break
+		}
+		filter.Page.Number++
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Errorf("auditExport flush error: %s", err)
+	}
+	return nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func auditFilter(list *listQuery) storage.AuditEventFilter {
+	return storage.AuditEventFilter{
+		UserId:     list.Get("user"),
+		Action:     list.Get("action"),
+		TargetType: list.Get("target_type"),
+		Target:     strings.TrimSpace(list.Get("target")),
+		From:       list.DateFrom("from"),
+		To:         list.DateTo("to"),
+	}
+}
+
+//auditChanges Fields of before and after values in name order, values are shown as JSON
+func auditChanges(event *structures.AuditEvent) []*auditChange {
+	before := auditDecode(event.Before)
+	after := auditDecode(event.After)
+
+	var fields []string
+	for field := range before {
+		fields = append(fields, field)
+	}
+	for field := range after {
+		if _, ok := before[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	var changes []*auditChange
+	for _, field := range fields {
+		changes = append(changes, &auditChange{
+			Field:  field,
+			Before: auditValue(before, field),
+			After:  auditValue(after, field),
+		})
+	}
+	return changes
+}
+
+func auditDecode(values string) map[string]json.RawMessage {
+	decoded := map[string]json.RawMessage{}
+	if len(values) == 0 {
+		return decoded
+	}
+	if err := json.Unmarshal([]byte(values), &decoded); err != nil {
+		log.Warnf("audit values decode error: %s", err)
+	}
+	return decoded
+}
+
+//auditValue Field value, strings are shown without quotes
+func auditValue(values map[string]json.RawMessage, field string) string {
+	value, ok := values[field]
+	if !ok {
+		return ""
+	}
+	var text string
+	if err := json.Unmarshal(value, &text); err == nil {
+		return text
+	}
+	return string(value)
+}
+
+//csvSafeRecord Record with values starting with formula characters prefixed by quote, so spreadsheets
+//do not evaluate user supplied names
+func csvSafeRecord(record []string) []string {
+	for i, value := range record {
+		if len(value) != 0 && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+			record[i] = "'" + value
+		}
+	}
+	return record
+}
@@ -2,6 +2,7 @@ package web
 
 import (
 	"ensemble/storage"
+	"ensemble/storage/structures"
 	"errors"
 	"github.com/flosch/pongo2/v4"
 	"github.com/labstack/echo/v4"
@@ -38,6 +39,7 @@ func (s *Server) loginSubmit(c echo.Context) error {
 	user, err := s.store.UserGetByLogin(login)
 	if err != nil || user == nil {
 		log.Errorf("loginSubmit user %s get user error: %s", login, err)
+		s.auditLogin(c, structures.AuditActionLoginFailed, login, nil)
 		return c.Render(http.StatusOK, "templates/login.twig", pongo2.Context{
 			"_csrf_token": c.Get("csrf"),
 			"login":       login,
@@ -47,6 +49,7 @@ func (s *Server) loginSubmit(c echo.Context) error {
 
 	if !storage.CheckPassword(password, user.Password) {
 		log.Warnf("loginSubmit user %s check password error", login)
+		s.auditLogin(c, structures.AuditActionLoginFailed, login, user)
 		return c.Render(http.StatusOK, "templates/login.twig", pongo2.Context{
 			"_csrf_token": c.Get("csrf"),
 			"login":       login,
@@ -65,6 +68,7 @@ func (s *Server) loginSubmit(c echo.Context) error {
 	}
 
 	context.SetSessionId(session.Id)
+	s.auditLogin(c, structures.AuditActionLogin, login, user)
 
 	return c.Redirect(http.StatusFound, "/")
 }
@@ -119,6 +123,7 @@ func (s *Server) profileSubmit(c echo.Context) error {
 		log.Errorf("profileSubmit user %s update error: %s", context.user.Login, err)
 		return err
 	}
+	s.audit(c, structures.AuditActionPasswordChange, structures.AuditTargetUser, user.Id, user.Login, nil, nil)
 
 	return c.Redirect(http.StatusFound, "/profile?done=1")
 }
@@ -4,6 +4,7 @@ import (
 	"ensemble/storage"
 	"ensemble/storage/structures"
 	"errors"
+	"fmt"
 	"github.com/flosch/pongo2/v4"
 	"github.com/labstack/echo/v4"
 	log "github.com/sirupsen/logrus"
@@ -49,6 +50,9 @@ func (s *Server) keyNewSubmit(c echo.Context) error {
 	if len(content) == 0 {
 		return errors.New("key content required")
 	}
+	if err := s.secrets.Validate(key.Password); err != nil {
+		return fmt.Errorf("key password: %w", err)
+	}
 
 	if err := s.keyManager.Save(key, content); err != nil {
 		log.Errorf("keyNewSubmit save file error: %s", err)
@@ -58,6 +62,7 @@ func (s *Server) keyNewSubmit(c echo.Context) error {
 		log.Errorf("keyNewSubmit insert error: %s", err)
 		return err
 	}
+	s.audit(c, structures.AuditActionKeyCreate, structures.AuditTargetKey, key.Id, key.Name, nil, key)
 
 	return c.Redirect(http.StatusFound, "/keys")
 }
@@ -75,10 +80,15 @@ func (s *Server) keyDeleteForm(c echo.Context) error {
 func (s *Server) keyDeleteSubmit(c echo.Context) error {
 	context := c.(*EnsembleContext)
 
+	if s.store.ProjectExistsByKey(context.key.Id) {
+		return errors.New("key is used as project deploy key")
+	}
+
 	if err := s.store.KeyDelete(context.key.Id); err != nil {
 		log.Errorf("keyDeleteSubmit key %s delete error: %s", context.key.Id, err)
 		return err
 	}
+	s.audit(c, structures.AuditActionKeyDelete, structures.AuditTargetKey, context.key.Id, context.key.Name, context.key, nil)
 
 	return c.Redirect(http.StatusFound, "/keys")
 }
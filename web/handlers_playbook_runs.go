@@ -1,7 +1,7 @@
 package web
 
 import (
-	"encoding/json"
+	"ensemble/storage"
 	"ensemble/storage/structures"
 	"errors"
 	"fmt"
@@ -9,16 +9,54 @@ import (
 	"github.com/labstack/echo/v4"
 	log "github.com/sirupsen/logrus"
 	"net/http"
+	"strings"
 )
 
+//userLogins Logins of users by id for history lists
+type userLogins map[string]string
+
+func (u userLogins) Login(id string) string {
+	return u[id]
+}
+
+//playbookRuns Playbook runs history page with filters by user, mode, result, date and task results
 func (s *Server) playbookRuns(c echo.Context) error {
 	context := c.(*EnsembleContext)
 
-	runs, err := s.store.PlaybookRunGetByPlaybook(context.playbook.Id)
+	list := newListQuery(c)
+	filter := storage.PlaybookRunFilter{
+		UserId:      list.Get("user"),
+		Mode:        list.Int("mode"),
+		Result:      list.Int("result"),
+		From:        list.DateFrom("from"),
+		To:          list.DateTo("to"),
+		Task:        strings.TrimSpace(list.Get("task")),
+		Host:        strings.TrimSpace(list.Get("host")),
+		TaskStatus:  list.Int("task_status"),
+		TaskChanged: list.Get("task_status") == "changed",
+		Sort:        list.Sort(),
+		Page:        list.Page(),
+	}
+
+	runs, total, err := s.store.PlaybookRunFind(context.playbook.Id, filter)
 	if err != nil {
 		log.Errorf("playbookRuns playbook %s runs get error: %s", context.playbook.Id, err)
 		return err
 	}
+	list.Total = total
+	if len(runs) == 0 && filter.Page.Number > list.Pages() {
+		return c.Redirect(http.StatusFound, list.PageUrl(list.Pages()))
+	}
+
+	//only users who ran the playbook are offered in filter, other users of the service are not disclosed
+	users, err := s.store.UserGetByPlaybookRuns(context.playbook.Id)
+	if err != nil {
+		log.Warnf("playbookRuns users get error: %s", err)
+	}
+	logins := userLogins{}
+	for _, user := range users {
+		logins[user.Id] = user.Login
+	}
 
 	return c.Render(http.StatusOK, "templates/playbook_runs.twig", pongo2.Context{
 		"_csrf_token": c.Get("csrf"),
@@ -26,41 +64,119 @@ func (s *Server) playbookRuns(c echo.Context) error {
 		"project":     context.project,
 		"playbook":    context.playbook,
 		"runs":        runs,
+		"list":        list,
+		"users":       users,
+		"run_users":   logins,
 	})
 }
 
+//runPlayView Play of run result with its tasks
+type runPlayView struct {
+	*structures.RunPlay
+	Tasks []*runTaskView
+}
+
+//runTaskView Task of run result with host results
+type runTaskView struct {
+	*structures.RunTask
+	Results []*structures.RunTaskResult
+}
+
+//runHostSummary Task counts of one host, ok includes changed tasks as in ansible stats
+type runHostSummary struct {
+	Host        string
+	Ok          int
+	Changed     int
+	Failures    int
+	Skipped     int
+	Unreachable int
+}
+
+//playbookRunResult Run result page, plays and tasks are read from parsed results,
+//raw output is shown only for runs which output is not ansible json
 func (s *Server) playbookRunResult(c echo.Context) error {
 	context := c.(*EnsembleContext)
+	run := context.playbookRun
 
-	var ansibleResult *structures.AnsibleExecution
-	var runResult *structures.RunResult
-	var runUser *structures.User
+	if run.Result != structures.PlaybookRunResultRunning && !run.ResultsParsed {
+		//run finished before results were stored in tables and not reached by background parsing yet
+		if err := s.runner.ParseResults(run); err != nil {
+			log.Warnf("playbookRunResult playbook run %s parse error: %s", run.Id, err)
+		} else if parsedRun, err := s.store.PlaybookRunGet(run.Id); err == nil {
+			run = parsedRun
+		}
+	}
 
-	runResult, err := s.store.RunResultGet(context.playbookRun.Id)
+	plays, hosts, err := s.runResultPlays(run.Id)
 	if err != nil {
-		log.Warnf("playbookRunResult playbook run %s get result error: %s", context.playbookRun.Id, err)
-	} else if context.playbookRun.Mode != structures.PlaybookRunModeSyntax {
-		ansibleResult = &structures.AnsibleExecution{}
-		if err := json.Unmarshal([]byte(runResult.Output), ansibleResult); err != nil {
-			log.Warnf("playbookRunResult playbook run %s unmarshal error: %s", context.playbookRun.Id, err)
-			ansibleResult = nil
+		log.Warnf("playbookRunResult playbook run %s get tasks error: %s", run.Id, err)
+	}
+
+	var runResult *structures.RunResult
+	if len(plays) != 0 {
+		runError, err := s.store.RunResultGetError(run.Id)
+		if err != nil {
+			log.Warnf("playbookRunResult playbook run %s get result error: %s", run.Id, err)
+		} else {
+			runResult = &structures.RunResult{Id: run.Id, RunId: run.Id, Error: runError}
 		}
+	} else if runResult, err = s.store.RunResultGet(run.Id); err != nil {
+		log.Warnf("playbookRunResult playbook run %s get result error: %s", run.Id, err)
 	}
 
-	runUser, err = s.store.UserGet(context.playbookRun.UserId)
+	runUser, err := s.store.UserGet(run.UserId)
 	if err != nil {
-		log.Warnf("playbookRunResult playbook run %s get user error: %s", context.playbookRun.Id, err)
+		log.Warnf("playbookRunResult playbook run %s get user error: %s", run.Id, err)
 	}
 
 	return c.Render(http.StatusOK, "templates/playbook_run_result.twig", pongo2.Context{
-		"_csrf_token":        c.Get("csrf"),
-		"user":               context.user,
-		"project":            context.project,
-		"playbook":           context.playbook,
-		"run":                context.playbookRun,
-		"run_result":         runResult,
-		"run_result_ansible": ansibleResult,
-		"run_user":           runUser,
+		"_csrf_token": c.Get("csrf"),
+		"user":        context.user,
+		"project":     context.project,
+		"playbook":    context.playbook,
+		"run":         run,
+		"run_result":  runResult,
+		"run_plays":   plays,
+		"run_hosts":   hosts,
+		"run_user":    runUser,
+	})
+}
+
+//playbookRunTaskResult Output, differences, facts and items of task on host, they are kept only in run output
+func (s *Server) playbookRunTaskResult(c echo.Context) error {
+	context := c.(*EnsembleContext)
+
+	taskResult, err := s.store.RunTaskResultGet(c.Param("task_result_id"))
+	if err != nil {
+		log.Errorf("playbookRunTaskResult playbook run %s task result get error: %s", context.playbookRun.Id, err)
+		return err
+	}
+	if taskResult.RunId != context.playbookRun.Id {
+		return errors.New("task result does not belong to playbook run")
+	}
+	task, err := s.store.RunTaskGet(taskResult.TaskId)
+	if err != nil {
+		log.Errorf("playbookRunTaskResult task %s get error: %s", taskResult.TaskId, err)
+		return err
+	}
+
+	runResult, err := s.store.RunResultGet(context.playbookRun.Id)
+	if err != nil {
+		log.Errorf("playbookRunTaskResult playbook run %s get result error: %s", context.playbookRun.Id, err)
+		return err
+	}
+	execution, err := structures.ParseAnsibleExecution(runResult.Output)
+	if err != nil {
+		log.Errorf("playbookRunTaskResult playbook run %s unmarshal error: %s", context.playbookRun.Id, err)
+		return err
+	}
+	ansibleResult, found := ansibleTaskResult(execution, task.Position, taskResult.Host)
+	if !found {
+		return errors.New("task result not found in run output")
+	}
+
+	return c.Render(http.StatusOK, "templates/playbook_run_task_result.twig", pongo2.Context{
+		"task_result": ansibleResult,
 	})
 }
 
@@ -85,6 +201,8 @@ func (s *Server) playbookRunDeleteSubmit(c echo.Context) error {
 		log.Errorf("playbookRunDeleteSubmit playbook run %s delete error: %s", context.playbookRun.Id, err)
 		return err
 	}
+	s.audit(c, structures.AuditActionPlaybookRunDelete, structures.AuditTargetPlaybookRun, context.playbookRun.Id,
+		playbookAuditName(context.project, context.playbook), context.playbookRun, nil)
 
 	returnUrl := fmt.Sprintf("/projects/playbooks/%s/runs/%s", context.project.Id, context.playbook.Id)
 
@@ -105,6 +223,8 @@ func (s *Server) playbookRunTerminate(c echo.Context) error {
 		log.Errorf("playbookRunTerminate playbook run %s termination error: %s", context.playbookRun.Id, err)
 		return err
 	}
+	s.audit(c, structures.AuditActionPlaybookRunStop, structures.AuditTargetPlaybookRun, context.playbookRun.Id,
+		playbookAuditName(context.project, context.playbook), nil, nil)
 
 	returnUrl := fmt.Sprintf("/projects/playbooks/%s/runs/%s/result/%s", context.project.Id, context.playbook.Id, context.playbookRun.Id)
 
@@ -132,3 +252,87 @@ func (s *Server) playbookRunDownload(c echo.Context) error {
 
 	return c.JSONBlob(http.StatusOK, []byte(result.Output))
 }
+
+///////////////////////////////////////////////////////////////////////////////
+
+//runResultPlays Plays with tasks and host results of run, hosts summary is ordered by host
+func (s *Server) runResultPlays(runId string) ([]*runPlayView, []*runHostSummary, error) {
+	plays, err := s.store.RunPlayGetByRun(runId)
+	if err != nil || len(plays) == 0 {
+		return nil, nil, err
+	}
+	tasks, err := s.store.RunTaskGetByRun(runId)
+	if err != nil {
+		return nil, nil, err
+	}
+	results, err := s.store.RunTaskResultGetByRun(runId)
+	if err != nil {
+		return nil, nil, err
+	}
+	return runResultViews(plays, tasks, results)
+}
+
+func runResultViews(plays []*structures.RunPlay, tasks []*structures.RunTask, results []*structures.RunTaskResult) ([]*runPlayView, []*runHostSummary, error) {
+	var playViews []*runPlayView
+	playsById := make(map[string]*runPlayView)
+	for _, play := range plays {
+		view := &runPlayView{RunPlay: play}
+		playViews = append(playViews, view)
+		playsById[play.Id] = view
+	}
+
+	tasksById := make(map[string]*runTaskView)
+	for _, task := range tasks {
+		play, ok := playsById[task.PlayId]
+		if !ok {
+			return nil, nil, fmt.Errorf("task %s play %s not found", task.Id, task.PlayId)
+		}
+		view := &runTaskView{RunTask: task}
+		play.Tasks = append(play.Tasks, view)
+		tasksById[task.Id] = view
+	}
+
+	var hosts []*runHostSummary
+	hostsByName := make(map[string]*runHostSummary)
+	for _, result := range results {
+		task, ok := tasksById[result.TaskId]
+		if !ok {
+			return nil, nil, fmt.Errorf("task result %s task %s not found", result.Id, result.TaskId)
+		}
+		task.Results = append(task.Results, result)
+
+		host, ok := hostsByName[result.Host]
+		if !ok {
+			host = &runHostSummary{Host: result.Host}
+			hosts = append(hosts, host)
+			hostsByName[result.Host] = host
+		}
+		switch result.Status {
+		case structures.RunTaskStatusFailed:
+			host.Failures++
+		case structures.RunTaskStatusSkipped:
+			host.Skipped++
+		case structures.RunTaskStatusUnreachable:
+			host.Unreachable++
+		default:
+			host.Ok++
+		}
+		if result.Changed {
+			host.Changed++
+		}
+	}
+	return playViews, hosts, nil
+}
+
+//ansibleTaskResult Result of task on host by task position through the whole run
+func ansibleTaskResult(execution *structures.AnsibleExecution, position int, host string) (structures.AnsibleTaskResult, bool) {
+	for _, play := range execution.Plays {
+		if position >= len(play.Tasks) {
+			position -= len(play.Tasks)
+			continue
+		}
+		result, ok := play.Tasks[position].TaskResults[host]
+		return result, ok
+	}
+	return structures.AnsibleTaskResult{}, false
+}
@@ -0,0 +1,68 @@
+package web
+
+import (
+	"ensemble/storage/structures"
+	"testing"
+)
+
+func TestRunResultViews(t *testing.T) {
+	plays := []*structures.RunPlay{{Id: "play1"}, {Id: "play2"}}
+	tasks := []*structures.RunTask{
+		{Id: "task1", PlayId: "play1", Position: 0},
+		{Id: "task2", PlayId: "play1", Position: 1},
+		{Id: "task3", PlayId: "play2", Position: 2},
+	}
+	results := []*structures.RunTaskResult{
+		{Id: "result1", TaskId: "task1", Host: "web1", Status: structures.RunTaskStatusOk, Changed: true},
+		{Id: "result2", TaskId: "task2", Host: "web1", Status: structures.RunTaskStatusFailed},
+		{Id: "result3", TaskId: "task3", Host: "web2", Status: structures.RunTaskStatusUnreachable},
+	}
+
+	views, hosts, err := runResultViews(plays, tasks, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(views) != 2 || len(views[0].Tasks) != 2 || len(views[1].Tasks) != 1 {
+		t.Fatalf("tasks should be grouped by play: %+v", views)
+	}
+	if len(views[1].Tasks[0].Results) != 1 || views[1].Tasks[0].Results[0].Host != "web2" {
+		t.Errorf("results should be grouped by task: %+v", views[1].Tasks[0])
+	}
+	if len(hosts) != 2 {
+		t.Fatalf("expected 2 hosts, got %d", len(hosts))
+	}
+	if web1 := hosts[0]; web1.Host != "web1" || web1.Ok != 1 || web1.Changed != 1 || web1.Failures != 1 {
+		t.Errorf("unexpected web1 summary %+v", web1)
+	}
+	if web2 := hosts[1]; web2.Unreachable != 1 || web2.Ok != 0 {
+		t.Errorf("unexpected web2 summary %+v", web2)
+	}
+
+	if _, _, err := runResultViews(plays, tasks[:1], results); err == nil {
+		t.Error("result of unknown task should be rejected")
+	}
+}
+
+func TestAnsibleTaskResult(t *testing.T) {
+	execution := &structures.AnsibleExecution{
+		Plays: []structures.AnsiblePlay{
+			{Tasks: []structures.AnsibleTask{
+				{TaskResults: map[string]structures.AnsibleTaskResult{"web1": {Stdout: "first"}}},
+			}},
+			{Tasks: []structures.AnsibleTask{
+				{TaskResults: map[string]structures.AnsibleTaskResult{"web1": {Stdout: "second"}}},
+				{TaskResults: map[string]structures.AnsibleTaskResult{"web1": {Stdout: "third"}}},
+			}},
+		},
+	}
+
+	if result, found := ansibleTaskResult(execution, 2, "web1"); !found || result.Stdout != "third" {
+		t.Errorf("task position should count tasks of previous plays, got %q", result.Stdout)
+	}
+	if _, found := ansibleTaskResult(execution, 1, "web2"); found {
+		t.Error("result of unknown host should not be found")
+	}
+	if _, found := ansibleTaskResult(execution, 3, "web1"); found {
+		t.Error("result of position after last task should not be found")
+	}
+}
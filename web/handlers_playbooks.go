@@ -1,6 +1,7 @@
 package web
 
 import (
+	"ensemble/runner"
 	"ensemble/storage/structures"
 	"errors"
 	"fmt"
@@ -8,13 +9,22 @@ import (
 	"github.com/labstack/echo/v4"
 	log "github.com/sirupsen/logrus"
 	"net/http"
+	"strings"
 )
 
+//surveyFieldPrefix Prefix of survey input names on run form, same prefix is used in template
+const surveyFieldPrefix = "survey_"
+
 type playbookInfo struct {
 	Playbook *structures.Playbook
 	Run      *structures.PlaybookRun
 }
 
+type playbookSurveyField struct {
+	Question *structures.PlaybookSurveyQuestion
+	Value    string
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 
 func (s *Server) playbooks(c echo.Context) error {
@@ -47,37 +57,108 @@ func (s *Server) playbooks(c echo.Context) error {
 func (s *Server) playbookRun(c echo.Context) error {
 	context := c.(*EnsembleContext)
 
-	mode := structures.PlaybookRunModeCheck
+	operation := c.Param("operation")
+	mode, err := playbookRunMode(operation)
+	if err != nil {
+		return err
+	}
+
+	if context.playbook.Locked {
+		return errors.New("playbook is locked")
+	}
+	if mode == structures.PlaybookRunModeExecute && !context.playbook.SyntaxValid {
+		return errors.New("playbook has syntax errors, update project to check it again")
+	}
+
+	return s.playbookRunForm(c, operation, mode, context.project, playbookSurveyDefaults(context.playbook), nil)
+}
+
+func (s *Server) playbookRunSubmit(c echo.Context) error {
+	context := c.(*EnsembleContext)
 
 	operation := c.Param("operation")
-	switch operation {
-	case "execute":
-		mode = structures.PlaybookRunModeExecute
-	case "check":
-		mode = structures.PlaybookRunModeCheck
-	case "syntax":
-		mode = structures.PlaybookRunModeSyntax
-	default:
-		return errors.New("unknown run mode")
+	mode, err := playbookRunMode(operation)
+	if err != nil {
+		return err
 	}
 
 	if context.playbook.Locked {
 		return errors.New("playbook is locked")
 	}
+	if mode == structures.PlaybookRunModeExecute && !context.playbook.SyntaxValid {
+		return errors.New("playbook has syntax errors, update project to check it again")
+	}
+
+	formParams, _ := c.FormParams()
+
+	//project copy holding run selection, project settings are only defaults
+	selection := *context.project
+	selection.Inventory = strings.Join(formParams["inventory"], "|")
+	selection.Variables = strings.Join(formParams["variables"], "|")
+
+	values := playbookSurveyValues(c, context.playbook)
+
+	extraVars, err := runner.SurveyAnswers(context.playbook, values)
+	if len(selection.InventorySelectedList()) == 0 {
+		err = errors.New("at least one inventory should be selected")
+	}
+	if selectionErr := validateSelection(selection.InventorySelectedList(), selection.InventoryList()); selectionErr != nil {
+		err = fmt.Errorf("inventory: %w", selectionErr)
+	}
+	if selectionErr := validateSelection(selection.VariablesSelectedList(), selection.VariablesList()); selectionErr != nil {
+		err = fmt.Errorf("variables: %w", selectionErr)
+	}
+	if err == nil && context.playbook.Dangerous && mode == structures.PlaybookRunModeExecute && c.FormValue("confirm") != "on" {
+		err = errors.New("dangerous playbook execution should be confirmed")
+	}
+	if confirmation := playbookRunConfirmation(&selection, mode); err == nil && c.FormValue("inventory_confirm") != confirmation {
+		err = fmt.Errorf("type %s to confirm run on protected inventory", confirmation)
+	}
+	if err != nil {
+		log.Warnf("playbookRunSubmit playbook %s run form error: %s", context.playbook.Id, err)
+		for _, question := range context.playbook.SurveyQuestions() {
+			if question.Type == structures.PlaybookSurveySecret {
+				values[question.Variable] = ""
+			}
+		}
+		return s.playbookRunForm(c, operation, mode, &selection, values, err)
+	}
 
 	log.Infof("playbookRun playbook %s run mode %s", context.playbook.Id, operation)
 
-	run, err := s.runner.Run(context.project, context.playbook, mode, context.user.Id)
+	run, err := s.runner.Run(context.project, context.playbook, mode, context.user.Id, &runner.Options{
+		Inventories: selection.InventorySelectedList(),
+		Variables:   selection.VariablesSelectedList(),
+		ExtraVars:   extraVars,
+	})
 	if err != nil {
 		log.Errorf("playbookRun playbook %s mode %s run error: %s", context.playbook.Id, operation, err)
 		return err
 	}
+	s.audit(c, structures.AuditActionPlaybookRun, structures.AuditTargetPlaybook, context.playbook.Id, playbookAuditName(context.project, context.playbook), nil, run)
 
 	returnUrl := fmt.Sprintf("/projects/playbooks/%s/runs/%s/result/%s", context.project.Id, context.playbook.Id, run.Id)
 
 	return c.Redirect(http.StatusFound, returnUrl)
 }
 
+func (s *Server) playbookRunForm(c echo.Context, operation string, mode int, selection *structures.Project, values map[string]string, err error) error {
+	context := c.(*EnsembleContext)
+
+	return c.Render(http.StatusOK, "templates/playbook_run.twig", pongo2.Context{
+		"_csrf_token":  c.Get("csrf"),
+		"user":         context.user,
+		"project":      context.project,
+		"playbook":     context.playbook,
+		"operation":    operation,
+		"mode":         mode,
+		"selection":    selection,
+		"confirmation": playbookRunConfirmation(selection, mode),
+		"fields":       playbookSurveyFields(context.playbook, values),
+		"error":        err,
+	})
+}
+
 func (s *Server) playbookLock(c echo.Context) error {
 	context := c.(*EnsembleContext)
 
@@ -99,8 +180,71 @@ func (s *Server) playbookLock(c echo.Context) error {
 		log.Errorf("playbookLock playbook %s lock %s error: %s", context.playbook.Id, operation, err)
 		return err
 	}
+	action := structures.AuditActionPlaybookLock
+	if !lock {
+		action = structures.AuditActionPlaybookUnlock
+	}
+	s.audit(c, action, structures.AuditTargetPlaybook, context.playbook.Id, playbookAuditName(context.project, context.playbook), nil, nil)
 
 	returnUrl := fmt.Sprintf("/projects/playbooks/%s", context.project.Id)
 
 	return c.Redirect(http.StatusFound, returnUrl)
 }
+
+///////////////////////////////////////////////////////////////////////////////
+
+func playbookRunMode(operation string) (int, error) {
+	switch operation {
+	case "execute":
+		return structures.PlaybookRunModeExecute, nil
+	case "check":
+		return structures.PlaybookRunModeCheck, nil
+	case "syntax":
+		return structures.PlaybookRunModeSyntax, nil
+	default:
+		return 0, errors.New("unknown run mode")
+	}
+}
+
+//playbookSurveyValues Survey answers from run form, inputs are prefixed so variables can not
+//override run form fields
+func playbookSurveyValues(c echo.Context, playbook *structures.Playbook) map[string]string {
+	values := make(map[string]string)
+	for _, question := range playbook.SurveyQuestions() {
+		values[question.Variable] = c.FormValue(surveyFieldPrefix + question.Variable)
+	}
+	return values
+}
+
+//playbookRunConfirmation Text to type before run on protected inventories, empty when not required
+func playbookRunConfirmation(selection *structures.Project, mode int) string {
+	if mode == structures.PlaybookRunModeSyntax {
+		return ""
+	}
+	var protected []string
+	for _, inventory := range selection.InventorySelectedList() {
+		if selection.InventoryIsProtected(inventory) {
+			protected = append(protected, strings.TrimSuffix(inventory, "/"))
+		}
+	}
+	return strings.Join(protected, ", ")
+}
+
+func playbookSurveyDefaults(playbook *structures.Playbook) map[string]string {
+	values := make(map[string]string)
+	for _, question := range playbook.SurveyQuestions() {
+		values[question.Variable] = question.Default
+	}
+	return values
+}
+
+func playbookSurveyFields(playbook *structures.Playbook, values map[string]string) []*playbookSurveyField {
+	var fields []*playbookSurveyField
+	for _, question := range playbook.SurveyQuestions() {
+		fields = append(fields, &playbookSurveyField{
+			Question: question,
+			Value:    values[question.Variable],
+		})
+	}
+	return fields
+}
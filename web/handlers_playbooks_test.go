@@ -0,0 +1,36 @@
+package web
+
+import (
+	"ensemble/storage/structures"
+	"github.com/labstack/echo/v4"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlaybookSurveyValues(t *testing.T) {
+	playbook := &structures.Playbook{
+		Survey: `[{"variable": "inventory"}, {"variable": "confirm", "type": "boolean"}, {"variable": "_ensemble_csrf"}]`,
+	}
+
+	form := url.Values{}
+	form.Set("inventory", "main.yml")
+	form.Set("confirm", "on")
+	form.Set("_ensemble_csrf", "token")
+	form.Set("survey_inventory", "answer")
+	form.Set("survey__ensemble_csrf", "value")
+	request := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	c := echo.New().NewContext(request, httptest.NewRecorder())
+
+	//run form fields with the same names are not taken as answers
+	expected := map[string]string{"inventory": "answer", "confirm": "", "_ensemble_csrf": "value"}
+	if values := playbookSurveyValues(c, playbook); !reflect.DeepEqual(values, expected) {
+		t.Fatalf("unexpected survey values: %v", values)
+	}
+	if c.FormValue("inventory") != "main.yml" || c.FormValue("confirm") != "on" {
+		t.Fatal("run form fields changed")
+	}
+}
@@ -0,0 +1,109 @@
+package web
+
+import (
+	"ensemble/repository"
+	"ensemble/storage/structures"
+	"errors"
+	"fmt"
+	"github.com/flosch/pongo2/v4"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+	"mime/multipart"
+	"net/http"
+)
+
+//projectArchives Uploaded archive versions of project
+func (s *Server) projectArchives(c echo.Context) error {
+	return s.projectArchivesRender(c, nil)
+}
+
+//projectArchiveUpload Save new archive version and deploy it unless project is pinned to another version
+func (s *Server) projectArchiveUpload(c echo.Context) error {
+	context := c.(*EnsembleContext)
+
+	log.Infof("projectArchiveUpload %s", context.project.Id)
+
+	archive, err := c.FormFile("archive")
+	if err != nil {
+		return s.projectArchivesRender(c, errors.New("archive should be uploaded"))
+	}
+	if err := s.projectArchiveSave(context.project, context.user.Id, archive); err != nil {
+		log.Errorf("projectArchiveUpload project %s archive save error: %s", context.project.Id, err)
+		return s.projectArchivesRender(c, err)
+	}
+	s.audit(c, structures.AuditActionProjectArchive, structures.AuditTargetProject, context.project.Id, context.project.Name,
+		nil, map[string]string{"Filename": archive.Filename})
+
+	if len(context.project.Revision) != 0 {
+		return c.Redirect(http.StatusFound, fmt.Sprintf("/projects/archives/%s", context.project.Id))
+	}
+
+	if err := s.manager.UpdateAsync(context.project); err != nil && !errors.Is(err, repository.ErrUpdateRunning) {
+		log.Errorf("projectArchiveUpload project %s update error: %s", context.project.Id, err)
+		return err
+	}
+
+	return c.Redirect(http.StatusFound, projectUpdateLiveUrl(context.project.Id))
+}
+
+//projectArchiveDeploy Pin project to selected archive version or follow the latest one and update
+func (s *Server) projectArchiveDeploy(c echo.Context) error {
+	context := c.(*EnsembleContext)
+
+	log.Infof("projectArchiveDeploy %s", context.project.Id)
+
+	project := context.project
+	before := *project
+
+	archiveId := c.FormValue("archive_id")
+	if len(archiveId) != 0 {
+		archive, err := s.store.ProjectArchiveGet(archiveId)
+		if err != nil || archive.ProjectId != project.Id {
+			return errors.New("archive not found")
+		}
+	}
+	project.Revision = archiveId
+
+	if err := s.store.ProjectUpdate(project); err != nil {
+		log.Errorf("projectArchiveDeploy project %s save error: %s", project.Id, err)
+		return err
+	}
+	s.audit(c, structures.AuditActionProjectDeploy, structures.AuditTargetProject, project.Id, project.Name, &before, project)
+	if err := s.manager.UpdateAsync(project); err != nil && !errors.Is(err, repository.ErrUpdateRunning) {
+		log.Errorf("projectArchiveDeploy project %s update error: %s", project.Id, err)
+		return err
+	}
+
+	return c.Redirect(http.StatusFound, projectUpdateLiveUrl(project.Id))
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func (s *Server) projectArchivesRender(c echo.Context, err error) error {
+	context := c.(*EnsembleContext)
+
+	archives, archivesErr := s.store.ProjectArchiveGetByProject(context.project.Id)
+	if archivesErr != nil {
+		log.Errorf("projectArchives project %s archives get error: %s", context.project.Id, archivesErr)
+		return archivesErr
+	}
+
+	return c.Render(http.StatusOK, "templates/project_archives.twig", pongo2.Context{
+		"_csrf_token": c.Get("csrf"),
+		"user":        context.user,
+		"project":     context.project,
+		"archives":    archives,
+		"error":       err,
+	})
+}
+
+func (s *Server) projectArchiveSave(project *structures.Project, userId string, archive *multipart.FileHeader) error {
+	content, err := archive.Open()
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	_, err = s.manager.ArchiveSave(project, userId, archive.Filename, content)
+	return err
+}
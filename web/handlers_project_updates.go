@@ -1,6 +1,8 @@
 package web
 
 import (
+	"ensemble/storage"
+	"ensemble/storage/structures"
 	"fmt"
 	"github.com/flosch/pongo2/v4"
 	"github.com/labstack/echo/v4"
@@ -8,23 +10,70 @@ import (
 	"net/http"
 )
 
+//projectUpdates Project updates history page with filters by result and date
 func (s *Server) projectUpdates(c echo.Context) error {
 	context := c.(*EnsembleContext)
 
-	updates, err := s.store.ProjectUpdateGetByProject(context.project.Id)
+	list := newListQuery(c)
+	filter := storage.ProjectUpdateFilter{
+		Result: list.Int("result"),
+		From:   list.DateFrom("from"),
+		To:     list.DateTo("to"),
+		Sort:   list.Sort(),
+		Page:   list.Page(),
+	}
+
+	updates, total, err := s.store.ProjectUpdateFind(context.project.Id, filter)
 	if err != nil {
 		log.Infof("projectUpdates project %s updates get error: %s", context.project.Id, err)
 		return err
 	}
+	list.Total = total
+	if len(updates) == 0 && filter.Page.Number > list.Pages() {
+		return c.Redirect(http.StatusFound, list.PageUrl(list.Pages()))
+	}
 
 	return c.Render(http.StatusOK, "templates/project_updates.twig", pongo2.Context{
 		"_csrf_token": c.Get("csrf"),
 		"user":        context.user,
 		"project":     context.project,
 		"updates":     updates,
+		"list":        list,
+		"status":      s.manager.UpdateStatus(context.project.Id),
+	})
+}
+
+//projectUpdateLive Log of running project update
+func (s *Server) projectUpdateLive(c echo.Context) error {
+	context := c.(*EnsembleContext)
+
+	return c.Render(http.StatusOK, "templates/project_update_live.twig", pongo2.Context{
+		"_csrf_token": c.Get("csrf"),
+		"user":        context.user,
+		"project":     context.project,
+		"status":      s.manager.UpdateStatus(context.project.Id),
 	})
 }
 
+func (s *Server) projectUpdateLiveStatus(c echo.Context) error {
+	context := c.(*EnsembleContext)
+	return c.JSON(http.StatusOK, s.manager.UpdateStatus(context.project.Id))
+}
+
+func (s *Server) projectUpdateCancel(c echo.Context) error {
+	context := c.(*EnsembleContext)
+
+	log.Infof("projectUpdateCancel %s", context.project.Id)
+
+	if err := s.manager.CancelUpdate(context.project.Id); err != nil {
+		log.Errorf("projectUpdateCancel project %s cancel error: %s", context.project.Id, err)
+		return err
+	}
+	s.audit(c, structures.AuditActionProjectUpdateCancel, structures.AuditTargetProject, context.project.Id, context.project.Name, nil, nil)
+
+	return c.Redirect(http.StatusFound, projectUpdateLiveUrl(context.project.Id))
+}
+
 func (s *Server) projectUpdateLog(c echo.Context) error {
 	context := c.(*EnsembleContext)
 
@@ -57,8 +106,14 @@ func (s *Server) projectUpdateDeleteSubmit(c echo.Context) error {
 		log.Errorf("projectUpdateDeleteSubmit project update %s delete error: %s", context.projectUpdate.Id, err)
 		return err
 	}
+	s.audit(c, structures.AuditActionProjectUpdateDelete, structures.AuditTargetProjectUpdate, context.projectUpdate.Id, context.project.Name,
+		map[string]any{"Date": context.projectUpdate.Date, "Revision": context.projectUpdate.Revision}, nil)
 
 	returnUrl := fmt.Sprintf("/projects/updates/%s", context.project.Id)
 
 	return c.Redirect(http.StatusFound, returnUrl)
 }
+
+func projectUpdateLiveUrl(projectId string) string {
+	return fmt.Sprintf("/projects/updates/%s/live", projectId)
+}
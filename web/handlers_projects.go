@@ -1,12 +1,18 @@
 package web
 
 import (
+	"ensemble/repository"
+	"ensemble/scheduler"
+	"ensemble/storage"
 	"ensemble/storage/structures"
 	"errors"
+	"fmt"
 	"github.com/flosch/pongo2/v4"
 	"github.com/labstack/echo/v4"
 	log "github.com/sirupsen/logrus"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 type projectInfo struct {
@@ -60,6 +66,7 @@ func (s *Server) projectNewForm(c echo.Context) error {
 	return c.Render(http.StatusOK, "templates/project_new.twig", pongo2.Context{
 		"_csrf_token": c.Get("csrf"),
 		"user":        context.user,
+		"keys":        s.projectKeys(),
 	})
 }
 
@@ -68,30 +75,71 @@ func (s *Server) projectNewSubmit(c echo.Context) error {
 	context := c.(*EnsembleContext)
 
 	project := &structures.Project{
-		Name:               c.FormValue("name"),
-		Description:        c.FormValue("description"),
-		RepositoryUrl:      c.FormValue("repo_url"),
-		RepositoryLogin:    c.FormValue("repo_login"),
-		RepositoryPassword: c.FormValue("repo_password"),
-		RepositoryBranch:   c.FormValue("repo_branch"),
+		Name:                 c.FormValue("name"),
+		Description:          c.FormValue("description"),
+		SourceType:           formSourceType(c),
+		SourcePath:           strings.TrimSpace(c.FormValue("source_path")),
+		RepositoryUrl:        c.FormValue("repo_url"),
+		RepositoryLogin:      c.FormValue("repo_login"),
+		RepositoryPassword:   c.FormValue("repo_password"),
+		RepositoryBranch:     c.FormValue("repo_branch"),
+		RevisionType:         formRevisionType(c),
+		Revision:             strings.TrimSpace(c.FormValue("repo_revision")),
+		RepositoryKeyId:      c.FormValue("repo_key_id"),
+		RepositoryHostKeys:   strings.TrimSpace(c.FormValue("repo_host_keys")),
+		RepositorySubmodules: c.FormValue("repo_submodules") == "on",
+		RepositoryLfs:        c.FormValue("repo_lfs") == "on",
+		UpdateSchedule:       strings.TrimSpace(c.FormValue("update_schedule")),
+		UpdatePolicy:         formUpdatePolicy(c),
+	}
+
+	if !project.IsGit() {
+		project.RevisionType = structures.ProjectRevisionBranch
+		project.Revision = ""
 	}
 
 	var err error
 	if len(project.Name) == 0 {
 		err = errors.New("project name should not be empty")
 	}
-	if len(project.RepositoryUrl) == 0 {
+	if project.IsGit() && len(project.RepositoryUrl) == 0 {
 		err = errors.New("repository URL should not be empty")
 	}
+	if sourceErr := s.manager.ValidateSource(project); sourceErr != nil {
+		err = sourceErr
+	}
+	archive, _ := c.FormFile("archive")
+	if project.SourceType == structures.ProjectSourceArchive {
+		if archive == nil {
+			err = errors.New("archive should be uploaded")
+		} else if len(repository.ArchiveExtension(archive.Filename)) == 0 {
+			err = errors.New("archive should be a .tar.gz, .tgz or .zip file")
+		}
+	}
 	if len(project.RepositoryBranch) == 0 {
 		project.RepositoryBranch = structures.ProjectDefaultBranchName
 	}
+	if scheduleErr := scheduler.ValidateSchedule(project.UpdateSchedule); scheduleErr != nil {
+		err = scheduleErr
+	}
+	if revisionErr := repository.ValidateRevision(project); revisionErr != nil {
+		err = revisionErr
+	}
+	if len(project.RepositoryKeyId) != 0 {
+		if _, keyErr := s.store.KeyGet(project.RepositoryKeyId); keyErr != nil {
+			err = errors.New("selected deploy key not found")
+		}
+	}
+	if secretErr := s.validateSecrets(project); secretErr != nil {
+		err = secretErr
+	}
 	if err != nil {
 		log.Errorf("projectNewSubmit error: %s", err)
 		return c.Render(http.StatusOK, "templates/project_new.twig", pongo2.Context{
 			"_csrf_token": c.Get("csrf"),
 			"user":        context.user,
 			"project":     project,
+			"keys":        s.projectKeys(),
 			"error":       err,
 		})
 	}
@@ -102,24 +150,40 @@ func (s *Server) projectNewSubmit(c echo.Context) error {
 			"_csrf_token": c.Get("csrf"),
 			"user":        context.user,
 			"project":     project,
+			"keys":        s.projectKeys(),
 			"error":       err,
 		})
 	}
 
-	if err := s.manager.Update(project); err != nil {
-		log.Errorf("projectNewSubmit project %s update error: %s", project.Id, err)
-		if err := s.store.ProjectDelete(project.Id); err != nil {
-			log.Errorf("projectNewSubmit project %s delete error: %s", project.Id, err)
+	if project.SourceType == structures.ProjectSourceArchive {
+		if err := s.projectArchiveSave(project, context.user.Id, archive); err != nil {
+			//project without archive can not be updated, it is removed with uploaded files
+			log.Errorf("projectNewSubmit project %s archive save error: %s", project.Id, err)
+			if deleteErr := s.store.ProjectDelete(project.Id); deleteErr != nil {
+				log.Errorf("projectNewSubmit project %s delete error: %s", project.Id, deleteErr)
+			}
+			project.Id = ""
+			return c.Render(http.StatusOK, "templates/project_new.twig", pongo2.Context{
+				"_csrf_token": c.Get("csrf"),
+				"user":        context.user,
+				"project":     project,
+				"keys":        s.projectKeys(),
+				"error":       err,
+			})
 		}
-		return c.Render(http.StatusOK, "templates/project_new.twig", pongo2.Context{
-			"_csrf_token": c.Get("csrf"),
-			"user":        context.user,
-			"project":     project,
-			"error":       err,
-		})
 	}
+	s.audit(c, structures.AuditActionProjectCreate, structures.AuditTargetProject, project.Id, project.Name, nil, project)
 
-	return c.Redirect(http.StatusFound, "/projects")
+	if err := s.scheduler.Schedule(project); err != nil {
+		log.Errorf("projectNewSubmit project %s schedule error: %s", project.Id, err)
+	}
+
+	if err := s.manager.UpdateAsync(project); err != nil {
+		log.Errorf("projectNewSubmit project %s update error: %s", project.Id, err)
+		return err
+	}
+
+	return c.Redirect(http.StatusFound, projectUpdateLiveUrl(project.Id))
 }
 
 //projectEditForm Project edit form
@@ -130,6 +194,7 @@ func (s *Server) projectEditForm(c echo.Context) error {
 		"_csrf_token": c.Get("csrf"),
 		"user":        context.user,
 		"project":     context.project,
+		"keys":        s.projectKeys(),
 	})
 }
 
@@ -140,14 +205,34 @@ func (s *Server) projectEditSubmit(c echo.Context) error {
 	log.Infof("projectEditSubmit %s", context.project.Id)
 
 	project := context.project
+	before := *project
 
 	project.Name = c.FormValue("name")
 	project.Description = c.FormValue("description")
+	if sourceType := formSourceType(c); sourceType != project.SourceType {
+		//revision of previous source has no meaning for the new one
+		project.SourceType = sourceType
+		project.RevisionType = structures.ProjectRevisionBranch
+		project.Revision = ""
+	}
+	project.SourcePath = strings.TrimSpace(c.FormValue("source_path"))
 	project.RepositoryUrl = c.FormValue("repo_url")
 	project.RepositoryLogin = c.FormValue("repo_login")
 	project.RepositoryBranch = c.FormValue("repo_branch")
-	project.Inventory = c.FormValue("inventory")
-	project.Variables = c.FormValue("variables")
+	if project.IsGit() {
+		project.RevisionType = formRevisionType(c)
+		project.Revision = strings.TrimSpace(c.FormValue("repo_revision"))
+	}
+	project.RepositoryKeyId = c.FormValue("repo_key_id")
+	project.RepositoryHostKeys = strings.TrimSpace(c.FormValue("repo_host_keys"))
+	project.RepositorySubmodules = c.FormValue("repo_submodules") == "on"
+	project.RepositoryLfs = c.FormValue("repo_lfs") == "on"
+	formParams, _ := c.FormParams()
+	project.Inventory = strings.Join(formParams["inventory"], "|")
+	project.Variables = strings.Join(formParams["variables"], "|")
+	project.InventoryProtected = strings.Join(formParams["inventory_protected"], "|")
+	project.UpdateSchedule = strings.TrimSpace(c.FormValue("update_schedule"))
+	project.UpdatePolicy = formUpdatePolicy(c)
 
 	repositoryPassword := c.FormValue("repo_password")
 	if len(repositoryPassword) > 0 {
@@ -157,42 +242,53 @@ func (s *Server) projectEditSubmit(c echo.Context) error {
 	if len(vaultPassword) > 0 {
 		project.VaultPassword = vaultPassword
 	}
+	inventoryEnv := strings.TrimSpace(c.FormValue("inventory_env"))
+	if len(inventoryEnv) > 0 {
+		project.InventoryEnv = inventoryEnv
+	} else if c.FormValue("inventory_env_clear") == "on" {
+		project.InventoryEnv = ""
+	}
 
 	var err error
 
 	if len(project.Name) == 0 {
 		err = errors.New("project name should not be empty")
 	}
-	if len(project.RepositoryUrl) == 0 {
+	if project.IsGit() && len(project.RepositoryUrl) == 0 {
 		err = errors.New("repository URL should not be empty")
 	}
+	if sourceErr := s.manager.ValidateSource(project); sourceErr != nil {
+		err = sourceErr
+	}
 	if len(project.RepositoryBranch) == 0 {
 		project.RepositoryBranch = structures.ProjectDefaultBranchName
 	}
 	if len(project.Inventory) == 0 {
-		project.Inventory = structures.ProjectDefaultInventoryName
+		project.Inventory = project.InventoryDefault
 	}
-
-	inventoryFound := false
-	for _, inventory := range project.InventoryList() {
-		if inventory == project.Inventory {
-			inventoryFound = true
-			break
+	if scheduleErr := scheduler.ValidateSchedule(project.UpdateSchedule); scheduleErr != nil {
+		err = scheduleErr
+	}
+	if revisionErr := repository.ValidateRevision(project); revisionErr != nil {
+		err = revisionErr
+	}
+	if len(project.RepositoryKeyId) != 0 {
+		if _, keyErr := s.store.KeyGet(project.RepositoryKeyId); keyErr != nil {
+			err = errors.New("selected deploy key not found")
 		}
 	}
-	if !inventoryFound {
-		err = errors.New("selected inventory not found")
+	if secretErr := s.validateSecrets(project); secretErr != nil {
+		err = secretErr
 	}
 
-	variablesFound := false
-	for _, variables := range project.VariablesList() {
-		if variables == project.Variables {
-			variablesFound = true
-			break
-		}
+	if selectionErr := validateSelection(project.InventorySelectedList(), project.InventoryList()); selectionErr != nil {
+		err = fmt.Errorf("inventory: %w", selectionErr)
+	}
+	if selectionErr := validateSelection(project.VariablesSelectedList(), project.VariablesList()); selectionErr != nil {
+		err = fmt.Errorf("variables: %w", selectionErr)
 	}
-	if len(project.Variables) != 0 && !variablesFound {
-		err = errors.New("selected variables not found")
+	if selectionErr := validateSelection(project.InventoryProtectedList(), project.InventoryList()); selectionErr != nil {
+		err = fmt.Errorf("protected inventory: %w", selectionErr)
 	}
 
 	if err != nil {
@@ -201,6 +297,7 @@ func (s *Server) projectEditSubmit(c echo.Context) error {
 			"_csrf_token": c.Get("csrf"),
 			"user":        context.user,
 			"project":     project,
+			"keys":        s.projectKeys(),
 			"error":       err,
 		})
 	}
@@ -212,10 +309,17 @@ func (s *Server) projectEditSubmit(c echo.Context) error {
 			"_csrf_token": c.Get("csrf"),
 			"user":        context.user,
 			"project":     project,
+			"keys":        s.projectKeys(),
 			"error":       err,
 		})
 	}
 
+	s.audit(c, structures.AuditActionProjectUpdate, structures.AuditTargetProject, project.Id, project.Name, &before, project)
+
+	if err := s.scheduler.Schedule(project); err != nil {
+		log.Errorf("projectEditSubmit project %s schedule error: %s", project.Id, err)
+	}
+
 	return c.Redirect(http.StatusFound, "/projects")
 }
 
@@ -241,6 +345,9 @@ func (s *Server) projectDeleteSubmit(c echo.Context) error {
 		log.Errorf("projectDeleteSubmit project %s delete error: %s", context.project.Id, err)
 		return err
 	}
+	s.audit(c, structures.AuditActionProjectDelete, structures.AuditTargetProject, context.project.Id, context.project.Name, context.project, nil)
+
+	s.scheduler.Unschedule(context.project.Id)
 
 	return c.Redirect(http.StatusFound, "/projects")
 }
@@ -251,11 +358,162 @@ func (s *Server) projectUpdate(c echo.Context) error {
 
 	log.Infof("projectUpdate %s", context.project.Id)
 
-	err := s.manager.Update(context.project)
-	if err != nil {
+	err := s.manager.UpdateAsync(context.project)
+	if err != nil && !errors.Is(err, repository.ErrUpdateRunning) {
 		log.Errorf("projectUpdate project %s update error: %s", context.project.Id, err)
 		return err
 	}
+	if err == nil {
+		s.audit(c, structures.AuditActionProjectRefresh, structures.AuditTargetProject, context.project.Id, context.project.Name, nil, nil)
+	}
+
+	return c.Redirect(http.StatusFound, projectUpdateLiveUrl(context.project.Id))
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+//projectRevisions Recent commits and tags of project repository
+func (s *Server) projectRevisions(c echo.Context) error {
+	context := c.(*EnsembleContext)
+
+	if !context.project.IsGit() {
+		return errors.New("project is not a git project")
+	}
+
+	revisions, err := s.manager.Revisions(context.project)
+	if err != nil {
+		log.Errorf("projectRevisions project %s revisions get error: %s", context.project.Id, err)
+		return err
+	}
 
-	return c.Redirect(http.StatusFound, "/projects")
+	//submodule commits checked out with deployed revision are recorded by the last successful update
+	var submodules []structures.ProjectUpdateSubmodule
+	updates, _, err := s.store.ProjectUpdateFind(context.project.Id, storage.ProjectUpdateFilter{
+		Result: storage.ProjectUpdateResultSuccess,
+		Page:   storage.Page{Number: 1, Size: 1},
+	})
+	if err != nil {
+		log.Errorf("projectRevisions project %s updates get error: %s", context.project.Id, err)
+		return err
+	}
+	if len(updates) != 0 {
+		if changes := updates[0].ChangesInfo(); changes != nil {
+			submodules = changes.Submodules
+		}
+	}
+
+	return c.Render(http.StatusOK, "templates/project_revisions.twig", pongo2.Context{
+		"_csrf_token": c.Get("csrf"),
+		"user":        context.user,
+		"project":     context.project,
+		"revisions":   revisions,
+		"submodules":  submodules,
+	})
+}
+
+//projectRevisionSubmit Pin project to selected revision and update
+func (s *Server) projectRevisionSubmit(c echo.Context) error {
+	context := c.(*EnsembleContext)
+
+	log.Infof("projectRevisionSubmit %s", context.project.Id)
+
+	project := context.project
+	if !project.IsGit() {
+		return errors.New("project is not a git project")
+	}
+	before := *project
+	project.RevisionType = formRevisionType(c)
+	project.Revision = strings.TrimSpace(c.FormValue("repo_revision"))
+	if project.RevisionType == structures.ProjectRevisionBranch {
+		project.Revision = ""
+	}
+
+	if err := repository.ValidateRevision(project); err != nil {
+		log.Errorf("projectRevisionSubmit project %s revision error: %s", project.Id, err)
+		return err
+	}
+	if err := s.store.ProjectUpdate(project); err != nil {
+		log.Errorf("projectRevisionSubmit project %s save error: %s", project.Id, err)
+		return err
+	}
+	s.audit(c, structures.AuditActionProjectRevision, structures.AuditTargetProject, project.Id, project.Name, &before, project)
+	if err := s.manager.UpdateAsync(project); err != nil && !errors.Is(err, repository.ErrUpdateRunning) {
+		log.Errorf("projectRevisionSubmit project %s update error: %s", project.Id, err)
+		return err
+	}
+
+	return c.Redirect(http.StatusFound, projectUpdateLiveUrl(project.Id))
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+//formRevisionType Revision type from project form, branch by default
+func formRevisionType(c echo.Context) int {
+	revisionType, err := strconv.Atoi(c.FormValue("repo_revision_type"))
+	if err != nil || revisionType == 0 {
+		return structures.ProjectRevisionBranch
+	}
+	return revisionType
+}
+
+//formSourceType Project source from project form, git by default
+func formSourceType(c echo.Context) int {
+	sourceType, err := strconv.Atoi(c.FormValue("source_type"))
+	if err != nil || sourceType < structures.ProjectSourceGit || sourceType > structures.ProjectSourceLocal {
+		return structures.ProjectSourceGit
+	}
+	return sourceType
+}
+
+//formUpdatePolicy Update policy from project form, skip by default
+func formUpdatePolicy(c echo.Context) int {
+	policy, err := strconv.Atoi(c.FormValue("update_policy"))
+	if err != nil || policy < structures.ProjectUpdatePolicySkip || policy > structures.ProjectUpdatePolicyRetry {
+		return structures.ProjectUpdatePolicySkip
+	}
+	return policy
+}
+
+//validateSecrets Checks secret references of project credentials, values are resolved only when used
+func (s *Server) validateSecrets(project *structures.Project) error {
+	if err := s.secrets.Validate(project.RepositoryPassword); err != nil {
+		return fmt.Errorf("repository password: %w", err)
+	}
+	if err := s.secrets.Validate(project.VaultPassword); err != nil {
+		return fmt.Errorf("vault password: %w", err)
+	}
+	return s.runner.ValidateInventoryEnv(project.InventoryEnv)
+}
+
+//projectKeys Private keys available as project deploy keys
+func (s *Server) projectKeys() []*structures.Key {
+	keys, err := s.store.KeyGetAll()
+	if err != nil {
+		log.Warnf("projectKeys keys get error: %s", err)
+		return nil
+	}
+	return keys
+}
+
+//validateSelection Checks that selected values are available and not repeated
+func validateSelection(selected, available []string) error {
+	found := make(map[string]bool)
+	for _, value := range selected {
+		if found[value] {
+			return fmt.Errorf("%s selected more than once", value)
+		}
+		found[value] = true
+
+		availableValue := false
+		for _, a := range available {
+			if a == value {
+				availableValue = true
+				break
+			}
+		}
+		if !availableValue {
+			return fmt.Errorf("%s not found", value)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,99 @@
+package web
+
+import (
+	"ensemble/storage"
+	"ensemble/storage/structures"
+	"fmt"
+	"github.com/flosch/pongo2/v4"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+//searchHit Search hit with link to matched run or update, snippet is split around the first query word
+type searchHit struct {
+	*structures.SearchHit
+	Url    string
+	Before string
+	Match  string
+	After  string
+}
+
+//search Search in run outputs, task messages, update logs and revisions of projects available to user
+func (s *Server) search(c echo.Context) error {
+	context := c.(*EnsembleContext)
+
+	var projects []*structures.Project
+	var err error
+	if context.user.CanViewAllProjects() {
+		projects, err = s.store.ProjectGetAll()
+	} else {
+		projects, err = s.store.ProjectGetByUser(context.user.Id)
+	}
+	if err != nil {
+		log.Errorf("search projects get error: %s", err)
+		return err
+	}
+
+	list := newListQuery(c)
+	filter := storage.SearchFilter{
+		Query:     strings.TrimSpace(list.Get("q")),
+		Kind:      list.Get("kind"),
+		ProjectId: list.Get("project"),
+		Page:      list.Page(),
+	}
+	if !context.user.CanViewAllProjects() {
+		filter.UserId = context.user.Id
+	}
+
+	var hits []*searchHit
+	if len(filter.Query) != 0 {
+		found, total, err := s.store.Search(filter)
+		if err != nil {
+			log.Errorf("search query %q error: %s", filter.Query, err)
+			return err
+		}
+		list.Total = total
+		if len(found) == 0 && filter.Page.Number > list.Pages() {
+			return c.Redirect(http.StatusFound, list.PageUrl(list.Pages()))
+		}
+
+		term := storage.SearchTerm(filter.Query)
+		for _, hit := range found {
+			hits = append(hits, newSearchHit(hit, term))
+		}
+	}
+
+	return c.Render(http.StatusOK, "templates/search.twig", pongo2.Context{
+		"_csrf_token": c.Get("csrf"),
+		"user":        context.user,
+		"projects":    projects,
+		"query":       filter.Query,
+		"hits":        hits,
+		"list":        list,
+	})
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func newSearchHit(hit *structures.SearchHit, term string) *searchHit {
+	h := &searchHit{
+		SearchHit: hit,
+		Before:    hit.Snippet,
+	}
+	if hit.Kind == structures.SearchKindRun {
+		h.Url = fmt.Sprintf("/projects/playbooks/%s/runs/%s/result/%s", hit.ProjectId, hit.PlaybookId, hit.TargetId)
+	} else {
+		h.Url = fmt.Sprintf("/projects/updates/%s/log/%s", hit.ProjectId, hit.TargetId)
+	}
+
+	//lower case text may differ in length for some letters, such snippets are not highlighted
+	lower := strings.ToLower(hit.Snippet)
+	if index := strings.Index(lower, term); index >= 0 && len(lower) == len(hit.Snippet) {
+		h.Before = hit.Snippet[:index]
+		h.Match = hit.Snippet[index : index+len(term)]
+		h.After = hit.Snippet[index+len(term):]
+	}
+	return h
+}
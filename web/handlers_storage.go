@@ -0,0 +1,86 @@
+package web
+
+import (
+	"ensemble/repository"
+	"ensemble/storage/structures"
+	"errors"
+	"fmt"
+	"github.com/flosch/pongo2/v4"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+//storage Disk usage of projects
+func (s *Server) storage(c echo.Context) error {
+	return s.storageRender(c, "", "", nil)
+}
+
+//storageCleanup Remove files of deleted projects
+func (s *Server) storageCleanup(c echo.Context) error {
+	log.Infof("storageCleanup")
+
+	cleaned, err := s.manager.CollectGarbage()
+	if err != nil {
+		log.Errorf("storageCleanup error: %s", err)
+		return s.storageRender(c, "", "", err)
+	}
+	s.audit(c, structures.AuditActionStorageCleanup, structures.AuditTargetStorage, "", "", nil, map[string]int{"Cleaned": cleaned})
+
+	return s.storageRender(c, fmt.Sprintf("Files of %d deleted projects removed", cleaned), "", nil)
+}
+
+//storageGitGc Compact git repository of project
+func (s *Server) storageGitGc(c echo.Context) error {
+	context := c.(*EnsembleContext)
+
+	log.Infof("storageGitGc %s", context.project.Id)
+
+	output, err := s.manager.GitGc(context.project)
+	if err != nil {
+		log.Errorf("storageGitGc project %s error: %s", context.project.Id, err)
+		return s.storageRender(c, "", output, err)
+	}
+	s.audit(c, structures.AuditActionStorageGitGc, structures.AuditTargetProject, context.project.Id, context.project.Name, nil, nil)
+
+	return s.storageRender(c, fmt.Sprintf("Repository of %s compacted", context.project.Name), output, nil)
+}
+
+//storageReclone Clone project repository from scratch
+func (s *Server) storageReclone(c echo.Context) error {
+	context := c.(*EnsembleContext)
+
+	log.Infof("storageReclone %s", context.project.Id)
+
+	if err := s.manager.Reclone(context.project); err != nil {
+		log.Errorf("storageReclone project %s error: %s", context.project.Id, err)
+		if errors.Is(err, repository.ErrUpdateRunning) {
+			return c.Redirect(http.StatusFound, projectUpdateLiveUrl(context.project.Id))
+		}
+		return s.storageRender(c, "", "", err)
+	}
+	s.audit(c, structures.AuditActionStorageReclone, structures.AuditTargetProject, context.project.Id, context.project.Name, nil, nil)
+
+	return c.Redirect(http.StatusFound, projectUpdateLiveUrl(context.project.Id))
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func (s *Server) storageRender(c echo.Context, message, output string, err error) error {
+	context := c.(*EnsembleContext)
+
+	usage, usageErr := s.manager.Usage()
+	if usageErr != nil {
+		log.Errorf("storage usage error: %s", usageErr)
+		return usageErr
+	}
+
+	return c.Render(http.StatusOK, "templates/storage.twig", pongo2.Context{
+		"_csrf_token": c.Get("csrf"),
+		"user":        context.user,
+		"usage":       usage,
+		"message":     message,
+		"output":      output,
+		"error":       err,
+	})
+}
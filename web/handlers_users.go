@@ -76,6 +76,7 @@ func (s *Server) userNewSubmit(c echo.Context) error {
 			"error":        err,
 		})
 	}
+	s.audit(c, structures.AuditActionUserCreate, structures.AuditTargetUser, user.Id, user.Login, nil, &user)
 
 	return c.Redirect(http.StatusFound, "/users")
 }
@@ -95,6 +96,7 @@ func (s *Server) userEditSubmit(c echo.Context) error {
 	log.Infof("userEditSubmit %s", context.userControl.Id)
 
 	user := context.userControl
+	before := *user
 	user.Login = c.FormValue("login")
 
 	password := c.FormValue("password")
@@ -127,6 +129,7 @@ func (s *Server) userEditSubmit(c echo.Context) error {
 			"error":        err,
 		})
 	}
+	s.audit(c, structures.AuditActionUserUpdate, structures.AuditTargetUser, user.Id, user.Login, &before, user)
 
 	return c.Redirect(http.StatusFound, "/users")
 }
@@ -158,6 +161,7 @@ func (s *Server) userDeleteSubmit(c echo.Context) error {
 		log.Errorf("userDeleteSubmit user %s delete error: %s", context.userControl.Id, err)
 		return err
 	}
+	s.audit(c, structures.AuditActionUserDelete, structures.AuditTargetUser, context.userControl.Id, context.userControl.Login, context.userControl, nil)
 
 	return c.Redirect(http.StatusFound, "/users")
 }
@@ -236,7 +240,14 @@ func (s *Server) userProjectsSubmit(c echo.Context) error {
 		log.Errorf("userProjectsSubmit user %s projects get error: %s", userId, err)
 		return err
 	}
+	var before, after []string
 	for _, project := range projects {
+		if userProjectAccess[project.Id] {
+			before = append(before, project.Name)
+		}
+		if newUserProjectAccess[project.Id] {
+			after = append(after, project.Name)
+		}
 		if !userProjectAccess[project.Id] && newUserProjectAccess[project.Id] {
 			if err := s.store.ProjectUserAccessCreate(project.Id, userId); err != nil {
 				log.Errorf("userProjectsSubmit user %s project %s grant access error: %s", userId, project.Id, err)
@@ -250,6 +261,8 @@ func (s *Server) userProjectsSubmit(c echo.Context) error {
 			}
 		}
 	}
+	s.audit(c, structures.AuditActionUserProjects, structures.AuditTargetUser, userId, context.userControl.Login,
+		map[string][]string{"Projects": before}, map[string][]string{"Projects": after})
 
 	return c.Redirect(http.StatusFound, "/users")
 }
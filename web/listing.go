@@ -0,0 +1,216 @@
+package web
+
+import (
+	"ensemble/storage"
+	"github.com/labstack/echo/v4"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	listDateFormat  = "2006-01-02"
+	listWindowPages = 2
+)
+
+var listPageSizes = []int{20, 50, 100, 200}
+
+//listQuery Filter, sort and page of history list, state is kept in url so filtered views can be shared
+type listQuery struct {
+	path   string
+	values url.Values
+	Total  int
+}
+
+func newListQuery(c echo.Context) *listQuery {
+	return &listQuery{
+		path:   c.Request().URL.Path,
+		values: c.QueryParams(),
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func (q *listQuery) Get(key string) string {
+	return q.values.Get(key)
+}
+
+//Int Number parameter, 0 when parameter is empty or invalid
+func (q *listQuery) Int(key string) int {
+	value, err := strconv.Atoi(q.values.Get(key))
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+//DateFrom Start of day from date parameter, zero time when parameter is empty or invalid
+func (q *listQuery) DateFrom(key string) time.Time {
+	date, err := time.ParseInLocation(listDateFormat, q.values.Get(key), time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return date
+}
+
+//DateTo Start of the next day from date parameter, so the whole day is included
+func (q *listQuery) DateTo(key string) time.Time {
+	date := q.DateFrom(key)
+	if date.IsZero() {
+		return date
+	}
+	return date.AddDate(0, 0, 1)
+}
+
+//Filtered Any filter parameter is set
+func (q *listQuery) Filtered() bool {
+	for key, values := range q.values {
+		if key == "page" || key == "size" || key == "sort" || key == "order" {
+			continue
+		}
+		for _, value := range values {
+			if len(value) != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (q *listQuery) Sort() storage.Sort {
+	return storage.Sort{
+		Column: q.SortColumn(),
+		Desc:   q.SortDesc(),
+	}
+}
+
+func (q *listQuery) SortColumn() string {
+	if column := q.values.Get("sort"); len(column) != 0 {
+		return column
+	}
+	return "date"
+}
+
+func (q *listQuery) SortDesc() bool {
+	if len(q.values.Get("sort")) == 0 {
+		return true
+	}
+	return q.values.Get("order") == "desc"
+}
+
+func (q *listQuery) Page() storage.Page {
+	return storage.Page{
+		Number: q.PageNumber(),
+		Size:   q.PageSize(),
+	}
+}
+
+func (q *listQuery) PageNumber() int {
+	if page := q.Int("page"); page > 1 {
+		return min(page, q.Pages())
+	}
+	return 1
+}
+
+func (q *listQuery) PageSize() int {
+	size := q.Int("size")
+	for _, allowed := range listPageSizes {
+		if size == allowed {
+			return size
+		}
+	}
+	return storage.PageSizeDefault
+}
+
+func (q *listQuery) PageSizes() []int {
+	return listPageSizes
+}
+
+//Pages Number of pages, page number is not limited until total is known
+func (q *listQuery) Pages() int {
+	if q.Total == 0 {
+		return max(q.Int("page"), 1)
+	}
+	return (q.Total + q.PageSize() - 1) / q.PageSize()
+}
+
+//PageWindow Page numbers around current page with first and last pages, 0 is a gap
+func (q *listQuery) PageWindow() []int {
+	current := q.PageNumber()
+	pages := q.Pages()
+
+	var window []int
+	for page := 1; page <= pages; page++ {
+		if page == 1 || page == pages || (page >= current-listWindowPages && page <= current+listWindowPages) {
+			window = append(window, page)
+		} else if len(window) != 0 && window[len(window)-1] != 0 {
+			window = append(window, 0)
+		}
+	}
+	return window
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func (q *listQuery) Path() string {
+	return q.path
+}
+
+func (q *listQuery) PageUrl(page int) string {
+	return q.url(map[string]string{"page": strconv.Itoa(page)})
+}
+
+//SizeUrl Changes page size, list is shown from the first page
+func (q *listQuery) SizeUrl(size int) string {
+	return q.url(map[string]string{"size": strconv.Itoa(size), "page": ""})
+}
+
+//SortUrl Sorts by column from the first page, direction is switched when list is already sorted by column
+func (q *listQuery) SortUrl(column string) string {
+	order := "asc"
+	if column == "date" {
+		order = "desc"
+	}
+	if column == q.SortColumn() {
+		order = "desc"
+		if q.SortDesc() {
+			order = "asc"
+		}
+	}
+	return q.url(map[string]string{"sort": column, "order": order, "page": ""})
+}
+
+//ResetUrl List url without filters, sort and page size are kept
+func (q *listQuery) ResetUrl() string {
+	values := url.Values{}
+	for _, key := range []string{"sort", "order", "size"} {
+		if value := q.values.Get(key); len(value) != 0 {
+			values.Set(key, value)
+		}
+	}
+	return q.encode(values)
+}
+
+//url Current list url with replaced parameters, empty values are removed
+func (q *listQuery) url(replace map[string]string) string {
+	values := url.Values{}
+	for key, value := range q.values {
+		values[key] = value
+	}
+	for key, value := range replace {
+		values.Set(key, value)
+	}
+	for key, value := range values {
+		if len(value) == 0 || len(value[0]) == 0 {
+			values.Del(key)
+		}
+	}
+	return q.encode(values)
+}
+
+func (q *listQuery) encode(values url.Values) string {
+	if len(values) == 0 {
+		return q.path
+	}
+	return q.path + "?" + values.Encode()
+}
@@ -4,11 +4,14 @@ import (
 	"ensemble/privatekeys"
 	"ensemble/repository"
 	"ensemble/runner"
+	"ensemble/scheduler"
+	"ensemble/secrets"
 	"ensemble/storage"
 	"github.com/flosch/pongo2/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	log "github.com/sirupsen/logrus"
+	"net"
 	"net/http"
 )
 
@@ -19,24 +22,30 @@ const (
 type Configuration struct {
 	DebugTemplates bool
 	Listen         string
+	TrustedProxies []*net.IPNet
 }
 
 type Server struct {
 	e          *echo.Echo
-	store      *storage.Storage
+	store      storage.Store
 	manager    *repository.Manager
 	runner     *runner.Runner
 	keyManager *privatekeys.KeyManager
+	scheduler  *scheduler.Scheduler
+	secrets    *secrets.Resolver
+
+	failedLogins *auditLimiter
 }
 
 ///////////////////////////////////////////////////////////////////////////////
 
-func New(configuration Configuration, store *storage.Storage, manager *repository.Manager, runner *runner.Runner, keyManager *privatekeys.KeyManager) *Server {
+func New(configuration Configuration, store storage.Store, manager *repository.Manager, runner *runner.Runner, keyManager *privatekeys.KeyManager, scheduler *scheduler.Scheduler, secrets *secrets.Resolver) *Server {
 	e := echo.New()
 
 	e.HideBanner = true
 	e.Renderer = Pongo2Renderer{Debug: configuration.DebugTemplates}
 	e.HTTPErrorHandler = httpErrorHandler
+	e.IPExtractor = ipExtractor(configuration.TrustedProxies)
 	e.Static("/assets", "assets")
 
 	s := &Server{
@@ -45,6 +54,10 @@ func New(configuration Configuration, store *storage.Storage, manager *repositor
 		manager:    manager,
 		runner:     runner,
 		keyManager: keyManager,
+		scheduler:  scheduler,
+		secrets:    secrets,
+
+		failedLogins: newAuditLimiter(),
 	}
 
 	s.e.Use(middleware.CSRFWithConfig(middleware.CSRFConfig{
@@ -106,9 +119,25 @@ func New(configuration Configuration, store *storage.Storage, manager *repositor
 	projectUpdate.Use(s.projectRequiredMiddleware)
 	projectUpdate.GET("/:project_id", s.projectUpdate)
 
+	projectRevisions := projects.Group("/revisions")
+	projectRevisions.Use(s.projectRequiredMiddleware)
+	projectRevisions.Use(s.projectWriteAccessRequiredMiddleware)
+	projectRevisions.GET("/:project_id", s.projectRevisions)
+	projectRevisions.POST("/:project_id", s.projectRevisionSubmit)
+
+	projectArchives := projects.Group("/archives/:project_id")
+	projectArchives.Use(s.projectRequiredMiddleware)
+	projectArchives.Use(s.projectWriteAccessRequiredMiddleware)
+	projectArchives.GET("", s.projectArchives)
+	projectArchives.POST("", s.projectArchiveUpload)
+	projectArchives.POST("/deploy", s.projectArchiveDeploy)
+
 	projectUpdates := projects.Group("/updates/:project_id")
 	projectUpdates.Use(s.projectRequiredMiddleware)
 	projectUpdates.GET("", s.projectUpdates)
+	projectUpdates.GET("/live", s.projectUpdateLive)
+	projectUpdates.GET("/live/status", s.projectUpdateLiveStatus)
+	projectUpdates.POST("/cancel", s.projectUpdateCancel)
 
 	projectUpdateLog := projectUpdates.Group("/log")
 	projectUpdateLog.Use(s.projectUpdateRequiredMiddleware)
@@ -131,6 +160,7 @@ func New(configuration Configuration, store *storage.Storage, manager *repositor
 	playbookRun := playbooks.Group("/run")
 	playbookRun.Use(s.playbookRequiredMiddleware)
 	playbookRun.GET("/:playbook_id/:operation", s.playbookRun)
+	playbookRun.POST("/:playbook_id/:operation", s.playbookRunSubmit)
 
 	playbookRuns := playbooks.Group("/runs/:playbook_id")
 	playbookRuns.Use(s.playbookRequiredMiddleware)
@@ -139,6 +169,7 @@ func New(configuration Configuration, store *storage.Storage, manager *repositor
 	playbookRunResult := playbookRuns.Group("/result")
 	playbookRunResult.Use(s.playbookRunRequiredMiddleware)
 	playbookRunResult.GET("/:playbook_run_id", s.playbookRunResult)
+	playbookRunResult.GET("/:playbook_run_id/task/:task_result_id", s.playbookRunTaskResult)
 
 	playbookRunDelete := playbookRuns.Group("/delete")
 	playbookRunDelete.Use(s.playbookRunRequiredMiddleware)
@@ -158,6 +189,11 @@ func New(configuration Configuration, store *storage.Storage, manager *repositor
 	playbookRunDownload.Use(s.playbookRunRequiredMiddleware)
 	playbookRunDownload.GET("/:playbook_run_id", s.playbookRunDownload)
 
+	//search
+	search := s.e.Group("/search")
+	search.Use(s.authenticationRequiredMiddleware)
+	search.GET("", s.search)
+
 	//users
 	users := s.e.Group("/users")
 	users.Use(s.authenticationRequiredMiddleware)
@@ -194,6 +230,25 @@ func New(configuration Configuration, store *storage.Storage, manager *repositor
 	keysDelete.GET("/:key_id", s.keyDeleteForm)
 	keysDelete.POST("/:key_id", s.keyDeleteSubmit)
 
+	//storage
+	storage := s.e.Group("/storage")
+	storage.Use(s.authenticationRequiredMiddleware)
+	storage.Use(s.storageAccessRequiredMiddleware)
+	storage.GET("", s.storage)
+	storage.POST("/cleanup", s.storageCleanup)
+
+	storageProject := storage.Group("/projects/:project_id")
+	storageProject.Use(s.projectRequiredMiddleware)
+	storageProject.POST("/gc", s.storageGitGc)
+	storageProject.POST("/reclone", s.storageReclone)
+
+	//audit log
+	audit := s.e.Group("/audit")
+	audit.Use(s.authenticationRequiredMiddleware)
+	audit.Use(s.auditAccessRequiredMiddleware)
+	audit.GET("", s.auditEvents)
+	audit.GET("/export", s.auditExport)
+
 	return s
 }
 
@@ -219,3 +274,19 @@ func httpErrorHandler(e error, c echo.Context) {
 		log.Errorf("error page render error: %s", err)
 	}
 }
+
+// ipExtractor Client address for audit log, X-Forwarded-For is trusted only from configured proxies
+func ipExtractor(trustedProxies []*net.IPNet) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, network := range trustedProxies {
+		options = append(options, echo.TrustIPRange(network))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
@@ -0,0 +1,35 @@
+package web
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIpExtractor(t *testing.T) {
+	_, proxies, err := net.ParseCIDR("10.0.0.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		proxies  []*net.IPNet
+		remote   string
+		header   string
+		expected string
+	}{
+		{"direct ignores header", nil, "10.0.0.5:1234", "203.0.113.7", "10.0.0.5"},
+		{"trusted proxy", []*net.IPNet{proxies}, "10.0.0.5:1234", "203.0.113.7", "203.0.113.7"},
+		{"untrusted proxy", []*net.IPNet{proxies}, "192.168.1.5:1234", "203.0.113.7", "192.168.1.5"},
+		{"spoofed chain", []*net.IPNet{proxies}, "10.0.0.5:1234", "198.51.100.1, 203.0.113.7", "203.0.113.7"},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.RemoteAddr = test.remote
+		request.Header.Set("X-Forwarded-For", test.header)
+		if ip := ipExtractor(test.proxies)(request); ip != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, ip)
+		}
+	}
+}
@@ -260,6 +260,36 @@ func (s *Server) keyAccessRequiredMiddleware(next echo.HandlerFunc) echo.Handler
 	}
 }
 
+func (s *Server) storageAccessRequiredMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		context := c.(*EnsembleContext)
+
+		if context.user == nil {
+			return errors.New("auth required")
+		}
+		if !context.user.CanControlStorage() {
+			return errors.New("storage access denied")
+		}
+
+		return next(c)
+	}
+}
+
+func (s *Server) auditAccessRequiredMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		context := c.(*EnsembleContext)
+
+		if context.user == nil {
+			return errors.New("auth required")
+		}
+		if !context.user.CanViewAudit() {
+			return errors.New("audit log access denied")
+		}
+
+		return next(c)
+	}
+}
+
 func (s *Server) keyRequiredMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		context := c.(*EnsembleContext)
@@ -26,6 +26,9 @@ func init() {
 	if err := pongo2.RegisterFilter("split_output", splitOutput); err != nil {
 		log.Errorf("unable to add filter split_output: %s", err)
 	}
+	if err := pongo2.RegisterFilter("format_size", formatSize); err != nil {
+		log.Errorf("unable to add filter format_size: %s", err)
+	}
 }
 
 func (r Pongo2Renderer) Render(w io.Writer, name string, data interface{}, _ echo.Context) error {
@@ -78,6 +81,26 @@ func formatDuration(in *pongo2.Value, _ *pongo2.Value) (*pongo2.Value, *pongo2.E
 	return pongo2.AsValue(str.String()), nil
 }
 
+func formatSize(in *pongo2.Value, _ *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	if !in.IsInteger() {
+		return pongo2.AsValue("ERR SIZE"), nil
+	}
+
+	size := float64(in.Integer())
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+
+	unit := 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return pongo2.AsValue(fmt.Sprintf("%d %s", in.Integer(), units[unit])), nil
+	}
+	return pongo2.AsValue(fmt.Sprintf("%.1f %s", size, units[unit])), nil
+}
+
 func splitOutput(in *pongo2.Value, _ *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
 	if !in.IsString() {
 		return pongo2.AsValue("ERR STR"), nil
@@ -0,0 +1,31 @@
+package web
+
+import (
+	"github.com/flosch/pongo2/v4"
+	"testing"
+)
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		size     interface{}
+		expected string
+	}{
+		{0, "0 B"},
+		{int64(1023), "1023 B"},
+		{int64(1024), "1.0 KB"},
+		{int64(1536), "1.5 KB"},
+		{int64(5 * 1024 * 1024), "5.0 MB"},
+		{int64(3 * 1024 * 1024 * 1024), "3.0 GB"},
+		{int64(2048) * 1024 * 1024 * 1024 * 1024, "2048.0 TB"},
+		{"large", "ERR SIZE"},
+	}
+	for _, test := range tests {
+		value, err := formatSize(pongo2.AsValue(test.size), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value.String() != test.expected {
+			t.Errorf("size %v: expected %s, got %s", test.size, test.expected, value.String())
+		}
+	}
+}